@@ -84,6 +84,16 @@ var Env = gribble.New([]gribble.Command{
 	&AutoMakeMaster{},
 	&AutoMastersMore{},
 	&AutoMastersFewer{},
+	&Balance{},
+	&SnapProportions{},
+	&GoldenRatio{},
+	&Thirds{},
+	&RotateClientsNext{},
+	&RotateClientsPrev{},
+	&LayoutSplit{},
+	&LayoutRotate{},
+	&LayoutMove{},
+	&LayoutZoom{},
 
 	&CycleClientChoose{},
 	&CycleClientHide{},
@@ -301,3 +301,243 @@ func (cmd AutoMastersMore) Run() gribble.Value {
 		return nil
 	})
 }
+
+type Balance struct {
+	Workspace gribble.Any `param:"1" types:"int,string"`
+	Help string `
+Resets every window in the layout on the workspace specified by Workspace to 
+an equal share of its split.
+
+Workspace may be a workspace index (integer) starting at 0, or a workspace name.
+`
+}
+
+func (cmd Balance) Run() gribble.Value {
+	return syncRun(func() gribble.Value {
+		withWorkspace(cmd.Workspace, func(wrk *workspace.Workspace) {
+			if wrk.State != workspace.AutoTiling {
+				return
+			}
+			wrk.LayoutAutoTiler().Balance()
+		})
+		return nil
+	})
+}
+
+type SnapProportions struct {
+	Workspace gribble.Any `param:"1" types:"int,string"`
+	Step float64 `param:"2"`
+	Help string `
+Rounds the size of every window in the layout on the workspace specified by
+Workspace to the nearest multiple of Step. For example, a Step of 0.05 makes
+every window take up a multiple of 5% of its split.
+
+Step should be a ratio between 0.0 and 1.0.
+
+Workspace may be a workspace index (integer) starting at 0, or a workspace name.
+`
+}
+
+func (cmd SnapProportions) Run() gribble.Value {
+	return syncRun(func() gribble.Value {
+		withWorkspace(cmd.Workspace, func(wrk *workspace.Workspace) {
+			if wrk.State != workspace.AutoTiling {
+				return
+			}
+			wrk.LayoutAutoTiler().SnapProportions(cmd.Step)
+		})
+		return nil
+	})
+}
+
+type GoldenRatio struct {
+	Workspace gribble.Any `param:"1" types:"int,string"`
+	Help string `
+Splits the space of the innermost two window split around the active window
+at the golden ratio, giving the larger part to the first window. This only
+applies to the layout on the workspace specified by Workspace.
+
+Workspace may be a workspace index (integer) starting at 0, or a workspace name.
+`
+}
+
+func (cmd GoldenRatio) Run() gribble.Value {
+	return syncRun(func() gribble.Value {
+		withWorkspace(cmd.Workspace, func(wrk *workspace.Workspace) {
+			if wrk.State != workspace.AutoTiling {
+				return
+			}
+			wrk.LayoutAutoTiler().GoldenRatio()
+		})
+		return nil
+	})
+}
+
+type Thirds struct {
+	Workspace gribble.Any `param:"1" types:"int,string"`
+	Help string `
+Splits the space of the innermost three window split around the active window
+into equal thirds. This only applies to the layout on the workspace specified
+by Workspace.
+
+Workspace may be a workspace index (integer) starting at 0, or a workspace name.
+`
+}
+
+func (cmd Thirds) Run() gribble.Value {
+	return syncRun(func() gribble.Value {
+		withWorkspace(cmd.Workspace, func(wrk *workspace.Workspace) {
+			if wrk.State != workspace.AutoTiling {
+				return
+			}
+			wrk.LayoutAutoTiler().Thirds()
+		})
+		return nil
+	})
+}
+
+type RotateClientsNext struct {
+	Workspace gribble.Any `param:"1" types:"int,string"`
+	Help string `
+Moves every window in the split containing the active window to the next
+position in that split, and the last window to the first position. The sizes
+of the positions stay the same. This only applies to the layout on the
+workspace specified by Workspace.
+
+Workspace may be a workspace index (integer) starting at 0, or a workspace name.
+`
+}
+
+func (cmd RotateClientsNext) Run() gribble.Value {
+	return syncRun(func() gribble.Value {
+		withWorkspace(cmd.Workspace, func(wrk *workspace.Workspace) {
+			if wrk.State != workspace.AutoTiling {
+				return
+			}
+			wrk.LayoutAutoTiler().RotateClients(true)
+		})
+		return nil
+	})
+}
+
+type RotateClientsPrev struct {
+	Workspace gribble.Any `param:"1" types:"int,string"`
+	Help string `
+Moves every window in the split containing the active window to the previous
+position in that split, and the first window to the last position. The sizes
+of the positions stay the same. This only applies to the layout on the
+workspace specified by Workspace.
+
+Workspace may be a workspace index (integer) starting at 0, or a workspace name.
+`
+}
+
+func (cmd RotateClientsPrev) Run() gribble.Value {
+	return syncRun(func() gribble.Value {
+		withWorkspace(cmd.Workspace, func(wrk *workspace.Workspace) {
+			if wrk.State != workspace.AutoTiling {
+				return
+			}
+			wrk.LayoutAutoTiler().RotateClients(false)
+		})
+		return nil
+	})
+}
+
+type LayoutSplit struct {
+	Workspace gribble.Any `param:"1" types:"int,string"`
+	Direction string `param:"2"`
+	Help string `
+Splits the active window in the direction specified by Direction, so that the
+next window opened is tiled beside it on that side. This only applies to the
+layout on the workspace specified by Workspace.
+
+Direction must be one of Left, Right, Up or Down.
+
+Workspace may be a workspace index (integer) starting at 0, or a workspace name.
+`
+}
+
+func (cmd LayoutSplit) Run() gribble.Value {
+	return syncRun(func() gribble.Value {
+		withWorkspace(cmd.Workspace, func(wrk *workspace.Workspace) {
+			if wrk.State != workspace.AutoTiling {
+				return
+			}
+			wrk.LayoutAutoTiler().Split(cmd.Direction)
+		})
+		return nil
+	})
+}
+
+type LayoutRotate struct {
+	Workspace gribble.Any `param:"1" types:"int,string"`
+	Help string `
+Turns the split containing the active window on its side, so that windows
+side by side are stacked on top of each other and vice versa. This only
+applies to the layout on the workspace specified by Workspace.
+
+Workspace may be a workspace index (integer) starting at 0, or a workspace name.
+`
+}
+
+func (cmd LayoutRotate) Run() gribble.Value {
+	return syncRun(func() gribble.Value {
+		withWorkspace(cmd.Workspace, func(wrk *workspace.Workspace) {
+			if wrk.State != workspace.AutoTiling {
+				return
+			}
+			wrk.LayoutAutoTiler().RotateSplit()
+		})
+		return nil
+	})
+}
+
+type LayoutMove struct {
+	Workspace gribble.Any `param:"1" types:"int,string"`
+	Direction string `param:"2"`
+	Help string `
+Moves the active window in the direction specified by Direction. This only
+applies to the layout on the workspace specified by Workspace.
+
+Direction must be one of Left, Right, Up or Down.
+
+Workspace may be a workspace index (integer) starting at 0, or a workspace name.
+`
+}
+
+func (cmd LayoutMove) Run() gribble.Value {
+	return syncRun(func() gribble.Value {
+		withWorkspace(cmd.Workspace, func(wrk *workspace.Workspace) {
+			if wrk.State != workspace.AutoTiling {
+				return
+			}
+			wrk.LayoutAutoTiler().MoveClient(cmd.Direction)
+		})
+		return nil
+	})
+}
+
+type LayoutZoom struct {
+	Workspace gribble.Any `param:"1" types:"int,string"`
+	Help string `
+Gives the active window almost all of the space of its split, leaving only a
+sliver for the other windows in it. Running it again puts the sizes back the
+way they were. This only applies to the layout on the workspace specified by
+Workspace.
+
+Workspace may be a workspace index (integer) starting at 0, or a workspace name.
+`
+}
+
+func (cmd LayoutZoom) Run() gribble.Value {
+	return syncRun(func() gribble.Value {
+		withWorkspace(cmd.Workspace, func(wrk *workspace.Workspace) {
+			if wrk.State != workspace.AutoTiling {
+				return
+			}
+			wrk.LayoutAutoTiler().Zoom()
+		})
+		return nil
+	})
+}
@@ -0,0 +1,245 @@
+package layout
+
+import (
+	"math"
+	"time"
+
+	"github.com/BurntSushi/xgbutil/xrect"
+
+	"github.com/cshapeshifter/wingo/misc"
+)
+
+// animFrame is the time between the frames of an animated placement.
+const animFrame = 16 * time.Millisecond
+
+// Frames, if it isn't nil, is the channel that the frames of animated
+// placements are sent through, so that they are drawn by the goroutine that
+// handles X events rather than by the goroutine of each animation. That
+// goroutine must receive from Frames and call every function it gets, which
+// draws the frame and returns. If Frames is nil, the frames are drawn by the
+// goroutines of the animations themselves.
+var Frames chan func()
+
+// animation is an animated placement of tree that is in progress. Its frames
+// are timed by a goroutine, which stops as soon as quit is closed, and drawn
+// through frames, which is what Frames was when it started. Every frame is
+// drawn with the write lock of the tree held, and cancel is only called
+// with it held, so no frame can be drawn once cancel returns.
+type animation struct {
+	tree   *tree
+	quit   chan struct{}
+	ease   easing
+	frames chan func()
+}
+
+// easing maps the fraction of the duration of an animation that has elapsed
+// to the fraction of the way that clients have moved by then. Both are
+// between 0 and 1, and an easing should map 0 to 0 and 1 to 1.
+type easing func(f float64) float64
+
+// easeLinear moves clients at the same speed all the way. It is the easing
+// that placeAnimated uses if it is given nil.
+func easeLinear(f float64) float64 {
+	return f
+}
+
+// easeInOut starts slowly, speeds up and slows down again at the end.
+func easeInOut(f float64) float64 {
+	return (1 - math.Cos(math.Pi*f)) / 2
+}
+
+// easeOut starts quickly and slows down towards the end.
+func easeOut(f float64) float64 {
+	return 1 - (1-f)*(1-f)*(1-f)
+}
+
+// tween is the movement of a single client during an animation.
+type tween struct {
+	client     Client
+	start, end xrect.Rect
+}
+
+// cancel stops the animation. It is safe to call on a nil animation.
+func (anim *animation) cancel() {
+	if anim == nil {
+		return
+	}
+	select {
+	case <-anim.quit:
+	default:
+		close(anim.quit)
+	}
+}
+
+// placeAnimated is like place, except that clients are moved from where they
+// were last placed to their new geometry over the given duration instead of
+// all at once. Clients that are new to the tree grow from nothing at the
+// center of their new geometry, and clients that have left the tree shrink
+// to nothing at the center of their old geometry. How fast they move over
+// time is given by ease, which is easeLinear if it is nil. step, if not nil,
+// is called after every frame of the animation. The frames are drawn later,
+// as described by Frames, and each of them takes the write lock of the tree,
+// so step runs with the lock held.
+//
+// Any animation still in progress is cancelled, and placing the tree again
+// (animated or not) cancels this one. The outcome is reported just like it
+// is by place, and nothing is moved unless it is placeOK.
+func (t *tree) placeAnimated(base xrect.Rect, duration time.Duration,
+	ease easing, step func()) placement {
+
+	if duration <= 0 || t.dryRun {
+		return t.place(base)
+	}
+	t.anim.cancel()
+	t.anim = nil
+	t.invalidate()
+	if t.child == nil || base == nil {
+		// Let place report which one is missing.
+		return t.place(base)
+	}
+
+	ends := make(map[Client]xrect.Rect)
+	ok := t.child.VisitLeafNodes(func(lf *leaf) bool {
+		geom, ok := t.geomOf(lf.client, base)
+		ends[lf.client] = geom
+		return ok
+	})
+	if !ok {
+		// Let place report why the tree doesn't fit.
+		return t.place(base)
+	}
+
+	tweens := make([]tween, 0, len(ends)+len(t.drawn))
+	for c, end := range ends {
+		start, ok := t.drawn[c]
+		if !ok {
+			start = vanishingPoint(end)
+		}
+		c.FrameTile()
+		tweens = append(tweens, tween{c, start, end})
+	}
+	for c, start := range t.drawn {
+		if _, ok := ends[c]; ok {
+			continue
+		}
+		if t.alive != nil && !t.alive(c) {
+			continue
+		}
+		tweens = append(tweens, tween{c, start, vanishingPoint(start)})
+	}
+	showActiveTabs(t, t.child)
+
+	t.geom, t.drawn = base, ends
+	if ease == nil {
+		ease = easeLinear
+	}
+	t.anim = &animation{
+		tree:   t,
+		quit:   make(chan struct{}),
+		ease:   ease,
+		frames: Frames,
+	}
+	go t.anim.run(tweens, duration, step)
+	t.firePlaced(true)
+	return placeOK
+}
+
+// run draws the frames of the animation until it is done or cancelled.
+func (anim *animation) run(tweens []tween, duration time.Duration,
+	step func()) {
+
+	ticker := time.NewTicker(animFrame)
+	defer ticker.Stop()
+
+	start := time.Now()
+	for {
+		select {
+		case <-anim.quit:
+			return
+		case now := <-ticker.C:
+			more := anim.draw(func() bool {
+				return anim.frame(tweens, now.Sub(start), duration, step)
+			})
+			if !more {
+				return
+			}
+		}
+	}
+}
+
+// draw calls frame through the frames of the animation, or directly if they
+// are nil, and returns what it returned. It returns false without calling
+// frame if the animation is cancelled before the frame is received.
+func (anim *animation) draw(frame func() bool) bool {
+	if anim.frames == nil {
+		return frame()
+	}
+	more := make(chan bool, 1)
+	select {
+	case anim.frames <- func() { more <- frame() }:
+		return <-more
+	case <-anim.quit:
+		return false
+	}
+}
+
+// frame draws the frame of the animation at elapsed, with its easing applied
+// to the fraction of duration that has elapsed, and returns false if it was
+// the last frame or if the animation has been cancelled.
+func (anim *animation) frame(tweens []tween, elapsed, duration time.Duration,
+	step func()) bool {
+
+	anim.tree.Lock()
+	defer anim.tree.Unlock()
+
+	select {
+	case <-anim.quit:
+		return false
+	default:
+	}
+
+	f := float64(elapsed) / float64(duration)
+	if f > 1 {
+		f = 1
+	}
+	moved := anim.ease(f)
+	for _, tw := range tweens {
+		g := interpolate(tw.start, tw.end, moved)
+		tw.client.MoveResize(g.X(), g.Y(), g.Width(), g.Height())
+	}
+	if step != nil {
+		step()
+	}
+	return f < 1
+}
+
+// interpolate returns the geometry that is the fraction f of the way from
+// start to end. Widths and heights are never less than one pixel.
+func interpolate(start, end xrect.Rect, f float64) xrect.Rect {
+	mix := func(a, b int) int {
+		return a + misc.Round(float64(b-a)*f)
+	}
+	return xrect.New(
+		mix(start.X(), end.X()),
+		mix(start.Y(), end.Y()),
+		misc.Max(1, mix(start.Width(), end.Width())),
+		misc.Max(1, mix(start.Height(), end.Height())))
+}
+
+// vanishingPoint returns the geometry with no size at the center of geom.
+func vanishingPoint(geom xrect.Rect) xrect.Rect {
+	return xrect.New(geom.X()+geom.Width()/2, geom.Y()+geom.Height()/2, 0, 0)
+}
+
+// showActiveTabs calls showActive on every stack in n.
+func showActiveTabs(t *tree, n node) {
+	if st, ok := n.(*stack); ok {
+		st.showActive(t)
+		return
+	}
+	if s := asSplit(n); s != nil {
+		for _, child := range s.children {
+			showActiveTabs(t, child)
+		}
+	}
+}
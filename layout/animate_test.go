@@ -0,0 +1,153 @@
+package layout
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/xgbutil/xrect"
+)
+
+// animatedTree returns a master/stack tree of two clients that was placed in
+// base, with a third client added beside the second since.
+func animatedTree(base xrect.Rect) (*tree, []*fakeClient) {
+	cs := newFakes(3)
+	tr := newMasterStack(cs[0], []Client{cs[1]})
+	tr.place(base)
+	tr.insertBeside(cs[1], newLeaf(nil, cs[2]), true)
+	moves(cs)
+	return tr, cs
+}
+
+// drawFrames calls the frames received from Frames until none has come for
+// a while, and returns how many there were.
+func drawFrames() int {
+	frames := 0
+	for {
+		select {
+		case f := <-Frames:
+			f()
+			frames++
+		case <-time.After(10 * animFrame):
+			return frames
+		}
+	}
+}
+
+func TestAnimateDirect(t *testing.T) {
+	base := xrect.New(0, 0, 100, 100)
+	tr, cs := animatedTree(base)
+	steps := make(chan bool, 100)
+	if got := tr.PlaceAnimated(base, 5*animFrame, easeInOut, func() {
+		steps <- true
+	}); got != placeOK {
+		t.Fatalf("The animation was not started, but got %d.", got)
+	}
+	time.Sleep(15 * animFrame)
+
+	tr.Lock()
+	defer tr.Unlock()
+	if len(steps) < 2 {
+		t.Fatalf("There were %d steps.", len(steps))
+	}
+	for i, want := range []string{
+		"0,0 50x100", "50,0 50x50", "50,50 50x50",
+	} {
+		if got := cs[i].geomString(); got != want {
+			t.Fatalf("'%s' is at %s instead of %s.", cs[i], got, want)
+		}
+	}
+}
+
+func TestAnimateFrames(t *testing.T) {
+	Frames = make(chan func())
+	defer func() {
+		Frames = nil
+	}()
+	base := xrect.New(0, 0, 100, 100)
+	tr, cs := animatedTree(base)
+	steps := 0
+	tr.PlaceAnimated(base, 5*animFrame, nil, func() {
+		steps++
+	})
+
+	// Nothing is drawn until the frames are received, and then every frame
+	// is drawn by the goroutine that receives it.
+	time.Sleep(3 * animFrame)
+	if n := moves(cs); n != 0 {
+		t.Fatalf("Clients were moved %d times before any frame was drawn.",
+			n)
+	}
+	if frames := drawFrames(); frames < 2 || steps != frames {
+		t.Fatalf("%d frames were drawn, with %d steps.", frames, steps)
+	}
+	if got := cs[2].geomString(); got != "50,50 50x50" {
+		t.Fatalf("'%s' is at %s after the animation.", cs[2], got)
+	}
+}
+
+func TestAnimateFramesCancelled(t *testing.T) {
+	Frames = make(chan func())
+	defer func() {
+		Frames = nil
+	}()
+	base := xrect.New(0, 0, 100, 100)
+	tr, cs := animatedTree(base)
+	tr.PlaceAnimated(base, 20*animFrame, nil, nil)
+	time.Sleep(2 * animFrame)
+
+	// A frame that is waiting to be drawn when the tree is placed again
+	// doesn't move anything, whether it is received or not.
+	tr.Place(xrect.New(0, 0, 200, 100))
+	moves(cs)
+	drawFrames()
+	if n := moves(cs); n != 0 {
+		t.Fatalf("Clients were moved %d times after the animation was "+
+			"cancelled.", n)
+	}
+	if got := cs[0].geomString(); got != "0,0 100x100" {
+		t.Fatalf("'%s' is at %s.", cs[0], got)
+	}
+}
+
+func TestEasing(t *testing.T) {
+	for i, ease := range []easing{easeLinear, easeInOut, easeOut} {
+		if math.Abs(ease(0)) > 1e-9 || math.Abs(ease(1)-1) > 1e-9 {
+			t.Fatalf("Easing %d doesn't go from 0 to 1.", i)
+		}
+	}
+	if easeOut(0.5) <= 0.5 || math.Abs(easeInOut(0.5)-0.5) > 1e-9 ||
+		easeInOut(0.25) >= 0.25 {
+
+		t.Fatalf("The easings don't have their shapes.")
+	}
+
+	// The elapsed fraction goes through the easing, and what comes out of
+	// it is what the geometry is interpolated with.
+	c := newFake(1)
+	tweens := []tween{
+		{c, xrect.New(0, 0, 100, 100), xrect.New(100, 0, 100, 100)},
+	}
+	var fractions []float64
+	anim := &animation{
+		tree: newTree(),
+		quit: make(chan struct{}),
+		ease: func(f float64) float64 {
+			fractions = append(fractions, f)
+			return f * f
+		},
+	}
+	if !anim.frame(tweens, 50*time.Millisecond, 100*time.Millisecond, nil) {
+		t.Fatalf("The frame halfway through was the last one.")
+	}
+	if len(fractions) != 1 || fractions[0] != 0.5 || c.x != 25 {
+		t.Fatalf("The easing got %v, and '%s' is at %s.",
+			fractions, c, c.geomString())
+	}
+	if anim.frame(tweens, 200*time.Millisecond, 100*time.Millisecond, nil) ||
+		c.x != 100 {
+
+		t.Fatalf("The frame after the end left '%s' at %s.",
+			c, c.geomString())
+	}
+}
@@ -0,0 +1,440 @@
+package layout
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// The binary form of a tree is a compact alternative to MarshalJSON, for
+// saving the layout often (e.g., after every change). It holds the same
+// settings and nodes as the JSON form. Every number is an unsigned varint,
+// and the tree is encoded as
+//
+//	version settings node
+//
+// where the settings are
+//
+//	inner_gap outer_gap strut_top strut_right strut_bottom strut_left
+//	min_leaf_px scale flags round_mode removal_policy drop_center
+//	max_depth max_children snap_step
+//
+// The scale is the bits of a float64, and the bits of flags are, from the
+// lowest, scroll_overflow, stack_fallback, focus_wrap and
+// remember_proportions. Proportions (like drop_center) are fixed-point
+// numbers with propBits fractional bits. A node is its type, its proportion
+// and its fixed size, followed by
+//
+//	leaf:  window_id flags label class instance title
+//	stack: active child_count child...
+//	split: min_prop max_prop anchor scroll_offset child_count child...
+//	grid:  rows cols row_prop... col_prop... cell...
+//
+// where the only flag of a leaf is sticky, a string is its length followed
+// by its bytes, and the cells of a grid are in row-major order, with an
+// empty cell encoded as a node of type binaryNone. An empty tree is encoded
+// with a single node of type binaryNone too.
+//
+// Version 1 of the form only had the gaps for settings, kept only the
+// window id and label of the client of a leaf, and had no grids (they were
+// saved as a vsplit of hsplits) nor settings of splits. It can still be
+// decoded.
+
+const (
+	binaryVersion = 2
+	propBits      = 32
+)
+
+const (
+	binaryNone = iota
+	binaryHSplit
+	binaryVSplit
+	binaryLeaf
+	binaryStack
+	binaryGrid
+)
+
+// The flags of the settings of a tree in its binary form.
+const (
+	binaryScrollOverflow = 1 << iota
+	binaryStackFallback
+	binaryFocusWrap
+	binaryRememberProps
+)
+
+// binarySticky is the flag of a sticky leaf in the binary form.
+const binarySticky = 1
+
+// MarshalBinary encodes the tree in its binary form. Decode it with
+// UnmarshalBinary or unmarshalBinaryTree.
+func (t *tree) MarshalBinary() ([]byte, error) {
+	t.RLock()
+	defer t.RUnlock()
+
+	return t.marshalBinary()
+}
+
+// marshalBinary is MarshalBinary for callers that hold the lock of the tree.
+func (t *tree) marshalBinary() ([]byte, error) {
+	jt := toJSONTree(t)
+	buf := new(bytes.Buffer)
+	putUvarint(buf, binaryVersion)
+	writeBinarySettings(buf, jt)
+	if jt.Root == nil {
+		putUvarint(buf, binaryNone)
+		return buf.Bytes(), nil
+	}
+	if err := writeBinaryNode(buf, jt.Root); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeBinarySettings(buf *bytes.Buffer, jt *jsonTree) {
+	for _, v := range []int{
+		jt.InnerGap, jt.OuterGap,
+		jt.StrutTop, jt.StrutRight, jt.StrutBottom, jt.StrutLeft,
+		jt.MinLeafPx,
+	} {
+		putUvarint(buf, uint64(v))
+	}
+	putUvarint(buf, math.Float64bits(jt.Scale))
+
+	flags := uint64(0)
+	if jt.ScrollOverflow {
+		flags |= binaryScrollOverflow
+	}
+	if jt.StackFallback {
+		flags |= binaryStackFallback
+	}
+	if jt.FocusWrap {
+		flags |= binaryFocusWrap
+	}
+	if jt.RememberProps {
+		flags |= binaryRememberProps
+	}
+	putUvarint(buf, flags)
+	putUvarint(buf, uint64(jt.RoundMode))
+	putUvarint(buf, uint64(jt.RemovalPolicy))
+	putProportion(buf, jt.DropCenter)
+	putUvarint(buf, uint64(jt.MaxDepth))
+	putUvarint(buf, uint64(jt.MaxChildren))
+	putProportion(buf, jt.SnapStep)
+}
+
+func writeBinaryNode(buf *bytes.Buffer, jn *jsonNode) error {
+	var typ uint64
+	switch jn.Type {
+	case jsonHSplit:
+		typ = binaryHSplit
+	case jsonVSplit:
+		typ = binaryVSplit
+	case jsonLeaf:
+		typ = binaryLeaf
+	case jsonStack:
+		typ = binaryStack
+	case jsonGrid:
+		typ = binaryGrid
+	default:
+		return fmt.Errorf("Unknown node type '%s'.", jn.Type)
+	}
+	putUvarint(buf, typ)
+	putProportion(buf, jn.Proportion)
+	putUvarint(buf, uint64(jn.FixedPx))
+
+	switch typ {
+	case binaryLeaf:
+		id, err := strconv.ParseUint(jn.Client, 10, 64)
+		if err != nil {
+			return fmt.Errorf("The client id '%s' is not a window id.",
+				jn.Client)
+		}
+		putUvarint(buf, id)
+		flags := uint64(0)
+		if jn.Sticky {
+			flags |= binarySticky
+		}
+		putUvarint(buf, flags)
+		for _, s := range []string{
+			jn.Label, jn.Class, jn.Instance, jn.Title,
+		} {
+			putString(buf, s)
+		}
+		return nil
+	case binaryStack:
+		putUvarint(buf, uint64(jn.Active))
+	case binaryGrid:
+		putUvarint(buf, uint64(jn.Rows))
+		putUvarint(buf, uint64(jn.Cols))
+		for _, p := range append(jn.RowProps, jn.ColProps...) {
+			putProportion(buf, p)
+		}
+		for _, cell := range jn.Children {
+			if cell == nil {
+				putUvarint(buf, binaryNone)
+				continue
+			}
+			if err := writeBinaryNode(buf, cell); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		bounds := [2]float64{
+			float64(defaultMinProportion), float64(defaultMaxProportion),
+		}
+		if jn.Bounds != nil {
+			bounds = *jn.Bounds
+		}
+		putProportion(buf, bounds[0])
+		putProportion(buf, bounds[1])
+		putUvarint(buf, uint64(jn.Anchor))
+		putUvarint(buf, uint64(jn.ScrollOffset))
+	}
+	putUvarint(buf, uint64(len(jn.Children)))
+	for _, child := range jn.Children {
+		if err := writeBinaryNode(buf, child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func putUvarint(buf *bytes.Buffer, v uint64) {
+	var scratch [binary.MaxVarintLen64]byte
+	buf.Write(scratch[:binary.PutUvarint(scratch[:], v)])
+}
+
+// putProportion writes p as a fixed-point number, with propBits fractional
+// bits. Negative proportions are written as zero.
+func putProportion(buf *bytes.Buffer, p float64) {
+	putUvarint(buf, uint64(math.Floor(math.Max(0, p)*(1<<propBits)+0.5)))
+}
+
+func putString(buf *bytes.Buffer, s string) {
+	putUvarint(buf, uint64(len(s)))
+	buf.WriteString(s)
+}
+
+// UnmarshalBinary rearranges the tiled clients of the tree into the tree
+// encoded by MarshalBinary, and gives it the settings of that tree. The
+// leaves are given the clients of the tree with its clientMatcher, and the
+// clients in no leaf are added beside the active client afterwards, just
+// like loadLayout does. The tree is placed again afterwards.
+//
+// An error is returned if data can't be decoded, in which case the tree
+// isn't changed.
+func (t *tree) UnmarshalBinary(data []byte) error {
+	t.Lock()
+	defer t.Unlock()
+
+	resolve, unmatched := t.clientResolver()
+	loaded, err := unmarshalBinaryTree(data, resolve)
+	if err != nil {
+		return err
+	}
+
+	return t.mutateErr("UnmarshalBinary", func() error {
+		t.unmonocled, t.selection = nil, nil
+		copySettings(t, loaded)
+		t.setChild(loaded.child)
+		for _, c := range unmatched() {
+			if err := t.tileBesideActive(c); err != nil {
+				return err
+			}
+		}
+		t.replace()
+		return nil
+	})
+}
+
+// unmarshalBinaryTree decodes a tree encoded by MarshalBinary, in the same
+// way that unmarshalTree decodes the JSON form. The hints that version 1 of
+// the binary form gives to resolve only have an Id and a Label.
+func unmarshalBinaryTree(data []byte,
+	resolve func(hint clientHint) Client) (*tree, error) {
+
+	br := &binaryReader{r: bytes.NewReader(data)}
+	br.version = br.uvarint()
+	if br.err == nil && br.version != 1 && br.version != binaryVersion {
+		return nil, fmt.Errorf("Unknown binary layout version %d.",
+			br.version)
+	}
+	jt := br.settings()
+	root, err := br.node()
+	if err != nil {
+		return nil, err
+	}
+	if br.r.Len() > 0 {
+		return nil, fmt.Errorf("There are %d bytes left over after the "+
+			"binary layout.", br.r.Len())
+	}
+	jt.Root = root
+	return fromJSONTree(jt, resolve)
+}
+
+// binaryReader reads the binary form of a tree of the given version. The
+// first error is kept in err, after which everything that is read is zero.
+type binaryReader struct {
+	r       *bytes.Reader
+	version uint64
+	err     error
+}
+
+func (br *binaryReader) uvarint() uint64 {
+	if br.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(br.r)
+	if err != nil {
+		br.err = fmt.Errorf("The binary layout is truncated.")
+	}
+	return v
+}
+
+func (br *binaryReader) int() int {
+	return int(br.uvarint())
+}
+
+func (br *binaryReader) proportion() float64 {
+	return float64(br.uvarint()) / (1 << propBits)
+}
+
+func (br *binaryReader) string() string {
+	n := br.uvarint()
+	if br.err != nil {
+		return ""
+	}
+	if n > uint64(br.r.Len()) {
+		br.err = fmt.Errorf("The binary layout is truncated.")
+		return ""
+	}
+	b := make([]byte, n)
+	br.r.Read(b)
+	return string(b)
+}
+
+// settings reads the settings of a tree into its JSON form. Version 1 only
+// has the gaps, so the other settings are those of a new tree.
+func (br *binaryReader) settings() *jsonTree {
+	jt := toJSONTree(newTree())
+	jt.InnerGap, jt.OuterGap = br.int(), br.int()
+	if br.version == 1 {
+		return jt
+	}
+	jt.StrutTop, jt.StrutRight = br.int(), br.int()
+	jt.StrutBottom, jt.StrutLeft = br.int(), br.int()
+	jt.MinLeafPx = br.int()
+	jt.Scale = math.Float64frombits(br.uvarint())
+
+	flags := br.uvarint()
+	jt.ScrollOverflow = flags&binaryScrollOverflow != 0
+	jt.StackFallback = flags&binaryStackFallback != 0
+	jt.FocusWrap = flags&binaryFocusWrap != 0
+	jt.RememberProps = flags&binaryRememberProps != 0
+	jt.RoundMode, jt.RemovalPolicy = br.int(), br.int()
+	jt.DropCenter = br.proportion()
+	jt.MaxDepth, jt.MaxChildren = br.int(), br.int()
+	jt.SnapStep = br.proportion()
+	return jt
+}
+
+// node reads a node into its JSON form, or returns nil for binaryNone.
+func (br *binaryReader) node() (*jsonNode, error) {
+	typ := br.uvarint()
+	if br.err == nil && typ == binaryNone {
+		return nil, nil
+	}
+	jn := &jsonNode{
+		Proportion: br.proportion(),
+		FixedPx:    br.int(),
+	}
+	if br.err != nil {
+		return nil, br.err
+	}
+	switch typ {
+	case binaryLeaf:
+		jn.Type = jsonLeaf
+		jn.Client = strconv.FormatUint(br.uvarint(), 10)
+		if br.version == 1 {
+			jn.Label = br.string()
+			return jn, br.err
+		}
+		jn.Sticky = br.uvarint()&binarySticky != 0
+		jn.Label, jn.Class = br.string(), br.string()
+		jn.Instance, jn.Title = br.string(), br.string()
+		return jn, br.err
+	case binaryHSplit:
+		jn.Type = jsonHSplit
+	case binaryVSplit:
+		jn.Type = jsonVSplit
+	case binaryStack:
+		jn.Type = jsonStack
+		jn.Active = br.int()
+	case binaryGrid:
+		if br.version == 1 {
+			return nil, fmt.Errorf("Unknown binary node type %d.", typ)
+		}
+		jn.Type = jsonGrid
+		return br.grid(jn)
+	default:
+		return nil, fmt.Errorf("Unknown binary node type %d.", typ)
+	}
+	if jn.Type != jsonStack && br.version != 1 {
+		min, max := br.proportion(), br.proportion()
+		if !proportion(min).Equal(defaultMinProportion) ||
+			!proportion(max).Equal(defaultMaxProportion) {
+
+			jn.Bounds = &[2]float64{min, max}
+		}
+		jn.Anchor, jn.ScrollOffset = br.int(), br.int()
+	}
+	count := br.uvarint()
+	for i := uint64(0); i < count && br.err == nil; i++ {
+		child, err := br.node()
+		if err != nil {
+			return nil, err
+		}
+		if child == nil {
+			return nil, fmt.Errorf("A %s cannot contain an empty node.",
+				jn.Type)
+		}
+		jn.Children = append(jn.Children, child)
+	}
+	return jn, br.err
+}
+
+// grid reads the rows, columns and cells of a grid into jn.
+func (br *binaryReader) grid(jn *jsonNode) (*jsonNode, error) {
+	jn.Rows, jn.Cols = br.int(), br.int()
+	if br.err != nil {
+		return nil, br.err
+	}
+	// Every cell takes at least a byte, which also keeps a corrupt size from
+	// allocating too much. The sizes are checked one at a time first, since
+	// their product could overflow.
+	left := br.r.Len()
+	if jn.Rows <= 0 || jn.Cols <= 0 {
+		return nil, fmt.Errorf("A grid cannot have %d rows and %d columns.",
+			jn.Rows, jn.Cols)
+	}
+	if jn.Rows > left || jn.Cols > left || jn.Rows > left/jn.Cols {
+		return nil, fmt.Errorf("The binary layout is truncated.")
+	}
+	for r := 0; r < jn.Rows && br.err == nil; r++ {
+		jn.RowProps = append(jn.RowProps, br.proportion())
+	}
+	for c := 0; c < jn.Cols && br.err == nil; c++ {
+		jn.ColProps = append(jn.ColProps, br.proportion())
+	}
+	for i := 0; i < jn.Rows*jn.Cols && br.err == nil; i++ {
+		cell, err := br.node()
+		if err != nil {
+			return nil, err
+		}
+		jn.Children = append(jn.Children, cell)
+	}
+	return jn, br.err
+}
@@ -0,0 +1,249 @@
+package layout
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/BurntSushi/xgbutil/xrect"
+)
+
+func TestBinaryRoundTrip(t *testing.T) {
+	tr, cs := settledTree()
+	data, err := tr.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := unmarshalBinaryTree(data, resolveFakes(cs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkValid(t, decoded)
+
+	// The binary form keeps everything that the JSON form does, give or take
+	// the precision of its proportions.
+	want, _ := tr.MarshalJSON()
+	got, _ := decoded.MarshalJSON()
+	var wantVal, gotVal interface{}
+	json.Unmarshal(want, &wantVal)
+	json.Unmarshal(got, &gotVal)
+	if !closeValues(gotVal, wantVal) {
+		t.Fatalf("The tree was\n%s\nbut it was decoded as\n%s", want, got)
+	}
+	checkSameGeoms(t, tr, decoded, cs)
+}
+
+// closeValues returns whether the decoded JSON values a and b are the same,
+// with numbers that are equal as proportions.
+func closeValues(a, b interface{}) bool {
+	switch a := a.(type) {
+	case float64:
+		b, ok := b.(float64)
+		return ok && proportion(a).Equal(proportion(b))
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !closeValues(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k := range a {
+			if !closeValues(a[k], b[k]) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+func TestBinaryCorrupt(t *testing.T) {
+	tr, cs := settledTree()
+	data, err := tr.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n := 0; n < len(data); n++ {
+		if _, err := unmarshalBinaryTree(data[:n], resolveFakes(cs)); err ==
+			nil {
+
+			t.Fatalf("The first %d of %d bytes were decoded.", n, len(data))
+		}
+	}
+	if _, err := unmarshalBinaryTree(append(data, 0),
+		resolveFakes(cs)); err == nil {
+
+		t.Fatal("A trailing byte was decoded.")
+	}
+
+	data, _ = newTree().MarshalBinary()
+	if empty, err := unmarshalBinaryTree(data, resolveFakes(cs)); err != nil {
+		t.Fatal(err)
+	} else if empty.child != nil {
+		t.Fatalf("An empty tree was decoded as\n%s", empty.dump())
+	}
+}
+
+func TestBinaryVersion1(t *testing.T) {
+	// The gaps 3 and 7, and an hsplit of the leaves of the windows 1 and 2,
+	// the second one labeled "ed".
+	data := []byte{
+		1, 3, 7,
+		binaryHSplit, 0x80, 0x80, 0x80, 0x80, 0x10, 0, 2,
+		binaryLeaf, 0x80, 0x80, 0x80, 0x80, 0x08, 0, 1, 0,
+		binaryLeaf, 0x80, 0x80, 0x80, 0x80, 0x08, 0, 2, 2, 'e', 'd',
+	}
+	cs := newFakes(2)
+	decoded, err := unmarshalBinaryTree(data, resolveFakes(cs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkValid(t, decoded)
+	if decoded.innerGap != 3 || decoded.outerGap != 7 {
+		t.Fatalf("The gaps are %d and %d instead of 3 and 7.",
+			decoded.innerGap, decoded.outerGap)
+	}
+	if decoded.scale != 1 || !decoded.stackFallback {
+		t.Fatal("The settings missing from version 1 are not the defaults.")
+	}
+	if lf := decoded.findLeafByLabel("ed"); lf == nil || lf.client != cs[1] {
+		t.Fatalf("'%s' is not labeled.\n%s", cs[1], decoded.dump())
+	}
+}
+
+func TestUnmarshalBinary(t *testing.T) {
+	saved, cs := settledTree()
+	data, err := saved.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The clients are rearranged, and the one that the saved tree doesn't
+	// have is added beside the active client.
+	extra := newFake(8)
+	tr := autoTree(t, append(cs, extra))
+	base := xrect.New(0, 0, 1279, 1023)
+	tr.place(base)
+	if err := tr.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	checkValid(t, tr)
+	if !tr.Exists(extra) {
+		t.Fatalf("'%s' was lost.\n%s", extra, tr.dump())
+	}
+	if tr.scale != saved.scale || tr.minLeafPx != saved.minLeafPx {
+		t.Fatal("The settings of the saved tree were not restored.")
+	}
+	if err := tr.Remove(extra); err != nil {
+		t.Fatal(err)
+	}
+	checkSameGeoms(t, saved, tr, cs)
+
+	if err := tr.UnmarshalBinary(data[:len(data)/2]); err == nil {
+		t.Fatal("Half of the binary form was decoded.")
+	}
+	checkValid(t, tr)
+}
+
+func benchmarkUnmarshal(b *testing.B, marshal func(tr *tree) ([]byte, error),
+	unmarshal func(data []byte,
+		resolve func(hint clientHint) Client) (*tree, error)) {
+
+	tr, cs := masterStackOf(50)
+	data, err := marshal(tr)
+	if err != nil {
+		b.Fatal(err)
+	}
+	resolve := resolveFakes(cs)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := unmarshal(data, resolve); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(len(data)), "bytes")
+}
+
+func marshalJSON(tr *tree) ([]byte, error) {
+	return json.Marshal(tr)
+}
+
+func marshalBinary(tr *tree) ([]byte, error) {
+	return tr.MarshalBinary()
+}
+
+func BenchmarkMarshalJSON(b *testing.B) {
+	tr, _ := masterStackOf(50)
+	for i := 0; i < b.N; i++ {
+		marshalJSON(tr)
+	}
+}
+
+func BenchmarkMarshalBinary(b *testing.B) {
+	tr, _ := masterStackOf(50)
+	for i := 0; i < b.N; i++ {
+		marshalBinary(tr)
+	}
+}
+
+func BenchmarkUnmarshalJSON(b *testing.B) {
+	benchmarkUnmarshal(b, marshalJSON, unmarshalTree)
+}
+
+func BenchmarkUnmarshalBinary(b *testing.B) {
+	benchmarkUnmarshal(b, marshalBinary, unmarshalBinaryTree)
+}
+
+func TestBinaryCorruptGrid(t *testing.T) {
+	empty, err := newTree().MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// header returns the settings of a new tree followed by the root grid
+	// with the given size, and then the bytes in rest.
+	header := func(rows, cols uint64, rest ...byte) []byte {
+		buf := bytes.NewBuffer(append([]byte{}, empty[:len(empty)-1]...))
+		putUvarint(buf, binaryGrid)
+		putProportion(buf, float64(fullPortion))
+		putUvarint(buf, 0)
+		putUvarint(buf, rows)
+		putUvarint(buf, cols)
+		buf.Write(rest)
+		return buf.Bytes()
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"product overflows", header(1<<32, 1<<32)},
+		{"product overflows int", header(1<<62, 4, 0, 0, 0, 0)},
+		{"negative", header(1<<63, 1, 0, 0, 0)},
+		{"no rows", header(0, 3, 0, 0, 0)},
+		{"longer than the data", header(3, 3, 0, 0)},
+		{"proportions truncated", header(2, 2, 0x80, 0x80, 0x80, 0x80)},
+		{"cells truncated", header(1, 1, 0x80, 0x80, 0x80, 0x80, 0x10,
+			0x80, 0x80, 0x80, 0x80, 0x10)},
+	}
+	for _, test := range tests {
+		if _, err := unmarshalBinaryTree(test.data, nil); err == nil {
+			t.Errorf("%s: A corrupt grid was decoded.", test.name)
+		}
+	}
+
+	// A well formed grid is decoded, so the headers above are only wrong
+	// where they are meant to be.
+	data := header(1, 1, 0x80, 0x80, 0x80, 0x80, 0x10,
+		0x80, 0x80, 0x80, 0x80, 0x10, binaryNone)
+	if _, err := unmarshalBinaryTree(data, nil); err != nil {
+		t.Fatalf("A 1x1 grid with an empty cell wasn't decoded: %s", err)
+	}
+}
@@ -0,0 +1,81 @@
+package layout
+
+import (
+	"fmt"
+)
+
+// H describes an hsplit for buildTree, as the shares of its children from
+// left to right.
+type H []share
+
+// V describes a vsplit for buildTree, as the shares of its children from top
+// to bottom.
+type V []share
+
+// share is a child of a split described by H or V: its proportion, and what
+// it is, which is either a Client (for a leaf) or another H or V.
+type share struct {
+	prop proportion
+	of   interface{}
+}
+
+// buildTree creates a tree declaratively from spec, which is a Client (for a
+// tree with a single leaf), an H or a V, or nil for an empty tree. For
+// example, this creates an hsplit with a on the left and a vsplit of b above
+// c on the right:
+//
+//	buildTree(H{{0.6, a}, {0.4, V{{0.5, b}, {0.5, c}}}})
+//
+// An error is returned if the proportions of the children of any split
+// don't add up to fullPortion, if a split has no children, or if spec
+// contains anything else.
+func buildTree(spec interface{}) (*tree, error) {
+	t := newTree()
+	if spec == nil {
+		return t, nil
+	}
+	root, err := buildNode(spec, nil)
+	if err != nil {
+		return nil, err
+	}
+	root.SetProportion(fullPortion)
+	t.setChild(root)
+	return t, nil
+}
+
+func buildNode(spec interface{}, parent splitter) (node, error) {
+	var s splitter
+	var shares []share
+	switch spec := spec.(type) {
+	case Client:
+		return newLeaf(parent, spec), nil
+	case H:
+		s, shares = newHSplit(parent), spec
+	case V:
+		s, shares = newVSplit(parent), spec
+	default:
+		return nil, fmt.Errorf("Cannot build a node from %T.", spec)
+	}
+	if len(shares) == 0 {
+		return nil, fmt.Errorf("The split '%s' has no children.", s)
+	}
+
+	sp, sum := asSplit(s), proportion(0)
+	for _, sh := range shares {
+		if !sh.prop.valid() || sh.prop <= 0 {
+			return nil, fmt.Errorf("Invalid proportion %f.", sh.prop)
+		}
+		child, err := buildNode(sh.of, s)
+		if err != nil {
+			return nil, err
+		}
+		child.SetProportion(sh.prop)
+		sp.children = append(sp.children, child)
+		sum += sh.prop
+	}
+	if !sum.Equal(fullPortion) {
+		return nil, fmt.Errorf("The proportions of the children of '%s' "+
+			"add up to %f instead of %f.", s, sum, fullPortion)
+	}
+	return s, nil
+}
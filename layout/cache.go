@@ -0,0 +1,87 @@
+package layout
+
+import (
+	"github.com/BurntSushi/xgbutil/xrect"
+)
+
+// geomCache is the geometry that a node was last given by MoveResize, which
+// lets placing the tree again skip the nodes whose geometry hasn't changed.
+// dirty is set when something about the node changed that its geometry
+// doesn't show, like its children or its client, so that it is moved again
+// anyway. Every node embeds one.
+type geomCache struct {
+	rect  xrect.Rect
+	dirty bool
+}
+
+func (c *geomCache) cache() *geomCache {
+	return c
+}
+
+// markDirty marks n and all of its ancestors dirty, so that the next
+// placement moves n again, even if none of their geometries change.
+func markDirty(n node) {
+	for ; n != nil; n = n.Parent() {
+		n.cache().dirty = true
+	}
+}
+
+// invalidate marks every node in the tree dirty, so that the next placement
+// moves every client. It should be called when clients may have been moved
+// behind the tree's back, or when something changed that affects the
+// geometry of the whole tree, like the gaps or the minimum leaf size.
+func (t *tree) invalidate() {
+	if t.child == nil {
+		return
+	}
+	var walk func(n node)
+	walk = func(n node) {
+		n.cache().dirty = true
+		if s := asSplit(n); s != nil {
+			for _, child := range s.children {
+				walk(child)
+			}
+		} else if st, ok := n.(*stack); ok {
+			for _, lf := range st.leaves {
+				walk(lf)
+			}
+		} else if g, ok := n.(*grid); ok {
+			g.VisitLeafNodes(func(lf *leaf) bool {
+				walk(lf)
+				return true
+			})
+		}
+	}
+	walk(t.child)
+}
+
+// moveNode gives n the geometry r, unless n isn't dirty and already has that
+// geometry (and so do all of its leaves), in which case nothing in n needs to
+// move. The geometries of the skipped clients are still recorded as drawn.
+// The cache isn't trusted while a mutation is running, since mutations change
+// the tree in ways that don't mark anything dirty.
+func (t *tree) moveNode(n node, r xrect.Rect) {
+	c := n.cache()
+	cached := !t.mutating && !c.dirty && sameRect(c.rect, r) &&
+		n.VisitLeafNodes(func(lf *leaf) bool {
+			return lf.rect != nil
+		})
+	if cached {
+		n.VisitLeafNodes(func(lf *leaf) bool {
+			t.drawn[lf.client] = lf.fit(lf.rect)
+			return true
+		})
+		return
+	}
+	n.MoveResize(t, r.X(), r.Y(), r.Width(), r.Height())
+	c.rect, c.dirty = r, false
+}
+
+// sameRect returns true if r1 and r2 are both set and have the same geometry.
+func sameRect(r1, r2 xrect.Rect) bool {
+	if r1 == nil || r2 == nil {
+		return false
+	}
+	return r1.X() == r2.X() && r1.Y() == r2.Y() &&
+		r1.Width() == r2.Width() && r1.Height() == r2.Height()
+}
@@ -0,0 +1,99 @@
+package layout
+
+import (
+	"testing"
+
+	"github.com/BurntSushi/xgbutil/xrect"
+)
+
+// masterStackOf returns a master/stack tree of n clients, the first of which
+// is the master.
+func masterStackOf(n int) (*tree, []*fakeClient) {
+	cs := newFakes(n)
+	stacked := make([]Client, 0, n-1)
+	for _, c := range cs[1:] {
+		stacked = append(stacked, c)
+	}
+	return newMasterStack(cs[0], stacked), cs
+}
+
+func TestGeomCache(t *testing.T) {
+	tr, cs := masterStackOf(5)
+	base := xrect.New(0, 0, 100, 100)
+	tr.place(base)
+	moves(cs)
+
+	tr.place(base)
+	if got := moves(cs); got != 0 || len(tr.drawn) != len(cs) {
+		t.Fatalf("Placing the tree again made %d moves.", got)
+	}
+
+	// Resizing the stack column moves the master and the whole stack.
+	tr.stackCol.Parent().(*hsplit).SetChildProportion(tr.stackCol, 0.6)
+	tr.place(base)
+	if got := moves(cs); got != 5 || cs[0].w != 40 {
+		t.Fatalf("Resizing the columns made %d moves, and the master is "+
+			"%d wide.", got, cs[0].w)
+	}
+
+	// Only the two leaves move when their clients are switched.
+	tr.switchClients(tr.findLeaf(cs[1]), tr.findLeaf(cs[2]))
+	tr.place(base)
+	if got := moves(cs); got != 2 || cs[1].y != 25 || cs[2].y != 0 {
+		t.Fatalf("Switching two clients made %d moves.", got)
+	}
+
+	tr.place(xrect.New(0, 0, 200, 100))
+	if got := moves(cs); got != 5 || cs[0].w != 80 {
+		t.Fatalf("Resizing the screen made %d moves.", got)
+	}
+	tr.SetGaps(2, 0)
+	tr.replace()
+	if got := moves(cs); got != 5 {
+		t.Fatalf("Changing the gaps made %d moves.", got)
+	}
+}
+
+// benchmarkPlace reports how many times the clients of a tree of 50 clients
+// are moved each time that place is called on it again.
+func benchmarkPlace(b *testing.B, place func(tr *tree, base xrect.Rect)) {
+	tr, cs := masterStackOf(50)
+	base := xrect.New(0, 0, 1920, 1080)
+	tr.place(base)
+	moves(cs)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		place(tr, base)
+	}
+	b.ReportMetric(float64(moves(cs))/float64(b.N), "moves/op")
+}
+
+func BenchmarkPlaceNoop(b *testing.B) {
+	benchmarkPlace(b, func(tr *tree, base xrect.Rect) {
+		tr.place(base)
+	})
+}
+
+func BenchmarkPlaceForce(b *testing.B) {
+	benchmarkPlace(b, func(tr *tree, base xrect.Rect) {
+		tr.placeForce(base)
+	})
+}
+
+// BenchmarkVerthorzPlace is BenchmarkPlaceNoop for the layout that the
+// window manager uses.
+func BenchmarkVerthorzPlace(b *testing.B) {
+	lay := NewVertical()
+	lay.SetGeom(xrect.New(0, 0, 1920, 1080))
+	cs := newFakes(50)
+	for _, c := range cs {
+		lay.Add(c)
+	}
+	lay.Place()
+	moves(cs)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lay.Place()
+	}
+	b.ReportMetric(float64(moves(cs))/float64(b.N), "moves/op")
+}
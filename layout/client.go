@@ -3,6 +3,7 @@ package layout
 import (
 	"github.com/BurntSushi/xgb/xproto"
 
+	"github.com/BurntSushi/xgbutil/icccm"
 	"github.com/BurntSushi/xgbutil/xrect"
 )
 
@@ -15,13 +16,19 @@ import (
 type Client interface {
 	Id() xproto.Window
 	String() string
+	Class() *icccm.WmClass
 	Layout() Layout
 	Geom() xrect.Rect
 	DragGeom() xrect.Rect
+	MinSize() (width, height int)
+	MaxSize() (width, height int)
+	AspectRatio() (num, den int, ok bool)
 	ShouldForceFloating() bool
 	Focus()
 	Raise()
 	IsActive() bool
+	Map()
+	Unmap()
 
 	MROpt(validate bool, flags, x, y, width, height int)
 	MoveResize(x, y, width, height int)
@@ -30,6 +37,7 @@ type Client interface {
 	Resize(validate bool, width, height int)
 
 	FrameTile()
+	FrameInsets() (top, right, bottom, left int)
 
 	HasState(name string) bool
 	SaveState(name string)
@@ -0,0 +1,130 @@
+package layout
+
+import (
+	"fmt"
+
+	"github.com/BurntSushi/xgb/xproto"
+
+	"github.com/BurntSushi/xgbutil/icccm"
+	"github.com/BurntSushi/xgbutil/xrect"
+)
+
+// fakeClient is the Client that every test uses. It remembers the geometry
+// it was last given and how many times it was moved, and its size hints,
+// class and frame are whatever a test sets them to.
+type fakeClient struct {
+	id         int
+	x, y, w, h int
+	moves      int
+	active     bool
+	unmapped   bool
+	minw, minh int
+	maxw, maxh int
+	anum, aden int
+	class      string
+	title      string
+
+	// insets are the sizes of the top, right, bottom and left of the frame.
+	insets [4]int
+}
+
+func newFake(id int) *fakeClient {
+	return &fakeClient{id: id}
+}
+
+// newFakes returns n fake clients with the ids 1 to n.
+func newFakes(n int) []*fakeClient {
+	cs := make([]*fakeClient, n)
+	for i := range cs {
+		cs[i] = newFake(i + 1)
+	}
+	return cs
+}
+
+func (c *fakeClient) Id() xproto.Window {
+	return xproto.Window(c.id)
+}
+
+func (c *fakeClient) String() string {
+	if c.title != "" {
+		return c.title
+	}
+	return fmt.Sprintf("c%d", c.id)
+}
+
+func (c *fakeClient) Class() *icccm.WmClass {
+	return &icccm.WmClass{Instance: c.class, Class: c.class}
+}
+
+func (c *fakeClient) Layout() Layout {
+	return nil
+}
+
+func (c *fakeClient) Geom() xrect.Rect {
+	return xrect.New(c.x, c.y, c.w, c.h)
+}
+
+func (c *fakeClient) DragGeom() xrect.Rect {
+	return nil
+}
+
+func (c *fakeClient) MinSize() (width, height int) {
+	return c.minw, c.minh
+}
+
+func (c *fakeClient) MaxSize() (width, height int) {
+	return c.maxw, c.maxh
+}
+
+func (c *fakeClient) AspectRatio() (num, den int, ok bool) {
+	return c.anum, c.aden, c.anum > 0 && c.aden > 0
+}
+
+func (c *fakeClient) ShouldForceFloating() bool {
+	return false
+}
+
+func (c *fakeClient) Focus() {}
+func (c *fakeClient) Raise() {}
+
+func (c *fakeClient) IsActive() bool {
+	return c.active
+}
+
+func (c *fakeClient) Map() {
+	c.unmapped = false
+}
+
+func (c *fakeClient) Unmap() {
+	c.unmapped = true
+}
+
+func (c *fakeClient) MROpt(validate bool, flags, x, y, width, height int) {}
+
+func (c *fakeClient) MoveResize(x, y, width, height int) {
+	c.x, c.y, c.w, c.h = x, y, width, height
+	c.moves++
+}
+
+func (c *fakeClient) MoveResizeValid(x, y, width, height int) {}
+func (c *fakeClient) Move(x, y int)                           {}
+func (c *fakeClient) Resize(validate bool, width, height int) {}
+func (c *fakeClient) FrameTile()                              {}
+
+func (c *fakeClient) FrameInsets() (top, right, bottom, left int) {
+	return c.insets[0], c.insets[1], c.insets[2], c.insets[3]
+}
+
+func (c *fakeClient) HasState(name string) bool {
+	return false
+}
+
+func (c *fakeClient) SaveState(name string)   {}
+func (c *fakeClient) LoadState(name string)   {}
+func (c *fakeClient) DeleteState(name string) {}
+
+// geomString formats the geometry that c was last given, for comparing it in
+// tests.
+func (c *fakeClient) geomString() string {
+	return fmt.Sprintf("%d,%d %dx%d", c.x, c.y, c.w, c.h)
+}
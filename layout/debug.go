@@ -0,0 +1,317 @@
+package layout
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/BurntSushi/xgbutil/xrect"
+)
+
+// maxStringDepth bounds how deep nodeString will recurse, so that a
+// malformed tree can't make it recurse forever.
+const maxStringDepth = 64
+
+// dump returns an indented description of the whole tree: the orientation
+// and proportion of every split, and the client and proportion of every
+// leaf. Children are listed in the order in which they are placed.
+// This is for debugging only.
+func (t *tree) dump() string {
+	if t.child == nil {
+		return "empty tree"
+	}
+	return nodeString(t, t.child, nil, 0, make(map[node]bool))
+}
+
+// dumpWithGeom is like dump, but also includes the geometry that each node
+// would be given if the tree were placed in geom.
+func (t *tree) dumpWithGeom(geom xrect.Rect) string {
+	if t.child == nil {
+		return "empty tree"
+	}
+	x, y, w, h := t.inset(geom)
+	return nodeString(t, t.child, xrect.New(x, y, w, h), 0,
+		make(map[node]bool))
+}
+
+// nodeString returns a description of n and, if n is a split, all of its
+// descendents on subsequent lines, indented by depth. If geom is not nil,
+// it is the geometry of n and the geometry of every node is included (t
+// must not be nil in this case).
+//
+// seen records the splits already described so that cycles in a malformed
+// tree are reported rather than followed.
+func nodeString(t *tree, n node, geom xrect.Rect, depth int,
+	seen map[node]bool) string {
+
+	indent := strings.Repeat("  ", depth)
+	suffix := ""
+	if geom != nil {
+		suffix = " at " + rectString(geom)
+	}
+
+	if st, ok := n.(*stack); ok {
+		lines := []string{indent + st.String() + suffix}
+		for _, lf := range st.leaves {
+			lines = append(lines, nodeString(t, lf, geom, depth+1, seen))
+		}
+		return strings.Join(lines, "\n")
+	}
+
+	if g, ok := n.(*grid); ok {
+		var rects []xrect.Rect
+		if geom != nil {
+			rects = g.childRects(t,
+				geom.X(), geom.Y(), geom.Width(), geom.Height())
+		}
+		lines := []string{indent + g.String() + suffix}
+		g.each(func(r, c int, lf *leaf) bool {
+			var cellGeom xrect.Rect
+			if rects != nil {
+				cellGeom, rects = rects[0], rects[1:]
+			}
+			lines = append(lines, fmt.Sprintf("%s  (%d, %d) %s", indent,
+				r, c, strings.TrimLeft(
+					nodeString(t, lf, cellGeom, 0, seen), " ")))
+			return true
+		})
+		return strings.Join(lines, "\n")
+	}
+
+	s := asSplit(n)
+	if s == nil {
+		return indent + n.String() + suffix
+	}
+
+	orient := "vsplit"
+	if isHorizontal(n) {
+		orient = "hsplit"
+	}
+	header := fmt.Sprintf("%s%s with %d children [%f]%s",
+		indent, orient, len(s.children), s.prop, suffix)
+	if seen[n] || depth >= maxStringDepth {
+		return header + " (cycle or too deep)"
+	}
+	seen[n] = true
+
+	var rects []xrect.Rect
+	if geom != nil {
+		rects = childRects(t, n,
+			geom.X(), geom.Y(), geom.Width(), geom.Height())
+	}
+	lines := []string{header}
+	for i, child := range s.children {
+		var childGeom xrect.Rect
+		if rects != nil {
+			childGeom = rects[i]
+		}
+		lines = append(lines,
+			nodeString(t, child, childGeom, depth+1, seen))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// validate checks the integrity of the tree and returns an error for every
+// problem that it finds: a client that is in more than one leaf (or both
+// tiled and floating), a child whose parent isn't the split or stack that
+// contains it, a split whose proportions don't add up to fullPortion, and a
+// split that is reached twice. An empty slice means that the tree is sound.
+// This is for debugging only.
+func (t *tree) validate() []error {
+	errs := make([]error, 0)
+	if t.child == nil {
+		return errs
+	}
+	if t.child.Parent() != nil {
+		errs = append(errs, fmt.Errorf("The root '%s' has the parent '%s'.",
+			t.child, t.child.Parent()))
+	}
+
+	owners := make(map[Client]*leaf)
+	seen := make(map[node]bool)
+	var walk func(n node)
+	walk = func(n node) {
+		if seen[n] {
+			errs = append(errs, fmt.Errorf("The node '%s' is in the tree "+
+				"more than once.", n))
+			return
+		}
+		seen[n] = true
+
+		var children []node
+		switch n := n.(type) {
+		case *leaf:
+			if other, ok := owners[n.client]; ok {
+				errs = append(errs, fmt.Errorf("Client '%s' is in both "+
+					"'%s' and '%s'.", n.client, other, n))
+			}
+			owners[n.client] = n
+			return
+		case *stack:
+			for _, lf := range n.leaves {
+				children = append(children, lf)
+			}
+		case *grid:
+			n.VisitLeafNodes(func(lf *leaf) bool {
+				children = append(children, lf)
+				return true
+			})
+		default:
+			s := asSplit(n)
+			if s == nil {
+				errs = append(errs, fmt.Errorf("Unknown node type %T.", n))
+				return
+			}
+			children = s.children
+			sum := proportion(0)
+			for _, child := range children {
+				sum += child.Proportion()
+			}
+			if len(children) > 0 && !sum.Equal(fullPortion) {
+				errs = append(errs, fmt.Errorf("The proportions of the "+
+					"children of '%s' add up to %f.", n, sum))
+			}
+		}
+		for _, child := range children {
+			if child.Parent() != n {
+				errs = append(errs, fmt.Errorf("The parent of '%s' is '%s' "+
+					"instead of '%s'.", child, child.Parent(), n))
+			}
+			walk(child)
+		}
+	}
+	walk(t.child)
+
+	for _, c := range t.floating {
+		if lf, ok := owners[c]; ok {
+			errs = append(errs, fmt.Errorf("Client '%s' is floating, but it "+
+				"is also in '%s'.", c, lf))
+		}
+	}
+	return errs
+}
+
+// checkNoOverlap checks the tiles that the tree would have if it were placed
+// in base: no two tiles may overlap, and at every split the children must
+// cover the split exactly, with the inner gap between them and nothing else.
+// Since the root is given base less the outer gap and any struts, the tiles
+// then cover all of that with only gap-sized spacing. A tile is the cell of
+// a leaf, or of a whole stack, before size hints shrink its client. The
+// cells of a grid are only checked for overlap, since they can be empty, and
+// children that a split has scrolled out of view are skipped. The error
+// names the pair of clients that overlap, or else the first child whose
+// tile is out of place.
+// This is for debugging only, since it compares every pair of tiles.
+func (t *tree) checkNoOverlap(base xrect.Rect) error {
+	if t.child == nil || base == nil {
+		return nil
+	}
+	x, y, w, h := t.inset(base)
+	if w <= 0 || h <= 0 {
+		return nil
+	}
+	if _, bad := t.child.validDimsReason(t, w, h, 1, 1, w, h); bad != nil {
+		return nil
+	}
+
+	type tile struct {
+		client Client
+		r      xrect.Rect
+	}
+	var tiles []tile
+	var spanErr error
+	var walk func(n node, cell xrect.Rect)
+	walk = func(n node, cell xrect.Rect) {
+		switch n := n.(type) {
+		case *leaf:
+			tiles = append(tiles, tile{n.client, cell})
+			return
+		case *stack:
+			if lf := n.activeLeaf(); lf != nil {
+				tiles = append(tiles, tile{lf.client, cell})
+			}
+			return
+		}
+		s, ok := n.(splitter)
+		if !ok {
+			return
+		}
+		rects := childRects(t, n, cell.X(), cell.Y(),
+			cell.Width(), cell.Height())
+		if asSplit(n) != nil && spanErr == nil {
+			spanErr = checkSpans(t, n, cell, rects)
+		}
+		for i, r := range rects {
+			if !outside(r, cell) {
+				walk(s.Child(i), r)
+			}
+		}
+	}
+	walk(t.child, xrect.New(x, y, w, h))
+
+	for i := range tiles {
+		for j := i + 1; j < len(tiles); j++ {
+			if overlaps(tiles[i].r, tiles[j].r) {
+				return fmt.Errorf("Clients '%s' at %s and '%s' at %s "+
+					"overlap.", tiles[i].client, rectString(tiles[i].r),
+					tiles[j].client, rectString(tiles[j].r))
+			}
+		}
+	}
+	return spanErr
+}
+
+// checkSpans checks that rects, the geometries of the children of the split
+// n placed in cell, span the whole width (for an hsplit) or height of cell
+// with exactly one gap between neighbors, and the whole of the other axis.
+// Children outside of cell (because n scrolls) are left out.
+func checkSpans(t *tree, n node, cell xrect.Rect,
+	rects []xrect.Rect) error {
+
+	horizontal := isHorizontal(n)
+	axis := func(r xrect.Rect) (start, length, crossStart, cross int) {
+		if horizontal {
+			return r.X(), r.Width(), r.Y(), r.Height()
+		}
+		return r.Y(), r.Height(), r.X(), r.Width()
+	}
+	start, length, crossStart, cross := axis(cell)
+	next, last, s := start, -1, asSplit(n)
+	for i, r := range rects {
+		if outside(r, cell) {
+			continue
+		}
+		rs, rl, rcs, rc := axis(r)
+		if rcs != crossStart || rc != cross {
+			return fmt.Errorf("The child '%s' at %s does not span '%s' "+
+				"at %s.", s.Child(i), rectString(r), s, rectString(cell))
+		}
+		if rs != next {
+			what := "the start of"
+			if last >= 0 {
+				what = fmt.Sprintf("a gap of %d pixels after '%s' in",
+					t.gap(), s.Child(last))
+			}
+			return fmt.Errorf("The child '%s' at %s is not at %s '%s' "+
+				"at %s.", s.Child(i), rectString(r), what, s,
+				rectString(cell))
+		}
+		next, last = rs+rl+t.gap(), i
+	}
+	if last >= 0 && next-t.gap() != start+length {
+		return fmt.Errorf("The child '%s' at %s does not reach the end of "+
+			"'%s' at %s.", s.Child(last), rectString(rects[last]), s,
+			rectString(cell))
+	}
+	return nil
+}
+
+// overlaps returns whether r1 and r2 share any pixels.
+func overlaps(r1, r2 xrect.Rect) bool {
+	return r1.X() < r2.X()+r2.Width() && r2.X() < r1.X()+r1.Width() &&
+		r1.Y() < r2.Y()+r2.Height() && r2.Y() < r1.Y()+r1.Height()
+}
+
+// rectString formats r as its position and size.
+func rectString(r xrect.Rect) string {
+	return fmt.Sprintf("(%d, %d) %dx%d", r.X(), r.Y(), r.Width(), r.Height())
+}
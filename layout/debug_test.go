@@ -0,0 +1,130 @@
+package layout
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/BurntSushi/xgbutil/xrect"
+)
+
+// TestNoOverlapFuzz makes random changes to trees with random gaps and
+// struts, and checks the trees and their tiles after every change.
+func TestNoOverlapFuzz(t *testing.T) {
+	rng := rand.New(rand.NewSource(100))
+	for round := 0; round < 30; round++ {
+		tr := newTree()
+		tr.innerGap, tr.outerGap = rng.Intn(12), rng.Intn(12)
+		tr.setStruts(rng.Intn(30), 0, rng.Intn(30), rng.Intn(30))
+		tr.scrollOverflow = round%2 == 0
+		base := xrect.New(0, 0, 1200+rng.Intn(800), 900+rng.Intn(300))
+
+		var cs []Client
+		next := func() *fakeClient {
+			return newFake(round*1000 + len(cs) + 1)
+		}
+		for op := 0; op < 80; op++ {
+			var c Client
+			if len(cs) > 0 {
+				c = cs[rng.Intn(len(cs))]
+			}
+			dir := direction(rng.Intn(4))
+			switch k := rng.Intn(8); {
+			case k <= 1 || len(cs) < 2:
+				added := next()
+				if err := tr.addAuto(added); err != nil {
+					t.Fatal(err)
+				}
+				cs = append(cs, added)
+			case k == 2:
+				if added := next(); tr.splitLeaf(c, dir, added) == nil {
+					cs = append(cs, added)
+				}
+			case k == 3 && len(cs) > 2:
+				i := rng.Intn(len(cs))
+				if err := tr.removeClient(cs[i]); err != nil {
+					t.Fatal(err)
+				}
+				cs = append(cs[:i], cs[i+1:]...)
+			case k == 4:
+				tr.balance()
+			case k == 5:
+				tr.moveClient(c, dir)
+			case k == 6:
+				tr.zoom(c)
+			default:
+				tr.resizeLeaf(c, dir, proportion(rng.Float64()*0.2))
+			}
+			checkValid(t, tr)
+			if err := tr.checkNoOverlap(base); err != nil {
+				t.Fatalf("After change %d of round %d: %s\n%s",
+					op, round, err, tr.dumpWithGeom(base))
+			}
+		}
+	}
+}
+
+func TestNoOverlapDetects(t *testing.T) {
+	cs := newFakes(3)
+	tr := autoTree(t, cs[:2])
+	base := xrect.New(0, 0, 1000, 600)
+	for _, gap := range []int{5, 0} {
+		tr.innerGap = gap
+		if err := tr.checkNoOverlap(base); err != nil {
+			t.Fatalf("With a gap of %d: %s", gap, err)
+		}
+	}
+
+	// Children that don't fit are folded into one cell, where they overlap.
+	tr.minLeafPx = 400
+	if err := tr.addAuto(cs[2]); err != nil {
+		t.Fatal(err)
+	}
+	err := tr.checkNoOverlap(base)
+	if err == nil || !strings.Contains(err.Error(), "overlap") {
+		t.Fatalf("The overlap was not detected, but got %v.\n%s",
+			err, tr.dumpWithGeom(base))
+	}
+	named := 0
+	for _, c := range cs {
+		if strings.Contains(err.Error(), "'"+c.String()+"'") {
+			named++
+		}
+	}
+	if named != 2 {
+		t.Fatalf("The error doesn't name the two clients: %s", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(tr *tree, cs []*fakeClient)
+		want    string
+	}{
+		{"twice", func(tr *tree, cs []*fakeClient) {
+			tr.findLeaf(cs[2]).client = cs[0]
+		}, "Client 'c1' is in both"},
+		{"parent", func(tr *tree, cs []*fakeClient) {
+			tr.findLeaf(cs[1]).SetParent(nil)
+		}, "The parent of 'leaf with client 'c2'"},
+		{"floating", func(tr *tree, cs []*fakeClient) {
+			tr.floating = append(tr.floating, cs[1])
+		}, "'c2'"},
+		{"proportions", func(tr *tree, cs []*fakeClient) {
+			tr.findLeaf(cs[1]).SetProportion(0.9)
+		}, "add up to 1.400000"},
+	}
+	for _, test := range tests {
+		tr, cs := masterStackOf(3)
+		if errs := tr.validate(); len(errs) != 0 {
+			t.Fatalf("%s: A sound tree has the errors %v.", test.name, errs)
+		}
+		test.corrupt(tr, cs)
+		errs := tr.validate()
+		if len(errs) != 1 || !strings.Contains(errs[0].Error(), test.want) {
+			t.Errorf("%s: Got the errors %v instead of one about %s.",
+				test.name, errs, test.want)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package layout
+
+import (
+	"math"
+
+	"github.com/BurntSushi/xgbutil/xrect"
+
+	"github.com/cshapeshifter/wingo/misc"
+)
+
+// dropZone is the part of a tile that a window is dropped on when it is
+// dragged with the mouse, which decides what happens to it: dropping it on
+// an edge splits the tile on that side, and dropping it in the center stacks
+// or swaps it with the tile's client.
+type dropZone int
+
+const (
+	zoneNone dropZone = iota
+	zoneCenter
+	zoneLeft
+	zoneRight
+	zoneTop
+	zoneBottom
+)
+
+// defaultDropCenter is the default fraction of the width and height of a
+// tile that is its center zone.
+const defaultDropCenter proportion = 0.5
+
+// SetDropCenter sets the fraction of the width and height of a tile that
+// dropTarget treats as its center. The rest of the tile is divided among its
+// four edges. The fraction is clamped to [0, 1].
+func (t *tree) SetDropCenter(fraction float64) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.dropCenter = proportion(math.Max(0, math.Min(1, fraction)))
+}
+
+// dropTarget returns the client of the tile containing the point (x, y) if
+// the tree were placed in base, along with the zone of the tile that the
+// point is in. Only tiles that can be seen count, so a stack is represented
+// by the tab that it shows. (nil, zoneNone) is returned if the point isn't
+// in any tile, or if the tree cannot be placed in base.
+func (t *tree) dropTarget(base xrect.Rect, x, y int) (Client, dropZone) {
+	if t.child == nil || base == nil {
+		return nil, zoneNone
+	}
+	bx, by, bw, bh := t.inset(base)
+	if bw <= 0 || bh <= 0 {
+		return nil, zoneNone
+	}
+	if _, bad := t.child.validDimsReason(t, bw, bh, 1, 1, bw, bh); bad != nil {
+		return nil, zoneNone
+	}
+
+	n, cell := t.child, xrect.Rect(xrect.New(bx, by, bw, bh))
+	for {
+		if !contains(cell, x, y) {
+			return nil, zoneNone
+		}
+		if c, ok := n.activeClient(); ok {
+			return c, t.zoneOf(cell, x, y)
+		}
+		s, ok := n.(splitter)
+		if !ok {
+			return nil, zoneNone
+		}
+		rects := childRects(t, n,
+			cell.X(), cell.Y(), cell.Width(), cell.Height())
+		next := -1
+		for i, r := range rects {
+			if !outside(r, cell) && contains(r, x, y) {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			// The point is in a gap between tiles.
+			return nil, zoneNone
+		}
+		n, cell = s.Child(next), rects[next]
+	}
+}
+
+// leafAt returns the leaf whose tile contains the point (x, y) if the tree
+// were placed in base. Unlike dropTarget, a point in a gap between tiles (or
+// outside of them altogether) gives the nearest tile instead of nothing: at
+// every split, the child whose cell is nearest to the point is descended
+// into. A stack is represented by the leaf of the tab that it shows. nil is
+// returned if the tree is empty or base is nil.
+func (t *tree) leafAt(base xrect.Rect, x, y int) *leaf {
+	if t.child == nil || base == nil {
+		return nil
+	}
+	bx, by, bw, bh := t.inset(base)
+	n, cell := t.child, xrect.Rect(xrect.New(bx, by, bw, bh))
+	for {
+		switch n := n.(type) {
+		case *leaf:
+			return n
+		case *stack:
+			return n.activeLeaf()
+		}
+		s, ok := n.(splitter)
+		if !ok {
+			return nil
+		}
+		rects := childRects(t, n,
+			cell.X(), cell.Y(), cell.Width(), cell.Height())
+		next, nearest := -1, 0
+		for i, r := range rects {
+			if outside(r, cell) {
+				// Scrolled out of view.
+				continue
+			}
+			if d := distanceSq(r, x, y); next < 0 || d < nearest {
+				next, nearest = i, d
+			}
+		}
+		if next < 0 {
+			return nil
+		}
+		n, cell = s.Child(next), rects[next]
+	}
+}
+
+// distanceSq returns the square of the distance from the point (x, y) to the
+// nearest pixel of r, which is zero if r contains the point.
+func distanceSq(r xrect.Rect, x, y int) int {
+	dx := misc.Max(0, misc.Max(r.X()-x, x-(r.X()+r.Width()-1)))
+	dy := misc.Max(0, misc.Max(r.Y()-y, y-(r.Y()+r.Height()-1)))
+	return dx*dx + dy*dy
+}
+
+// zoneOf returns the zone of the tile cell that the point (x, y) is in. The
+// point is in the center zone if it is in the middle dropCenter of the tile
+// both horizontally and vertically, and in the zone of the nearest edge
+// otherwise.
+func (t *tree) zoneOf(cell xrect.Rect, x, y int) dropZone {
+	fx := float64(x-cell.X()) / float64(cell.Width())
+	fy := float64(y-cell.Y()) / float64(cell.Height())
+	margin := (1 - float64(t.dropCenter)) / 2
+	if fx >= margin && fx <= 1-margin && fy >= margin && fy <= 1-margin {
+		return zoneCenter
+	}
+
+	zone, nearest := zoneLeft, fx
+	if 1-fx < nearest {
+		zone, nearest = zoneRight, 1-fx
+	}
+	if fy < nearest {
+		zone, nearest = zoneTop, fy
+	}
+	if 1-fy < nearest {
+		zone = zoneBottom
+	}
+	return zone
+}
+
+// contains returns true if the point (x, y) is in r.
+func contains(r xrect.Rect, x, y int) bool {
+	return x >= r.X() && x < r.X()+r.Width() &&
+		y >= r.Y() && y < r.Y()+r.Height()
+}
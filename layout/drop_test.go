@@ -0,0 +1,65 @@
+package layout
+
+import (
+	"testing"
+
+	"github.com/BurntSushi/xgbutil/xrect"
+)
+
+func TestLeafAt(t *testing.T) {
+	// c1 beside c2 above c3. The tiles are inside 10..200 on both axes, and
+	// the gap between c1 and the others is 100..110, as is the gap between
+	// c2 and c3.
+	cs := newFakes(3)
+	tr := rowOf(cs[0], cs[1])
+	if err := tr.splitLeaf(cs[1], dirDown, cs[2]); err != nil {
+		t.Fatal(err)
+	}
+	tr.SetGaps(10, 10)
+	base := xrect.New(0, 0, 210, 210)
+	tests := []struct {
+		name string
+		x, y int
+		want *fakeClient
+	}{
+		{"inside c1", 50, 50, cs[0]},
+		{"inside c2", 150, 50, cs[1]},
+		{"inside c3", 150, 150, cs[2]},
+		{"column gap near c1", 104, 50, cs[0]},
+		{"column gap near c2", 106, 50, cs[1]},
+		{"row gap near c2", 150, 104, cs[1]},
+		{"row gap near c3", 150, 106, cs[2]},
+		{"outer gap top left", 0, 0, cs[0]},
+		{"outer gap bottom right", 209, 209, cs[2]},
+		{"off the bottom left", -100, 500, cs[0]},
+		{"off the top right", 500, -100, cs[1]},
+	}
+	for _, test := range tests {
+		lf := tr.leafAt(base, test.x, test.y)
+		if lf == nil || lf.client != Client(test.want) {
+			t.Errorf("%s: (%d, %d) is in %v instead of '%s'.",
+				test.name, test.x, test.y, lf, test.want)
+		}
+	}
+
+	// The tiles are where the test thinks they are.
+	tr.place(base)
+	want := []string{"10,10 90x190", "110,10 90x90", "110,110 90x90"}
+	for i, c := range cs {
+		if got := c.geomString(); got != want[i] {
+			t.Fatalf("'%s' is at %s instead of %s.", c, got, want[i])
+		}
+	}
+
+	// A stack gives the tab that it shows.
+	tab := newFake(4)
+	if err := tr.stackWith(cs[1], tab); err != nil {
+		t.Fatal(err)
+	}
+	if lf := tr.leafAt(base, 150, 50); lf == nil || lf.client != tab {
+		t.Fatalf("(150, 50) is in %v instead of '%s'.", lf, tab)
+	}
+	if lf := newTree().leafAt(base, 0, 0); lf != nil {
+		t.Fatalf("An empty tree has %v at (0, 0).", lf)
+	}
+}
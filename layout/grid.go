@@ -0,0 +1,393 @@
+package layout
+
+import (
+	"fmt"
+
+	"github.com/BurntSushi/xgbutil/xrect"
+
+	"github.com/cshapeshifter/wingo/logger"
+	"github.com/cshapeshifter/wingo/misc"
+)
+
+// grid is a node that lays out leaves in a fixed number of rows and columns,
+// which nested splits can't do: every cell of a column has the same width,
+// and every cell of a row has the same height, so the gaps line up all the
+// way across. The rows and columns are equally sized unless they are given
+// weights. A cell can be empty, in which case its space is left unused.
+//
+// A grid implements splitter so that its leaves can use it as their parent,
+// but it is not a split: asSplit returns nil for a grid, and the proportions
+// of its leaves are meaningless. Its children are its leaves in row-major
+// order, skipping the empty cells.
+type grid struct {
+	geomCache
+
+	parent     node
+	cells      [][]*leaf
+	rowProps   []proportion
+	colProps   []proportion
+	prop       proportion
+	rows, cols int
+
+	// fixedPx is the number of pixels that the grid is given along the axis
+	// of its parent, or zero if it shares the space proportionally.
+	fixedPx int
+}
+
+// newGrid creates an empty grid with the given number of rows and columns,
+// which are at least one each.
+func newGrid(rows, cols int) *grid {
+	rows, cols = misc.Max(1, rows), misc.Max(1, cols)
+	g := &grid{
+		rows:     rows,
+		cols:     cols,
+		cells:    make([][]*leaf, rows),
+		rowProps: ProportionFromWeights(make([]int, rows)),
+		colProps: ProportionFromWeights(make([]int, cols)),
+	}
+	for r := range g.cells {
+		g.cells[r] = make([]*leaf, cols)
+	}
+	return g
+}
+
+// setCell puts client in the cell in row r and column c, replacing whatever
+// was there. A nil client empties the cell. A warning is logged if the cell
+// isn't in the grid.
+func (g *grid) setCell(r, c int, client Client) {
+	if r < 0 || r >= g.rows || c < 0 || c >= g.cols {
+		logger.Warning.Printf("There is no cell (%d, %d) in the %dx%d "+
+			"grid '%s'.", r, c, g.rows, g.cols, g)
+		return
+	}
+	if old := g.cells[r][c]; old != nil {
+		old.SetParent(nil)
+	}
+	g.cells[r][c] = nil
+	if client != nil {
+		lf := newLeaf(g, client)
+		lf.SetProportion(fullPortion)
+		g.cells[r][c] = lf
+	}
+	markDirty(g)
+}
+
+// cell returns the leaf in row r and column c, or nil if the cell is empty
+// or isn't in the grid.
+func (g *grid) cell(r, c int) *leaf {
+	if r < 0 || r >= g.rows || c < 0 || c >= g.cols {
+		return nil
+	}
+	return g.cells[r][c]
+}
+
+// setRowWeights sizes the rows in the ratio of weights, like setWeights does
+// for the children of a split.
+func (g *grid) setRowWeights(weights []int) error {
+	props, err := gridWeights(weights, g.rows, "rows")
+	if err != nil {
+		return err
+	}
+	g.rowProps = props
+	markDirty(g)
+	return nil
+}
+
+// setColWeights sizes the columns in the ratio of weights, like setWeights
+// does for the children of a split.
+func (g *grid) setColWeights(weights []int) error {
+	props, err := gridWeights(weights, g.cols, "columns")
+	if err != nil {
+		return err
+	}
+	g.colProps = props
+	markDirty(g)
+	return nil
+}
+
+func gridWeights(weights []int, count int, what string) ([]proportion,
+	error) {
+
+	if len(weights) != count {
+		return nil, fmt.Errorf("Cannot apply %d weights to a grid with %d "+
+			"%s.", len(weights), count, what)
+	}
+	for _, w := range weights {
+		if w <= 0 {
+			return nil, fmt.Errorf("Weights must be positive, but got %d.",
+				w)
+		}
+	}
+	return ProportionFromWeights(weights), nil
+}
+
+// each calls f on every leaf in the grid with its row and column, in
+// row-major order, until f returns false. It returns false if it was
+// stopped.
+func (g *grid) each(f func(r, c int, lf *leaf) bool) bool {
+	for r, row := range g.cells {
+		for c, lf := range row {
+			if lf != nil && !f(r, c, lf) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// mins returns the minimum width of each column and the minimum height of
+// each row, which are the largest minimums of the leaves in them.
+func (g *grid) mins(t *tree) (colMins, rowMins []int) {
+	colMins, rowMins = make([]int, g.cols), make([]int, g.rows)
+	g.each(func(r, c int, lf *leaf) bool {
+		w, h := lf.MinSize(t)
+		colMins[c] = misc.Max(colMins[c], w)
+		rowMins[r] = misc.Max(rowMins[r], h)
+		return true
+	})
+	return
+}
+
+// spans divides width among the columns and height among the rows with
+// divide, like split.spans does for the children of a split. ok is false if
+// the minimums of the leaves can't all be satisfied.
+func (g *grid) spans(t *tree, width, height int) (xs, ws, ys, hs []int,
+	ok bool) {
+
+	colMins, rowMins := g.mins(t)
+	ws, okw := divide(width, t.gap(), t.roundMode, g.colProps, colMins,
+		nil)
+	hs, okh := divide(height, t.gap(), t.roundMode, g.rowProps, rowMins,
+		nil)
+	offsets := func(lengths []int) []int {
+		next, out := 0, make([]int, len(lengths))
+		for i := range lengths {
+			out[i] = next
+			next += lengths[i] + t.gap()
+		}
+		return out
+	}
+	return offsets(ws), ws, offsets(hs), hs, okw && okh
+}
+
+func (g *grid) childRects(t *tree, x, y, width, height int) []xrect.Rect {
+	xs, ws, ys, hs, _ := g.spans(t, width, height)
+	rects := make([]xrect.Rect, 0, g.Size())
+	g.each(func(r, c int, lf *leaf) bool {
+		rects = append(rects, xrect.New(x+xs[c], y+ys[r], ws[c], hs[r]))
+		return true
+	})
+	return rects
+}
+
+func (g *grid) MoveResize(t *tree, x, y, width, height int) {
+	rects := g.childRects(t, x, y, width, height)
+	g.each(func(r, c int, lf *leaf) bool {
+		t.moveNode(lf, rects[0])
+		rects = rects[1:]
+		return true
+	})
+}
+
+func (g *grid) String() string {
+	return fmt.Sprintf("%dx%d grid with %d clients [%f]",
+		g.rows, g.cols, g.Size(), g.prop)
+}
+
+func (g *grid) Proportion() proportion {
+	return g.prop
+}
+
+func (g *grid) SetProportion(p proportion) {
+	g.prop = p
+	markDirty(g)
+}
+
+func (g *grid) FixedSize() int {
+	return g.fixedPx
+}
+
+func (g *grid) SetFixedSize(px int) {
+	g.fixedPx = px
+}
+
+func (g *grid) Parent() node {
+	return g.parent
+}
+
+func (g *grid) SetParent(n node) {
+	g.parent = n
+}
+
+func (g *grid) activeClient() (Client, bool) {
+	return nil, false
+}
+
+func (g *grid) ValidDims(t *tree, w, h, minw, minh, maxw, maxh int) bool {
+	_, lf := g.validDimsReason(t, w, h, minw, minh, maxw, maxh)
+	return lf == nil
+}
+
+// validDimsReason checks every cell with the width of its column and the
+// height of its row.
+func (g *grid) validDimsReason(t *tree,
+	w, h, minw, minh, maxw, maxh int) (bool, *leaf) {
+
+	_, ws, _, hs, ok := g.spans(t, w, h)
+	var small bool
+	var bad *leaf
+	g.each(func(r, c int, lf *leaf) bool {
+		small, bad = lf.validDimsReason(t, ws[c], hs[r],
+			minw, minh, maxw, maxh)
+		return bad == nil
+	})
+	if bad != nil {
+		return small, bad
+	}
+	if !ok {
+		return true, firstLeaf(g)
+	}
+	return false, nil
+}
+
+// MinSize for a grid is the sum of the minimum widths of its columns and the
+// sum of the minimum heights of its rows, plus the gaps between them.
+func (g *grid) MinSize(t *tree) (width, height int) {
+	colMins, rowMins := g.mins(t)
+	width, height = t.gap()*(g.cols-1), t.gap()*(g.rows-1)
+	for _, w := range colMins {
+		width += w
+	}
+	for _, h := range rowMins {
+		height += h
+	}
+	return
+}
+
+func (g *grid) VisitLeafNodes(f func(lf *leaf) bool) bool {
+	return g.each(func(r, c int, lf *leaf) bool {
+		return f(lf)
+	})
+}
+
+func (g *grid) VisitLeafNodesReverse(f func(lf *leaf) bool) bool {
+	for r := g.rows - 1; r >= 0; r-- {
+		for c := g.cols - 1; c >= 0; c-- {
+			if lf := g.cells[r][c]; lf != nil && !f(lf) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// AddNode puts a leaf in the first empty cell of the grid, or, if last is
+// true, in the first empty cell after the last leaf, so that it comes after
+// every other leaf. If there is no such cell, a row is added at the start
+// (or end) of the grid for it, which takes an even share of the height from
+// the others. It panics if n isn't a leaf, since a grid can only hold
+// leaves.
+func (g *grid) AddNode(n node, last bool) {
+	lf, ok := n.(*leaf)
+	if !ok {
+		panic(fmt.Sprintf("Only leaves can be put in a grid, not %T.", n))
+	}
+	lf.SetParent(g)
+	lf.SetProportion(fullPortion)
+	markDirty(g)
+
+	first := 0
+	if last {
+		g.each(func(r, c int, _ *leaf) bool {
+			first = r*g.cols + c + 1
+			return true
+		})
+	}
+	for cell := first; cell < g.rows*g.cols; cell++ {
+		if r, c := cell/g.cols, cell%g.cols; g.cells[r][c] == nil {
+			g.cells[r][c] = lf
+			return
+		}
+	}
+
+	g.rows++
+	share := fullPortion / proportion(g.rows)
+	for i := range g.rowProps {
+		g.rowProps[i] -= g.rowProps[i] * share
+	}
+	row := make([]*leaf, g.cols)
+	if last {
+		row[0] = lf
+		g.cells = append(g.cells, row)
+		g.rowProps = append(g.rowProps, share)
+	} else {
+		row[g.cols-1] = lf
+		g.cells = append([][]*leaf{row}, g.cells...)
+		g.rowProps = append([]proportion{share}, g.rowProps...)
+	}
+}
+
+// RemoveNode empties the cell of a leaf. The rows and columns of the grid
+// stay as they are.
+func (g *grid) RemoveNode(n node) error {
+	removed := !g.each(func(r, c int, lf *leaf) bool {
+		if lf != n {
+			return true
+		}
+		g.cells[r][c] = nil
+		return false
+	})
+	if !removed {
+		return fmt.Errorf("The node '%s' is not in the grid '%s'.", n, g)
+	}
+	markDirty(g)
+	return nil
+}
+
+// SetChildProportion is a no-op, since the sizes of cells come from the
+// rows and columns they're in.
+func (g *grid) SetChildProportion(n node, newProp proportion) {}
+
+// Size returns the number of leaves in the grid, which is less than the
+// number of cells if some of them are empty.
+func (g *grid) Size() int {
+	size := 0
+	g.each(func(r, c int, lf *leaf) bool {
+		size++
+		return true
+	})
+	return size
+}
+
+func (g *grid) Child(i int) node {
+	var child node
+	g.each(func(r, c int, lf *leaf) bool {
+		if i == 0 {
+			child = lf
+			return false
+		}
+		i--
+		return true
+	})
+	return child
+}
+
+func (g *grid) ChildIndex(n node) int {
+	i, found := 0, false
+	g.each(func(r, c int, lf *leaf) bool {
+		if lf == n {
+			found = true
+			return false
+		}
+		i++
+		return true
+	})
+	if !found {
+		return -1
+	}
+	return i
+}
+
+func (g *grid) PropsSave()     {}
+func (g *grid) PropsRollback() {}
+func (g *grid) PropsClear()    {}
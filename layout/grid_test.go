@@ -0,0 +1,68 @@
+package layout
+
+import (
+	"strings"
+	"testing"
+)
+
+// gridOf returns a grid with a row for each of rows, where an 'x' is a cell
+// with a leaf and anything else an empty cell.
+func gridOf(rows ...string) *grid {
+	g := newGrid(len(rows), len(rows[0]))
+	id := 0
+	for r, row := range rows {
+		for c := range row {
+			if row[c] == 'x' {
+				id++
+				g.setCell(r, c, newFake(id))
+			}
+		}
+	}
+	return g
+}
+
+// cellsOf returns the layout of g in the form that gridOf takes, with an 'n'
+// for the cell of lf.
+func cellsOf(g *grid, lf *leaf) string {
+	rows := make([]string, g.rows)
+	for r := range g.cells {
+		for _, cell := range g.cells[r] {
+			switch cell {
+			case nil:
+				rows[r] += "."
+			case lf:
+				rows[r] += "n"
+			default:
+				rows[r] += "x"
+			}
+		}
+	}
+	return strings.Join(rows, "/")
+}
+
+func TestGridAddNode(t *testing.T) {
+	for _, test := range []struct {
+		rows []string
+		last bool
+		want string
+	}{
+		{[]string{"x.x", "..."}, true, "x.x/n.."},
+		{[]string{"x..", ".x."}, true, "x../.xn"},
+		{[]string{"...", "..x"}, true, ".../..x/n.."},
+		{[]string{"...", "..x"}, false, "n../..x"},
+		{[]string{".x.", "xxx"}, false, "nx./xxx"},
+		{[]string{"xxx", "xxx"}, false, "..n/xxx/xxx"},
+		{[]string{"xxx", "xxx"}, true, "xxx/xxx/n.."},
+	} {
+		g := gridOf(test.rows...)
+		lf := newLeaf(nil, newFake(100))
+		g.AddNode(lf, test.last)
+		if got := cellsOf(g, lf); got != test.want {
+			t.Errorf("Adding to %s with last %v gives %s instead of %s.",
+				strings.Join(test.rows, "/"), test.last, got, test.want)
+		}
+		if lf.Parent() != g || len(g.rowProps) != g.rows {
+			t.Errorf("The grid %s is inconsistent.", cellsOf(g, lf))
+		}
+	}
+}
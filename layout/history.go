@@ -0,0 +1,95 @@
+package layout
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// maxHistory is the number of mutations that the history of a tree holds.
+const maxHistory = 100
+
+// recordMutations makes mutate record every mutation that changes a tree in
+// the tree's history, for finding out how a layout came to be the way it is.
+// It is meant to be turned on while debugging, since it compares the whole
+// tree before and after every mutation. Unlike the undo history, the
+// records can't be used to change the tree.
+var recordMutations = false
+
+// mutationRecord is what the history of a tree remembers about a mutation:
+// when it happened, the name of the operation, and the proportion of the
+// leaf of every client that it changed.
+type mutationRecord struct {
+	when    time.Time
+	op      string
+	changes []propChange
+}
+
+// propChange is the proportion of the leaf of a client before and after a
+// mutation. A client that was added to the tree has a before of zero, and a
+// client that was removed has an after of zero.
+type propChange struct {
+	client        Client
+	before, after proportion
+}
+
+func (r mutationRecord) String() string {
+	buf := bytes.NewBufferString(r.when.Format("15:04:05.000 ") + r.op)
+	for i, change := range r.changes {
+		sep := ", "
+		if i == 0 {
+			sep = ": "
+		}
+		fmt.Fprintf(buf, "%s'%s' %f -> %f", sep, change.client,
+			change.before, change.after)
+	}
+	return buf.String()
+}
+
+// record adds the mutation op to the history of the tree, given the snapshot
+// taken before it. The oldest record is overwritten once the history is
+// full.
+func (t *tree) record(op string, before *snapshot) {
+	r := mutationRecord{when: time.Now(), op: op}
+	after := make(map[Client]proportion)
+	if t.child != nil {
+		t.child.VisitLeafNodes(func(lf *leaf) bool {
+			after[lf.client] = lf.Proportion()
+			return true
+		})
+	}
+	seen := make(map[Client]bool)
+	for _, e := range before.entries {
+		if e.client == nil || seen[e.client] {
+			continue
+		}
+		seen[e.client] = true
+		if p := after[e.client]; !p.Equal(e.prop) {
+			r.changes = append(r.changes, propChange{e.client, e.prop, p})
+		}
+	}
+	if t.child != nil {
+		t.child.VisitLeafNodes(func(lf *leaf) bool {
+			if !seen[lf.client] {
+				r.changes = append(r.changes,
+					propChange{lf.client, 0, lf.Proportion()})
+			}
+			return true
+		})
+	}
+
+	if len(t.records) < maxHistory {
+		t.records = append(t.records, r)
+		return
+	}
+	t.records[t.nextRecord] = r
+	t.nextRecord = (t.nextRecord + 1) % maxHistory
+}
+
+// history returns the mutations recorded for the tree, oldest first. It is
+// empty unless recordMutations is set.
+func (t *tree) history() []mutationRecord {
+	records := make([]mutationRecord, 0, len(t.records))
+	records = append(records, t.records[t.nextRecord:]...)
+	return append(records, t.records[:t.nextRecord]...)
+}
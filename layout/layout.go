@@ -47,4 +47,14 @@ type AutoTiler interface {
 	MakeMaster()
 	MastersMore()
 	MastersFewer()
+	Balance()
+	SnapProportions(step float64)
+	GoldenRatio()
+	Thirds()
+	RotateClients(forward bool)
+	Split(dir string)
+	RotateSplit()
+	MoveClient(dir string)
+	Zoom()
+	RefreshConstraints(c Client)
 }
@@ -0,0 +1,350 @@
+package layout
+
+import (
+	"time"
+
+	"github.com/BurntSushi/xgbutil/xrect"
+)
+
+// The exported methods in this file are the operations of a tree for code
+// that doesn't hold its lock (see tree). Each one takes the lock for as long
+// as the unexported method of the same name runs: the read lock if it only
+// looks at the tree, and the write lock if it changes or places it.
+
+// Place places the tree in base, like place.
+func (t *tree) Place(base xrect.Rect) placement {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.place(base)
+}
+
+// PlaceForce places the tree in base, moving every client, like placeForce.
+func (t *tree) PlaceForce(base xrect.Rect) placement {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.placeForce(base)
+}
+
+// PlaceAnimated starts an animated placement, like placeAnimated. Its frames
+// are drawn with the write lock held, and so is step.
+func (t *tree) PlaceAnimated(base xrect.Rect, duration time.Duration,
+	ease easing, step func()) placement {
+
+	t.Lock()
+	defer t.Unlock()
+
+	return t.placeAnimated(base, duration, ease, step)
+}
+
+// PlaceMinimalMove places the tree in base after shuffling its clients, like
+// placeMinimalMove.
+func (t *tree) PlaceMinimalMove(base xrect.Rect,
+	prev map[Client]xrect.Rect) placement {
+
+	t.Lock()
+	defer t.Unlock()
+
+	return t.placeMinimalMove(base, prev)
+}
+
+// AddAuto tiles c in the largest tile, like addAuto.
+func (t *tree) AddAuto(c Client) error {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.addAuto(c)
+}
+
+// TileClient tiles a floating client, like tileClient.
+func (t *tree) TileClient(c Client) error {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.tileClient(c)
+}
+
+// TileBesideActive tiles c beside the active client, like tileBesideActive.
+func (t *tree) TileBesideActive(c Client) error {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.tileBesideActive(c)
+}
+
+// FloatClient takes c out of the tiles, like floatClient.
+func (t *tree) FloatClient(c Client) bool {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.floatClient(c)
+}
+
+// Remove takes c out of the tree, like removeClient.
+func (t *tree) Remove(c Client) error {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.removeClient(c)
+}
+
+// ReplaceClient gives the leaf of old to new, like replaceClient.
+func (t *tree) ReplaceClient(old, new Client) bool {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.replaceClient(old, new)
+}
+
+// SwapLeaves exchanges the leaves of c1 and c2, like swapLeaves.
+func (t *tree) SwapLeaves(c1, c2 Client) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.swapLeaves(c1, c2)
+}
+
+// ResizeLeaf resizes the tile of c, like resizeLeaf.
+func (t *tree) ResizeLeaf(c Client, dir direction, delta proportion) bool {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.resizeLeaf(c, dir, delta)
+}
+
+// Grow grows the tile of c towards dir, like grow.
+func (t *tree) Grow(c Client, dir direction, delta proportion) bool {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.grow(c, dir, delta)
+}
+
+// RotateClients rotates the clients around c, like rotateClients.
+func (t *tree) RotateClients(c Client, forward bool) bool {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.rotateClients(c, forward)
+}
+
+// SplitLeaf splits the tile of c for newClient, like splitLeaf.
+func (t *tree) SplitLeaf(c Client, dir direction, newClient Client) error {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.splitLeaf(c, dir, newClient)
+}
+
+// MoveClient moves the tile of c towards dir, like moveClient.
+func (t *tree) MoveClient(c Client, dir direction) bool {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.moveClient(c, dir)
+}
+
+// StackWith adds newClient as a tab of the tile of target, like stackWith.
+func (t *tree) StackWith(target, newClient Client) error {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.stackWith(target, newClient)
+}
+
+// Balance gives the children of every split equal shares, like balance.
+func (t *tree) Balance() {
+	t.Lock()
+	defer t.Unlock()
+
+	t.balance()
+}
+
+// EqualizeSplit balances the split around c, like equalizeSplit.
+func (t *tree) EqualizeSplit(c Client) bool {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.equalizeSplit(c)
+}
+
+// Zoom makes c take up most of its split, like zoom.
+func (t *tree) Zoom(c Client) bool {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.zoom(c)
+}
+
+// SnapProportions rounds every proportion to a multiple of step, like
+// snapProportions.
+func (t *tree) SnapProportions(step float64) bool {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.snapProportions(proportion(step))
+}
+
+// Mirror flips the tree, like mirror.
+func (t *tree) Mirror(horizontal bool) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.mirror(horizontal)
+}
+
+// ToMonocle stacks every tiled client, like toMonocle.
+func (t *tree) ToMonocle() bool {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.toMonocle()
+}
+
+// FromMonocle brings back the tree from before ToMonocle, like fromMonocle.
+func (t *tree) FromMonocle() bool {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.fromMonocle()
+}
+
+// FocusParent widens the selection, like focusParent.
+func (t *tree) FocusParent() bool {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.focusParent()
+}
+
+// FocusChild narrows the selection, like focusChild.
+func (t *tree) FocusChild() bool {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.focusChild()
+}
+
+// SetStruts reserves the edges of the geometry of the tree, like setStruts.
+func (t *tree) SetStruts(top, right, bottom, left int) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.setStruts(top, right, bottom, left)
+}
+
+// RefreshConstraints grows the tile of c to its new minimum size, like
+// refreshConstraints.
+func (t *tree) RefreshConstraints(c Client) bool {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.refreshConstraints(c)
+}
+
+// LoadLayout arranges the tree like the layout saved under name, like
+// loadLayout.
+func (t *tree) LoadLayout(name string) error {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.loadLayout(name)
+}
+
+// SaveLayout stores the arrangement of the tree under name, like saveLayout.
+func (t *tree) SaveLayout(name string) error {
+	t.RLock()
+	defer t.RUnlock()
+
+	return t.saveLayout(name)
+}
+
+// Undo reverts the last mutation, like undo.
+func (t *tree) Undo() bool {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.undo()
+}
+
+// Redo reapplies the last mutation that was undone, like redo.
+func (t *tree) Redo() bool {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.redo()
+}
+
+// Clients returns the tiled clients of the tree, like clients.
+func (t *tree) Clients() []Client {
+	t.RLock()
+	defer t.RUnlock()
+
+	return t.clients()
+}
+
+// Exists returns whether c is tiled in the tree. It stands in for findLeaf,
+// since a leaf must not be used once the lock is released.
+func (t *tree) Exists(c Client) bool {
+	t.RLock()
+	defer t.RUnlock()
+
+	return t.findLeaf(c) != nil
+}
+
+// IsFloating returns whether c floats above the tree, like isFloating.
+func (t *tree) IsFloating(c Client) bool {
+	t.RLock()
+	defer t.RUnlock()
+
+	return t.isFloating(c)
+}
+
+// IsVisible returns whether the tile of c can be seen, like isVisible.
+func (t *tree) IsVisible(c Client) bool {
+	t.RLock()
+	defer t.RUnlock()
+
+	return t.isVisible(c)
+}
+
+// GeomOf returns the geometry that c would have in base, like geomOf.
+func (t *tree) GeomOf(c Client, base xrect.Rect) (xrect.Rect, bool) {
+	t.RLock()
+	defer t.RUnlock()
+
+	return t.geomOf(c, base)
+}
+
+// EachLeafGeom calls f with the geometry of every client in base, like
+// eachLeafGeom. f runs with the read lock held, so it must not call any of
+// the exported methods of the tree.
+func (t *tree) EachLeafGeom(base xrect.Rect,
+	f func(c Client, r xrect.Rect) bool) {
+
+	t.RLock()
+	defer t.RUnlock()
+
+	t.eachLeafGeom(base, f)
+}
+
+// DropTarget returns the tile under the point (x, y) in base, like
+// dropTarget.
+func (t *tree) DropTarget(base xrect.Rect, x, y int) (Client, dropZone) {
+	t.RLock()
+	defer t.RUnlock()
+
+	return t.dropTarget(base, x, y)
+}
+
+// CenterOver returns where a window of w by h centered over parent goes, like
+// centerOver.
+func (t *tree) CenterOver(parent Client, w, h int,
+	base xrect.Rect) (x, y int) {
+
+	t.RLock()
+	defer t.RUnlock()
+
+	return t.centerOver(parent, w, h, base)
+}
@@ -0,0 +1,167 @@
+package layout
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/xgbutil/xrect"
+)
+
+// The tests in this file are meant to be run with -race, which reports any
+// access to a tree that its lock doesn't cover.
+
+func TestConcurrentTree(t *testing.T) {
+	tr := newTree()
+	base := xrect.New(0, 0, 1200, 900)
+	first := newFake(1)
+	first.active = true
+	if err := tr.AddAuto(first); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				c := newFake(100*(g+1) + i)
+				if err := tr.AddAuto(c); err != nil {
+					t.Error(err)
+					return
+				}
+				tr.Place(base)
+				if !tr.Exists(c) {
+					t.Errorf("Client '%s' was lost.", c)
+				}
+				tr.GeomOf(c, base)
+				tr.ResizeLeaf(c, dirRight, 0.05)
+				if err := tr.Remove(c); err != nil {
+					t.Error(err)
+				}
+			}
+		}(g)
+	}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			tr.Balance()
+			tr.Clients()
+			tr.PlaceAnimated(base, time.Millisecond, easeInOut, nil)
+			tr.Undo()
+			tr.Redo()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			tr.SetGaps(i%8, i%4)
+			tr.EachLeafGeom(base, func(c Client, r xrect.Rect) bool {
+				return true
+			})
+			if _, err := tr.MarshalJSON(); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	wg.Wait()
+	tr.PlaceForce(base)
+
+	if got := tr.Clients(); len(got) != 1 || got[0] != first {
+		t.Fatalf("Got clients %v, but only '%s' should be left.", got, first)
+	}
+}
+
+func TestConcurrentVerthorz(t *testing.T) {
+	lay := NewVertical()
+	lay.SetGeom(xrect.New(0, 0, 1000, 800))
+	first := newFake(1)
+	first.active = true
+	lay.Add(first)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				c := newFake(100*(g+1) + i)
+				lay.Add(c)
+				lay.Place()
+				if !lay.Exists(c) {
+					t.Errorf("Client '%s' was lost.", c)
+				}
+				lay.Remove(c)
+			}
+		}(g)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			lay.SetGeom(xrect.New(0, 0, 1000+i%3, 800))
+			lay.Balance()
+			lay.ResizeMaster(0.01)
+			lay.Next()
+			lay.SwitchNext()
+			lay.MastersMore()
+			lay.MastersFewer()
+		}
+	}()
+	wg.Wait()
+
+	if !lay.Exists(first) {
+		t.Fatalf("Client '%s' was lost.", first)
+	}
+}
+
+func TestConcurrentWorkspaces(t *testing.T) {
+	m := &workspaceManager{}
+	w1 := m.addWorkspace(xrect.New(0, 0, 800, 600))
+	w2 := m.addWorkspace(xrect.New(800, 0, 800, 600))
+	cs := newFakes(6)
+	for _, c := range cs {
+		if err := w1.tree.AddAuto(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 3; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				c := cs[(g+i)%len(cs)]
+				dst := w1
+				if i%2 == 0 {
+					dst = w2
+				}
+				// Another goroutine may have moved c in the meantime, which
+				// is reported as an error.
+				m.moveClientToWorkspace(c, dst)
+			}
+		}(g)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			w1.setLayout(layoutKind(i % 4))
+			w2.replace(xrect.New(800, 0, 800+i%2, 600))
+		}
+	}()
+	wg.Wait()
+
+	count := len(w1.tree.Clients()) + len(w2.tree.Clients())
+	if count != len(cs) {
+		t.Fatalf("%d clients are tiled instead of %d.", count, len(cs))
+	}
+	for _, c := range cs {
+		if m.workspaceOf(c) == nil {
+			t.Fatalf("Client '%s' is in no workspace.", c)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package layout
+
+// defaultMasterProportion is the proportion given to the master column of a
+// tree created by newMasterStack.
+const defaultMasterProportion proportion = 0.5
+
+// newMasterStack creates a tree with the classic master/stack layout: an
+// hsplit whose left child is a column containing the master and whose right
+// child is a column containing the stacked clients. The master column is
+// given defaultMasterProportion, and the stacked clients share their column
+// evenly.
+//
+// Each column is a vsplit so that setMasterCount can move clients between
+// them. A column with no clients is not shown.
+func newMasterStack(master Client, stack []Client) *tree {
+	t := newTree()
+	root := newHSplit(nil)
+	root.SetProportion(fullPortion)
+	t.setChild(root)
+
+	t.masterCol, t.stackCol = newVSplit(root), newVSplit(root)
+	t.masterProp = defaultMasterProportion
+
+	// The columns are kept by the tree, so they must not become stacks.
+	t.SetStackFallback(false)
+
+	leaves := make([]node, 0, len(stack)+1)
+	if master != nil {
+		leaves = append(leaves, newLeaf(nil, master))
+	}
+	for _, c := range stack {
+		leaves = append(leaves, newLeaf(nil, c))
+	}
+	t.arrangeMasterStack(leaves, 1)
+	return t
+}
+
+// setMasterCount moves clients between the master and stack columns such that
+// the first n clients are in the master column. The tree is placed again
+// afterwards. setMasterCount has no effect on trees not created with
+// newMasterStack.
+func (t *tree) setMasterCount(n int) {
+	if t.masterCol == nil {
+		return
+	}
+	leaves := append(append([]node{}, t.masterCol.children...),
+		t.stackCol.children...)
+	t.arrangeMasterStack(leaves, n)
+	t.replace()
+}
+
+// setMasterProportion sets the proportion of the master column. The tree is
+// placed again afterwards.
+func (t *tree) setMasterProportion(p proportion) {
+	if t.masterCol == nil || p <= 0 || p >= fullPortion {
+		return
+	}
+	t.masterProp = p
+	t.setMasterCount(t.masterCol.Size())
+}
+
+// arrangeMasterStack puts the first n leaves into the master column and the
+// rest into the stack column. Each column's leaves are given even
+// proportions, and empty columns are removed from the root.
+func (t *tree) arrangeMasterStack(leaves []node, n int) {
+	if n < 0 {
+		n = 0
+	}
+	if n > len(leaves) {
+		n = len(leaves)
+	}
+
+	fill := func(col *vsplit, children []node) {
+		col.children = append([]node{}, children...)
+		for _, child := range col.children {
+			child.SetParent(col)
+			child.SetProportion(fullPortion / proportion(len(children)))
+		}
+	}
+	fill(t.masterCol, leaves[:n])
+	fill(t.stackCol, leaves[n:])
+
+	root := asSplit(t.child)
+	root.children = root.children[:0]
+	switch {
+	case t.masterCol.Size() > 0 && t.stackCol.Size() > 0:
+		t.masterCol.SetProportion(t.masterProp)
+		t.stackCol.SetProportion(fullPortion - t.masterProp)
+		root.children = append(root.children, t.masterCol, t.stackCol)
+	case t.masterCol.Size() > 0:
+		t.masterCol.SetProportion(fullPortion)
+		root.children = append(root.children, t.masterCol)
+	case t.stackCol.Size() > 0:
+		t.stackCol.SetProportion(fullPortion)
+		root.children = append(root.children, t.stackCol)
+	}
+	root.checkPortions()
+}
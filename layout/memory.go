@@ -0,0 +1,84 @@
+package layout
+
+import (
+	"github.com/BurntSushi/xgb/xproto"
+)
+
+// The tree remembers the proportion of every client whose leaf is removed
+// with removeNode, so that closing a window (or floating it) and bringing it
+// back doesn't undo the way the layout was resized. When a leaf for the same
+// client (by window id) is added to a split again with addNode or
+// insertBeside, it is given its old proportion back, and its new siblings
+// shrink to make room for it (see split.claim).
+//
+// Only the last maxRemembered clients are remembered, and a proportion is
+// forgotten once it has been given back.
+
+// maxRemembered is the largest number of clients whose proportions the tree
+// remembers at once.
+const maxRemembered = 64
+
+// SetRememberProportions turns remembering the proportions of removed
+// clients on or off. It is on by default. Turning it off forgets every
+// proportion that was remembered so far.
+func (t *tree) SetRememberProportions(on bool) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.rememberProps = on
+	if !on {
+		t.remembered, t.rememberOrder = nil, nil
+	}
+}
+
+// remember records the proportion of lf before it is removed from its split.
+// The leaf of a client that is already remembered replaces it.
+func (t *tree) remember(lf *leaf) {
+	if !t.rememberProps || asSplit(lf.parent) == nil {
+		return
+	}
+	id := lf.client.Id()
+	if t.remembered == nil {
+		t.remembered = make(map[xproto.Window]proportion)
+	}
+	if _, ok := t.remembered[id]; ok {
+		t.dropRemembered(id)
+	}
+	t.remembered[id] = lf.Proportion()
+	t.rememberOrder = append(t.rememberOrder, id)
+	if len(t.rememberOrder) > maxRemembered {
+		t.dropRemembered(t.rememberOrder[0])
+	}
+}
+
+// recall gives n back the proportion that was remembered for its client, if
+// n is a leaf in a split, and forgets it.
+func (t *tree) recall(n node) {
+	lf, ok := n.(*leaf)
+	if !ok || lf.client == nil {
+		return
+	}
+	id := lf.client.Id()
+	p, ok := t.remembered[id]
+	if !ok {
+		return
+	}
+	s := asSplit(lf.parent)
+	if s == nil {
+		return
+	}
+	t.dropRemembered(id)
+	s.claim(lf, p)
+}
+
+// dropRemembered forgets the proportion that was remembered for id.
+func (t *tree) dropRemembered(id xproto.Window) {
+	delete(t.remembered, id)
+	for i, other := range t.rememberOrder {
+		if other == id {
+			t.rememberOrder = append(t.rememberOrder[:i],
+				t.rememberOrder[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package layout
+
+import (
+	"sort"
+
+	"github.com/BurntSushi/xgbutil/xrect"
+)
+
+// moveCandidate is a possible assignment of a client to a leaf for
+// placeMinimalMove, along with how far the client would have to move.
+type moveCandidate struct {
+	client, leaf int
+	distance     int
+}
+
+// moveCandidates sorts candidates by distance, keeping the order of the
+// leaves and then of the clients for candidates that are just as far.
+type moveCandidates []moveCandidate
+
+func (mc moveCandidates) Len() int {
+	return len(mc)
+}
+
+func (mc moveCandidates) Less(i, j int) bool {
+	if mc[i].distance != mc[j].distance {
+		return mc[i].distance < mc[j].distance
+	}
+	if mc[i].leaf != mc[j].leaf {
+		return mc[i].leaf < mc[j].leaf
+	}
+	return mc[i].client < mc[j].client
+}
+
+func (mc moveCandidates) Swap(i, j int) {
+	mc[i], mc[j] = mc[j], mc[i]
+}
+
+// placeMinimalMove is like place, except that the clients of the tree are
+// first shuffled among its leaves so that they move as little as possible,
+// which makes switching to a different layout less jarring. prev is where
+// each client is now (e.g., the drawn geometry of the old layout).
+//
+// The assignment is greedy: of all clients in prev and all leaves, the
+// client and leaf whose geometries in base and prev are closest are matched
+// first, then the closest of the rest, and so on. Clients that aren't in
+// prev fill the leaves that are left over, in the order of the tree. The
+// leaves of stacks keep their clients, so that the visible tab doesn't
+// change. Clients that end up exactly where prev says they are aren't moved
+// at all. The shuffle can be undone.
+func (t *tree) placeMinimalMove(base xrect.Rect,
+	prev map[Client]xrect.Rect) placement {
+
+	t.mutate("placeMinimalMove", func() bool {
+		cells := make(map[Client]xrect.Rect)
+		t.eachLeafGeom(base, func(c Client, r xrect.Rect) bool {
+			cells[c] = r
+			return true
+		})
+		if len(cells) == 0 {
+			return false
+		}
+
+		var leaves []*leaf
+		var clients []Client
+		t.child.VisitLeafNodes(func(lf *leaf) bool {
+			if _, ok := lf.parent.(*stack); !ok {
+				leaves = append(leaves, lf)
+				clients = append(clients, lf.client)
+			}
+			return true
+		})
+
+		candidates := make(moveCandidates, 0, len(clients)*len(leaves))
+		for i, c := range clients {
+			from, ok := prev[c]
+			if !ok {
+				continue
+			}
+			for j, lf := range leaves {
+				candidates = append(candidates,
+					moveCandidate{i, j, rectDistance(from, cells[lf.client])})
+			}
+		}
+		sort.Sort(candidates)
+
+		assigned := make([]Client, len(leaves))
+		placed := make([]bool, len(clients))
+		for _, mc := range candidates {
+			if placed[mc.client] || assigned[mc.leaf] != nil {
+				continue
+			}
+			assigned[mc.leaf], placed[mc.client] = clients[mc.client], true
+		}
+		next := 0
+		for i, c := range clients {
+			if placed[i] {
+				continue
+			}
+			for assigned[next] != nil {
+				next++
+			}
+			assigned[next] = c
+		}
+
+		changed := false
+		for i, lf := range leaves {
+			if lf.client != assigned[i] {
+				lf.client, changed = assigned[i], true
+			}
+		}
+		return changed
+	})
+
+	for c, r := range prev {
+		t.drawn[c] = r
+	}
+	return t.place(base)
+}
+
+// rectDistance is how far apart r1 and r2 are: the sum of the differences
+// of their positions and sizes.
+func rectDistance(r1, r2 xrect.Rect) int {
+	abs := func(n int) int {
+		if n < 0 {
+			return -n
+		}
+		return n
+	}
+	return abs(r1.X()-r2.X()) + abs(r1.Y()-r2.Y()) +
+		abs(r1.Width()-r2.Width()) + abs(r1.Height()-r2.Height())
+}
@@ -0,0 +1,95 @@
+package layout
+
+import (
+	"github.com/cshapeshifter/wingo/logger"
+)
+
+// toMonocle turns the tree into a monocle: a stack at the root that holds
+// every tiled client, in the order of the leaves, so that each client fills
+// the whole screen and only one of them is visible. The active client stays
+// the visible one. Use selectNext and selectPrev on the root stack to cycle
+// through the clients (and place the tree again to show the new one).
+//
+// The previous structure of the tree is kept, so that fromMonocle can restore
+// it. false is returned if the tree is empty or already a monocle. The tree
+// is placed again afterwards.
+func (t *tree) toMonocle() bool {
+	return t.mutate("toMonocle", func() bool {
+		if t.child == nil || t.isMonocle() {
+			return false
+		}
+		st := newStack(nil)
+		st.SetProportion(fullPortion)
+		t.child.VisitLeafNodes(func(lf *leaf) bool {
+			if lf.client.IsActive() {
+				st.active = st.Size()
+			}
+			st.AddNode(newLeaf(nil, lf.client), true)
+			return true
+		})
+
+		t.unmonocled = t.child
+		t.setChild(st)
+		t.replace()
+		return true
+	})
+}
+
+// isMonocle returns true if the tree was turned into a monocle by toMonocle.
+func (t *tree) isMonocle() bool {
+	_, ok := t.child.(*stack)
+	return ok && t.unmonocled != nil
+}
+
+// fromMonocle restores the structure that the tree had before toMonocle was
+// called. Clients that were removed from the monocle in the meantime are
+// removed from the restored structure, and clients that were added to it are
+// tiled beside the active client. Every client is mapped again, since the
+// monocle only shows one of them. false is returned if the tree isn't a
+// monocle. The tree is placed again afterwards.
+func (t *tree) fromMonocle() bool {
+	return t.mutate("fromMonocle", func() bool {
+		if !t.isMonocle() {
+			return false
+		}
+		st := t.child.(*stack)
+		current := make(map[Client]bool, st.Size())
+		for _, lf := range st.leaves {
+			current[lf.client] = true
+		}
+
+		t.setChild(t.unmonocled)
+		t.unmonocled = nil
+
+		restored := make(map[Client]bool, st.Size())
+		var gone []*leaf
+		t.child.VisitLeafNodes(func(lf *leaf) bool {
+			if current[lf.client] {
+				restored[lf.client] = true
+			} else {
+				gone = append(gone, lf)
+			}
+			return true
+		})
+		for _, lf := range gone {
+			if lf.parent == nil {
+				t.setChild(nil)
+				continue
+			}
+			if err := t.removeNode(lf); err != nil {
+				logger.Warning.Println(err)
+			}
+		}
+		for _, lf := range st.leaves {
+			t.show(lf.client)
+			if restored[lf.client] {
+				continue
+			}
+			if err := t.tileBesideActive(lf.client); err != nil {
+				logger.Warning.Println(err)
+			}
+		}
+		t.replace()
+		return true
+	})
+}
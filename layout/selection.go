@@ -0,0 +1,88 @@
+package layout
+
+// The selection is the node that operations on the active client act on.
+// Normally this is just the leaf of the active client, but focusParent can
+// widen it to a whole stack or split (and focusChild can narrow it again),
+// so that rotateSplit, resizeLeaf, moveClient and zoom apply to everything
+// in it at once.
+//
+// The selection belongs to the client that was active when it was made.
+// Once another client is focused, or the selected node no longer contains
+// the active leaf (e.g., because the tree was changed), it falls back to the
+// active leaf.
+
+// focusParent widens the selection to the parent of the selected node. It
+// returns false if no tiled client is active or the selection is already the
+// root of the tree.
+func (t *tree) focusParent() bool {
+	sel := t.selected()
+	if sel == nil || sel.Parent() == nil {
+		return false
+	}
+	t.selection, t.selectedFor = sel.Parent(), t.activeLeaf().client
+	return true
+}
+
+// focusChild narrows the selection to the child of the selected node that
+// contains the active leaf. It returns false if only the active leaf is
+// selected.
+func (t *tree) focusChild() bool {
+	sel, lf := t.selected(), t.activeLeaf()
+	if sel == nil || sel == node(lf) {
+		return false
+	}
+	chain := append(ancestors(lf), lf)
+	for i, n := range chain {
+		if n != sel {
+			continue
+		}
+		if next := chain[i+1]; next != node(lf) {
+			t.selection = next
+		} else {
+			t.selection, t.selectedFor = nil, nil
+		}
+		return true
+	}
+	return false
+}
+
+// selected returns the selected node, which is the active leaf unless the
+// selection was widened with focusParent. A selection that has gone stale
+// is reset first (see above). nil is returned if no tiled client is active.
+func (t *tree) selected() node {
+	lf := t.activeLeaf()
+	if lf == nil {
+		t.selection, t.selectedFor = nil, nil
+		return nil
+	}
+	if t.selection == nil || t.selectedFor != lf.client ||
+		!t.encloses(t.selection, lf) {
+
+		t.selection, t.selectedFor = nil, nil
+		return lf
+	}
+	return t.selection
+}
+
+// scope returns the node that an operation on lf acts on: the selection if
+// lf is the active leaf, and lf itself otherwise.
+func (t *tree) scope(lf *leaf) node {
+	if sel := t.selected(); sel != nil && t.selectedFor == lf.client {
+		return sel
+	}
+	return lf
+}
+
+// encloses returns true if lf is in the tree and n is one of its ancestors.
+func (t *tree) encloses(n node, lf *leaf) bool {
+	chain := ancestors(lf)
+	if len(chain) == 0 || chain[0] != t.child {
+		return false
+	}
+	for _, a := range chain {
+		if a == n {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,412 @@
+package layout
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// jsonTree is the serialized form of a tree: the settings that decide how
+// it is placed and changed, and its root node.
+type jsonTree struct {
+	InnerGap       int     `json:"inner_gap"`
+	OuterGap       int     `json:"outer_gap"`
+	StrutTop       int     `json:"strut_top"`
+	StrutRight     int     `json:"strut_right"`
+	StrutBottom    int     `json:"strut_bottom"`
+	StrutLeft      int     `json:"strut_left"`
+	MinLeafPx      int     `json:"min_leaf_px"`
+	Scale          float64 `json:"scale"`
+	ScrollOverflow bool    `json:"scroll_overflow"`
+	StackFallback  bool    `json:"stack_fallback"`
+	FocusWrap      bool    `json:"focus_wrap"`
+	RoundMode      int     `json:"round_mode"`
+	RemovalPolicy  int     `json:"removal_policy"`
+	DropCenter     float64 `json:"drop_center"`
+	MaxDepth       int     `json:"max_depth"`
+	MaxChildren    int     `json:"max_children"`
+	SnapStep       float64 `json:"snap_step"`
+	RememberProps  bool    `json:"remember_proportions"`
+
+	Root *jsonNode `json:"root"`
+}
+
+// jsonNode is the serialized form of a node. Client, Class, Instance, Title,
+// Label and Sticky are only set for leaves, Children is only set for splits,
+// stacks and grids, Active is only set for stacks, and FixedPx is only set
+// for nodes with a fixed size. Bounds, Anchor and ScrollOffset are only set
+// for splits, and Bounds only if they aren't the default proportion bounds.
+//
+// Rows, Cols, RowProps and ColProps are only set for grids, whose Children
+// are their cells in row-major order, with a nil child for an empty cell.
+type jsonNode struct {
+	Type         string      `json:"type"`
+	Proportion   float64     `json:"proportion"`
+	Client       string      `json:"client,omitempty"`
+	Class        string      `json:"class,omitempty"`
+	Instance     string      `json:"instance,omitempty"`
+	Title        string      `json:"title,omitempty"`
+	Label        string      `json:"label,omitempty"`
+	Sticky       bool        `json:"sticky,omitempty"`
+	Children     []*jsonNode `json:"children,omitempty"`
+	Active       int         `json:"active,omitempty"`
+	FixedPx      int         `json:"fixed_px,omitempty"`
+	Bounds       *[2]float64 `json:"bounds,omitempty"`
+	Anchor       int         `json:"anchor,omitempty"`
+	ScrollOffset int         `json:"scroll_offset,omitempty"`
+	Rows         int         `json:"rows,omitempty"`
+	Cols         int         `json:"cols,omitempty"`
+	RowProps     []float64   `json:"row_props,omitempty"`
+	ColProps     []float64   `json:"col_props,omitempty"`
+}
+
+// clientHint is what a serialized leaf records about its client, so that a
+// live client can be found for it when the tree is decoded. Id is the
+// client's identifier (see clientIdent), which is only meaningful for as
+// long as the client exists. The window class, instance and title can be
+// used to find a similar client after that. Label is the label of the leaf,
+// which can be used to put a particular client in a particular position.
+type clientHint struct {
+	Id, Class, Instance, Title string
+	Label                      string
+}
+
+const (
+	jsonHSplit = "hsplit"
+	jsonVSplit = "vsplit"
+	jsonLeaf   = "leaf"
+	jsonStack  = "stack"
+	jsonGrid   = "grid"
+)
+
+// clientIdent returns the stable identifier used for c when serializing a
+// tree. It is the client's window id.
+func clientIdent(c Client) string {
+	return fmt.Sprintf("%d", c.Id())
+}
+
+// hintOf returns the hint recorded for c when serializing a tree.
+func hintOf(c Client) clientHint {
+	hint := clientHint{Id: clientIdent(c), Title: c.String()}
+	if class := c.Class(); class != nil {
+		hint.Class, hint.Instance = class.Class, class.Instance
+	}
+	return hint
+}
+
+// MarshalJSON encodes the settings of the tree, its structure, the
+// proportions and settings of every node and a hint for every leaf's client
+// (see clientHint).
+func (t *tree) MarshalJSON() ([]byte, error) {
+	t.RLock()
+	defer t.RUnlock()
+
+	return t.marshalJSON()
+}
+
+// marshalJSON is MarshalJSON for callers that hold the lock of the tree.
+func (t *tree) marshalJSON() ([]byte, error) {
+	return json.Marshal(toJSONTree(t))
+}
+
+// toJSONTree returns the serialized form of t.
+func toJSONTree(t *tree) *jsonTree {
+	jt := &jsonTree{
+		InnerGap:       t.innerGap,
+		OuterGap:       t.outerGap,
+		StrutTop:       t.strutTop,
+		StrutRight:     t.strutRight,
+		StrutBottom:    t.strutBottom,
+		StrutLeft:      t.strutLeft,
+		MinLeafPx:      t.minLeafPx,
+		Scale:          t.scale,
+		ScrollOverflow: t.scrollOverflow,
+		StackFallback:  t.stackFallback,
+		FocusWrap:      t.focusWrap,
+		RoundMode:      int(t.roundMode),
+		RemovalPolicy:  int(t.removalPolicy),
+		DropCenter:     float64(t.dropCenter),
+		MaxDepth:       t.maxDepth,
+		MaxChildren:    t.maxChildren,
+		SnapStep:       float64(t.snapStep),
+		RememberProps:  t.rememberProps,
+	}
+	if t.child != nil {
+		jt.Root = toJSONNode(t.child)
+	}
+	return jt
+}
+
+func toJSONNode(n node) *jsonNode {
+	jn := &jsonNode{
+		Proportion: float64(n.Proportion()),
+		FixedPx:    n.FixedSize(),
+	}
+	switch n := n.(type) {
+	case *leaf:
+		hint := hintOf(n.client)
+		jn.Type = jsonLeaf
+		jn.Client, jn.Title = hint.Id, hint.Title
+		jn.Class, jn.Instance = hint.Class, hint.Instance
+		jn.Label, jn.Sticky = n.Label(), n.sticky
+		return jn
+	case *stack:
+		jn.Type = jsonStack
+		jn.Active = n.active
+		for _, lf := range n.leaves {
+			jn.Children = append(jn.Children, toJSONNode(lf))
+		}
+		return jn
+	case *grid:
+		return gridToJSON(n, jn)
+	case *hsplit:
+		jn.Type = jsonHSplit
+	case *vsplit:
+		jn.Type = jsonVSplit
+	default:
+		panic(fmt.Sprintf("Cannot serialize node of type %T.", n))
+	}
+	s := asSplit(n)
+	if s.minProp != defaultMinProportion || s.maxProp != defaultMaxProportion {
+		jn.Bounds = &[2]float64{float64(s.minProp), float64(s.maxProp)}
+	}
+	jn.Anchor, jn.ScrollOffset = int(s.anchor), s.scrollOffset
+	for _, child := range s.children {
+		jn.Children = append(jn.Children, toJSONNode(child))
+	}
+	return jn
+}
+
+// gridToJSON serializes the rows, columns and cells of a grid into jn.
+func gridToJSON(g *grid, jn *jsonNode) *jsonNode {
+	jn.Type = jsonGrid
+	jn.Rows, jn.Cols = g.rows, g.cols
+	for _, p := range g.rowProps {
+		jn.RowProps = append(jn.RowProps, float64(p))
+	}
+	for _, p := range g.colProps {
+		jn.ColProps = append(jn.ColProps, float64(p))
+	}
+	for _, row := range g.cells {
+		for _, lf := range row {
+			var jcell *jsonNode
+			if lf != nil {
+				jcell = toJSONNode(lf)
+			}
+			jn.Children = append(jn.Children, jcell)
+		}
+	}
+	return jn
+}
+
+// unmarshalTree decodes a tree encoded by MarshalJSON. resolve is used to
+// map the client hints of leaves back to live clients. If resolve returns
+// nil, the leaf for that hint is dropped and its proportion is given back to
+// its siblings, or its cell is left empty if it is in a grid. Splits and
+// grids left without any leaves are dropped too, and a split left with a
+// single child is replaced by that child. Settings that are missing from
+// data keep the values of a new tree.
+func unmarshalTree(data []byte,
+	resolve func(hint clientHint) Client) (*tree, error) {
+
+	jt := toJSONTree(newTree())
+	if err := json.Unmarshal(data, jt); err != nil {
+		return nil, err
+	}
+	return fromJSONTree(jt, resolve)
+}
+
+// fromJSONTree builds a tree from its decoded JSON form, as described by
+// unmarshalTree.
+func fromJSONTree(jt *jsonTree,
+	resolve func(hint clientHint) Client) (*tree, error) {
+
+	t := newTree()
+	t.innerGap, t.outerGap = jt.InnerGap, jt.OuterGap
+	t.strutTop, t.strutRight = jt.StrutTop, jt.StrutRight
+	t.strutBottom, t.strutLeft = jt.StrutBottom, jt.StrutLeft
+	t.minLeafPx, t.scale = jt.MinLeafPx, jt.Scale
+	t.scrollOverflow, t.stackFallback = jt.ScrollOverflow, jt.StackFallback
+	t.focusWrap, t.rememberProps = jt.FocusWrap, jt.RememberProps
+	t.roundMode = RoundMode(jt.RoundMode)
+	t.removalPolicy = RemovalPolicy(jt.RemovalPolicy)
+	t.dropCenter = proportion(jt.DropCenter)
+	t.maxDepth, t.maxChildren = jt.MaxDepth, jt.MaxChildren
+	t.snapStep = proportion(jt.SnapStep)
+	if t.scale <= 0 {
+		t.scale = 1
+	}
+	if jt.Root == nil {
+		return t, nil
+	}
+	root, err := fromJSONNode(jt.Root, nil, resolve)
+	if err != nil {
+		return nil, err
+	}
+	if root != nil {
+		t.setChild(root)
+	}
+	return t, nil
+}
+
+func fromJSONNode(jn *jsonNode, parent splitter,
+	resolve func(hint clientHint) Client) (node, error) {
+
+	var n splitter
+	switch jn.Type {
+	case jsonLeaf:
+		c := resolve(clientHint{
+			Id:       jn.Client,
+			Class:    jn.Class,
+			Instance: jn.Instance,
+			Title:    jn.Title,
+			Label:    jn.Label,
+		})
+		if c == nil {
+			return nil, nil
+		}
+		lf := newLeaf(parent, c)
+		lf.SetProportion(proportion(jn.Proportion))
+		lf.SetFixedSize(jn.FixedPx)
+		lf.SetLabel(jn.Label)
+		lf.SetSticky(jn.Sticky)
+		return lf, nil
+	case jsonHSplit:
+		n = newHSplit(parent)
+	case jsonVSplit:
+		n = newVSplit(parent)
+	case jsonStack:
+		return fromJSONStack(jn, parent, resolve)
+	case jsonGrid:
+		return fromJSONGrid(jn, parent, resolve)
+	default:
+		return nil, fmt.Errorf("Unknown node type '%s'.", jn.Type)
+	}
+	n.SetProportion(proportion(jn.Proportion))
+	n.SetFixedSize(jn.FixedPx)
+
+	s := asSplit(n)
+	if jn.Bounds != nil {
+		s.minProp, s.maxProp = proportion(jn.Bounds[0]),
+			proportion(jn.Bounds[1])
+	}
+	s.anchor, s.scrollOffset = anchor(jn.Anchor), jn.ScrollOffset
+	for _, jchild := range jn.Children {
+		if jchild == nil {
+			return nil, fmt.Errorf("A %s cannot contain an empty node.",
+				jn.Type)
+		}
+		child, err := fromJSONNode(jchild, n, resolve)
+		if err != nil {
+			return nil, err
+		}
+		if child != nil {
+			s.children = append(s.children, child)
+		}
+	}
+	switch {
+	case len(s.children) == 0:
+		return nil, nil
+	case len(s.children) == 1 && len(jn.Children) > 1:
+		child := s.children[0]
+		child.SetParent(parent)
+		child.SetProportion(n.Proportion())
+		child.SetFixedSize(n.FixedSize())
+		return child, nil
+	}
+	s.normalize()
+	return n, nil
+}
+
+// fromJSONStack decodes a stack. Leaves that are dropped are simply left
+// out, and a stack left with a single leaf is replaced by that leaf.
+func fromJSONStack(jn *jsonNode, parent splitter,
+	resolve func(hint clientHint) Client) (node, error) {
+
+	st := newStack(parent)
+	st.SetProportion(proportion(jn.Proportion))
+	st.SetFixedSize(jn.FixedPx)
+	for i, jchild := range jn.Children {
+		if jchild.Type != jsonLeaf {
+			return nil, fmt.Errorf("A stack can only contain leaves, "+
+				"not '%s'.", jchild.Type)
+		}
+		child, err := fromJSONNode(jchild, st, resolve)
+		if err != nil {
+			return nil, err
+		}
+		if child == nil {
+			continue
+		}
+		if i == jn.Active {
+			st.active = st.Size()
+		}
+		st.AddNode(child, true)
+	}
+
+	switch st.Size() {
+	case 0:
+		return nil, nil
+	case 1:
+		lf := st.leaves[0]
+		lf.SetParent(parent)
+		lf.SetProportion(st.Proportion())
+		lf.SetFixedSize(st.FixedSize())
+		return lf, nil
+	}
+	return st, nil
+}
+
+// fromJSONGrid decodes a grid. The cells of leaves that are dropped are left
+// empty, and a grid left without any leaves is dropped.
+func fromJSONGrid(jn *jsonNode, parent splitter,
+	resolve func(hint clientHint) Client) (node, error) {
+
+	if jn.Rows <= 0 || jn.Cols <= 0 {
+		return nil, fmt.Errorf("A grid cannot have %d rows and %d columns.",
+			jn.Rows, jn.Cols)
+	}
+	if len(jn.RowProps) != jn.Rows || len(jn.ColProps) != jn.Cols ||
+		len(jn.Children) != jn.Rows*jn.Cols {
+
+		return nil, fmt.Errorf("A %dx%d grid needs %d row proportions, %d "+
+			"column proportions and %d cells, but got %d, %d and %d.",
+			jn.Rows, jn.Cols, jn.Rows, jn.Cols, jn.Rows*jn.Cols,
+			len(jn.RowProps), len(jn.ColProps), len(jn.Children))
+	}
+
+	g := newGrid(jn.Rows, jn.Cols)
+	g.parent = parent
+	g.SetProportion(proportion(jn.Proportion))
+	g.SetFixedSize(jn.FixedPx)
+	for r, p := range jn.RowProps {
+		g.rowProps[r] = proportion(p)
+	}
+	for c, p := range jn.ColProps {
+		g.colProps[c] = proportion(p)
+	}
+	empty := true
+	for i, jcell := range jn.Children {
+		if jcell == nil {
+			continue
+		}
+		if jcell.Type != jsonLeaf {
+			return nil, fmt.Errorf("A grid can only contain leaves, "+
+				"not '%s'.", jcell.Type)
+		}
+		cell, err := fromJSONNode(jcell, g, resolve)
+		if err != nil {
+			return nil, err
+		}
+		if cell == nil {
+			continue
+		}
+		lf := cell.(*leaf)
+		lf.SetProportion(fullPortion)
+		g.cells[i/jn.Cols][i%jn.Cols] = lf
+		empty = false
+	}
+	if empty {
+		return nil, nil
+	}
+	return g, nil
+}
@@ -0,0 +1,193 @@
+package layout
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"github.com/BurntSushi/xgbutil/xrect"
+)
+
+// settledTree returns a tree with a node of every type and every setting
+// changed from its default, and its seven clients. The root is an hsplit of
+// a sticky leaf with a fixed size, a vsplit of a stack and a 2x2 grid with
+// an empty cell, and a labeled leaf.
+func settledTree() (*tree, []*fakeClient) {
+	cs := newFakes(7)
+	tr := newTree()
+	root := newHSplit(nil)
+	root.SetProportion(fullPortion)
+	tr.setChild(root)
+
+	first := newLeaf(root, cs[0])
+	first.SetSticky(true)
+	first.SetFixedSize(200)
+	root.AddNode(first, true)
+
+	v := newVSplit(root)
+	root.AddNode(v, true)
+	st := newStack(v)
+	st.AddNode(newLeaf(st, cs[1]), true)
+	st.AddNode(newLeaf(st, cs[2]), true)
+	st.active = 1
+	v.AddNode(st, true)
+	g := newGrid(2, 2)
+	g.SetParent(v)
+	g.setCell(0, 0, cs[3])
+	g.setCell(1, 0, cs[4])
+	g.setCell(1, 1, cs[5])
+	g.setColWeights([]int{2, 1})
+	g.setRowWeights([]int{1, 3})
+	v.AddNode(g, true)
+	st.SetProportion(0.35)
+	g.SetProportion(0.65)
+	v.minProp, v.maxProp = 0.1, 0.8
+	v.setAnchor(anchorEnd)
+
+	last := newLeaf(root, cs[6])
+	last.SetLabel("editor")
+	root.AddNode(last, true)
+	first.SetProportion(0.2)
+	v.SetProportion(0.45)
+	last.SetProportion(0.35)
+
+	tr.SetGaps(6, 3)
+	tr.SetStruts(20, 0, 0, 10)
+	tr.SetMinLeafSize(30)
+	tr.SetScale(1.25)
+	tr.SetScrollOverflow(true)
+	tr.SetStackFallback(false)
+	tr.SetFocusWrap(true)
+	tr.SetRoundMode(RoundFloor)
+	tr.SetRemovalPolicy(RemoveToNeighbor)
+	tr.SetDropCenter(0.25)
+	tr.SetMaxDepth(5)
+	tr.SetMaxChildren(6)
+	tr.SetSnapStep(0.05)
+	tr.SetRememberProportions(false)
+	return tr, cs
+}
+
+// resolveFakes returns a resolver that maps the window ids in client hints
+// to cs, except for the clients in drop.
+func resolveFakes(cs []*fakeClient, drop ...*fakeClient) func(
+	hint clientHint) Client {
+
+	return func(hint clientHint) Client {
+		id, err := strconv.Atoi(hint.Id)
+		if err != nil || id < 1 || id > len(cs) {
+			return nil
+		}
+		for _, c := range drop {
+			if c == cs[id-1] {
+				return nil
+			}
+		}
+		return cs[id-1]
+	}
+}
+
+// placedGeoms places tr in base and returns the geometry of each of cs.
+func placedGeoms(tr *tree, cs []*fakeClient, base xrect.Rect) []string {
+	tr.placeForce(base)
+	geoms := make([]string, len(cs))
+	for i, c := range cs {
+		geoms[i] = c.geomString()
+	}
+	return geoms
+}
+
+// checkSameGeoms fails the test unless tr and decoded place cs the same.
+func checkSameGeoms(t *testing.T, tr, decoded *tree, cs []*fakeClient) {
+	t.Helper()
+	base := xrect.New(0, 0, 1279, 1023)
+	want := placedGeoms(tr, cs, base)
+	got := placedGeoms(decoded, cs, base)
+	for i := range cs {
+		if got[i] != want[i] {
+			t.Fatalf("'%s' is at %s instead of %s after decoding.\n%s",
+				cs[i], got[i], want[i], decoded.dump())
+		}
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	tr, cs := settledTree()
+	checkValid(t, tr)
+	data, err := tr.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := unmarshalTree(data, resolveFakes(cs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkValid(t, decoded)
+
+	// Encoding the decoded tree again gives back the same settings and
+	// nodes.
+	again, err := decoded.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again, data) {
+		t.Fatalf("The tree was encoded as\n%s\nbut decoded as\n%s",
+			data, again)
+	}
+	checkSameGeoms(t, tr, decoded, cs)
+}
+
+func TestJSONGridCells(t *testing.T) {
+	tr, cs := settledTree()
+	data, err := tr.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The cell of a client that is gone is left empty, so that the other
+	// clients keep their cells.
+	decoded, err := unmarshalTree(data, resolveFakes(cs, cs[4]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkValid(t, decoded)
+	g, ok := decoded.findLeaf(cs[3]).Parent().(*grid)
+	if !ok {
+		t.Fatalf("'%s' is not in a grid.\n%s", cs[3], decoded.dump())
+	}
+	if g.cell(0, 0).client != cs[3] || g.cell(0, 1) != nil ||
+		g.cell(1, 0) != nil || g.cell(1, 1).client != cs[5] {
+
+		t.Fatalf("The grid has the wrong cells.\n%s", decoded.dump())
+	}
+
+	// A grid without any of its clients is dropped.
+	decoded, err = unmarshalTree(data,
+		resolveFakes(cs, cs[3], cs[4], cs[5]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkValid(t, decoded)
+	if _, ok := decoded.findLeaf(cs[1]).Parent().(*stack); !ok {
+		t.Fatalf("'%s' is not in a stack.\n%s", cs[1], decoded.dump())
+	}
+	if _, ok := decoded.findLeaf(cs[1]).Parent().Parent().(*hsplit); !ok {
+		t.Fatalf("The grid was not dropped.\n%s", decoded.dump())
+	}
+}
+
+func TestJSONDefaults(t *testing.T) {
+	// A tree saved before its settings were serialized.
+	data := []byte(`{"inner_gap": 4, "outer_gap": 2, "root": null}`)
+	decoded, err := unmarshalTree(data, resolveFakes(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := json.Marshal(toJSONTree(newTree()))
+	decoded.innerGap, decoded.outerGap = 0, 0
+	if got, _ := decoded.MarshalJSON(); !bytes.Equal(got, want) {
+		t.Fatalf("The settings of the tree are\n%s\ninstead of\n%s",
+			got, want)
+	}
+}
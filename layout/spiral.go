@@ -0,0 +1,81 @@
+package layout
+
+// newSpiral creates a tree that arranges clients in a Fibonacci spiral: the
+// first client takes the golden-ratio share of the screen on the left, the
+// second takes the same share of what is left on the top, the third on the
+// right, the fourth on the bottom, and so on, with the splits alternating
+// between hsplits and vsplits. The last client fills what is left.
+func newSpiral(clients []Client) *tree {
+	t := newTree()
+	for _, c := range clients {
+		t.spiralLeaf(c)
+	}
+	return t
+}
+
+// extendSpiral adds c to the end of a spiral created by newSpiral, by
+// splitting the innermost leaf the way the next level of the spiral would.
+// The tree is placed again afterwards.
+func (t *tree) extendSpiral(c Client) {
+	t.mutate("extendSpiral", func() bool {
+		t.spiralLeaf(c)
+		t.replace()
+		return true
+	})
+}
+
+// spiralLeaf adds c to the end of the spiral. The innermost leaf (or stack)
+// is found by always descending into the child that the spiral continues
+// into, which is the second child on the first two turns of every round and
+// the first child on the last two. If the spiral would get deeper than the
+// tree's maximum depth, c is stacked with the innermost leaf instead.
+func (t *tree) spiralLeaf(c Client) {
+	added := newLeaf(nil, c)
+	if t.child == nil {
+		t.setChild(added)
+		return
+	}
+
+	n, level := t.child, 0
+	for s := asSplit(n); s != nil && s.Size() > 0; s = asSplit(n) {
+		if spiralsForward(level) {
+			n = s.children[s.Size()-1]
+		} else {
+			n = s.children[0]
+		}
+		level++
+	}
+	if level+1 > t.maxDepth {
+		t.stackLeaf(firstLeaf(n), added)
+		return
+	}
+
+	var s splitter
+	if level%2 == 0 {
+		s = newHSplit(nil)
+	} else {
+		s = newVSplit(nil)
+	}
+	s.SetProportion(n.Proportion())
+	s.SetFixedSize(n.FixedSize())
+	t.substitute(n, s)
+
+	ratio := goldenRatio()
+	n.SetParent(s)
+	n.SetFixedSize(0)
+	n.SetProportion(ratio[0])
+	added.SetParent(s)
+	added.SetProportion(ratio[1])
+	if spiralsForward(level) {
+		asSplit(s).children = []node{n, added}
+	} else {
+		asSplit(s).children = []node{added, n}
+	}
+}
+
+// spiralsForward returns true if the split at the given level of a spiral
+// continues into its second child (rightward or downward), and false if it
+// continues into its first child (leftward or upward).
+func spiralsForward(level int) bool {
+	return level%4 < 2
+}
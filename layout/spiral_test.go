@@ -0,0 +1,52 @@
+package layout
+
+import (
+	"testing"
+
+	"github.com/BurntSushi/xgbutil/xrect"
+)
+
+func TestSpiral(t *testing.T) {
+	cs := newFakes(5)
+	clients := make([]Client, 4)
+	for i := range clients {
+		clients[i] = cs[i]
+	}
+	tr := newSpiral(clients)
+	tr.extendSpiral(cs[4])
+	checkValid(t, tr)
+
+	// Follow the spiral inwards. Its splits alternate between hsplits and
+	// vsplits.
+	n, level := tr.child, 0
+	for s := asSplit(n); s != nil; s = asSplit(n) {
+		if isHorizontal(n) != (level%2 == 0) {
+			t.Fatalf("The split at level %d has the wrong orientation.\n%s",
+				level, tr.dump())
+		}
+		if spiralsForward(level) {
+			n = s.children[1]
+		} else {
+			n = s.children[0]
+		}
+		level++
+	}
+	if level != len(cs)-1 {
+		t.Fatalf("The spiral is %d levels deep instead of %d.\n%s",
+			level, len(cs)-1, tr.dump())
+	}
+
+	// The first four clients are on the left, top, right and bottom of what
+	// is left, with the golden ratio of it.
+	tr.place(xrect.New(0, 0, 1000, 1000))
+	left, top, right, bottom := cs[0], cs[1], cs[2], cs[3]
+	if left.x != 0 || left.w != 618 || top.x != 618 || top.h != 618 ||
+		right.y != 618 || right.x+right.w != 1000 ||
+		bottom.y+bottom.h != 1000 || bottom.x != 618 {
+
+		t.Fatalf("The clients are at %v.\n%s", geomsOf(cs), tr.dump())
+	}
+	if !tr.undo() || tr.leafCount() != 4 {
+		t.Fatalf("Undo didn't take back the fifth client.\n%s", tr.dump())
+	}
+}
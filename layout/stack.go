@@ -0,0 +1,260 @@
+package layout
+
+import (
+	"fmt"
+
+	"github.com/BurntSushi/xgbutil/xrect"
+
+	"github.com/cshapeshifter/wingo/misc"
+)
+
+// stack is a node that holds several leaves in the same cell, like a tabbed
+// container. Every leaf is given the geometry of the whole stack, but only
+// the active one is mapped.
+//
+// A stack implements splitter so that its leaves can use it as their parent,
+// but it is not a split: asSplit returns nil for a stack, and the
+// proportions of its leaves are meaningless.
+type stack struct {
+	geomCache
+
+	parent node
+	leaves []*leaf
+	active int
+	prop   proportion
+
+	// fixedPx is the number of pixels that the stack is given along the axis
+	// of its parent, or zero if it shares the space proportionally.
+	fixedPx int
+}
+
+func newStack(parent node) *stack {
+	return &stack{
+		parent: parent,
+		leaves: make([]*leaf, 0),
+	}
+}
+
+// stackWith adds newClient to the cell of the leaf containing target, as a
+// new tab that becomes the active one. If that leaf is already in a stack,
+// newClient is added to that stack. Otherwise, the leaf is replaced by a new
+// stack that inherits its proportion. The tree is placed again afterwards.
+func (t *tree) stackWith(target, newClient Client) error {
+	return t.mutateErr("stackWith", func() error {
+		lf := t.findLeaf(target)
+		if lf == nil {
+			return fmt.Errorf("Client '%s' is not in the tree.", target)
+		}
+		if _, ok := lf.parent.(*grid); ok {
+			return fmt.Errorf("Client '%s' is in a grid, whose cells "+
+				"cannot be stacked.", target)
+		}
+		t.stackLeaf(lf, newLeaf(nil, newClient))
+		t.replace()
+		return nil
+	})
+}
+
+// stackLeaf adds the leaf added to the stack containing lf as the active tab,
+// first replacing lf with a new stack if it isn't in one.
+func (t *tree) stackLeaf(lf, added *leaf) {
+	st, ok := lf.parent.(*stack)
+	if !ok {
+		st = newStack(nil)
+		st.SetProportion(lf.Proportion())
+		st.SetFixedSize(lf.FixedSize())
+		lf.SetFixedSize(0)
+		t.substitute(lf, st)
+		st.AddNode(lf, true)
+	}
+	st.AddNode(added, true)
+	st.active = len(st.leaves) - 1
+}
+
+// activeLeaf returns the leaf of the active tab, or nil if st is empty.
+func (st *stack) activeLeaf() *leaf {
+	if len(st.leaves) == 0 {
+		return nil
+	}
+	return st.leaves[st.active]
+}
+
+// selectNext makes the tab after the active one active, wrapping around to
+// the first tab. The stack must be placed again to show the new tab.
+func (st *stack) selectNext() {
+	if len(st.leaves) == 0 {
+		return
+	}
+	st.active = misc.Mod(st.active+1, len(st.leaves))
+	markDirty(st)
+}
+
+// selectPrev makes the tab before the active one active, wrapping around to
+// the last tab. The stack must be placed again to show the new tab.
+func (st *stack) selectPrev() {
+	if len(st.leaves) == 0 {
+		return
+	}
+	st.active = misc.Mod(st.active-1, len(st.leaves))
+	markDirty(st)
+}
+
+// MoveResize gives every leaf in the stack the same geometry, and maps only
+// the active one.
+func (st *stack) MoveResize(t *tree, x, y, width, height int) {
+	for _, lf := range st.leaves {
+		t.moveNode(lf, xrect.New(x, y, width, height))
+	}
+	st.showActive(t)
+}
+
+// showActive maps the client of the active leaf and unmaps the others.
+func (st *stack) showActive(t *tree) {
+	for i, lf := range st.leaves {
+		if i == st.active {
+			t.show(lf.client)
+		} else {
+			t.hide(lf.client)
+		}
+	}
+}
+
+func (st *stack) String() string {
+	if lf := st.activeLeaf(); lf != nil {
+		return fmt.Sprintf("stack with %d clients, showing '%s' [%f]",
+			len(st.leaves), lf.client, st.prop)
+	}
+	return fmt.Sprintf("stack with no clients [%f]", st.prop)
+}
+
+func (st *stack) Proportion() proportion {
+	return st.prop
+}
+
+func (st *stack) SetProportion(p proportion) {
+	st.prop = p
+	markDirty(st)
+}
+
+func (st *stack) FixedSize() int {
+	return st.fixedPx
+}
+
+func (st *stack) SetFixedSize(px int) {
+	st.fixedPx = px
+}
+
+func (st *stack) Parent() node {
+	return st.parent
+}
+
+// activeClient returns the client of the tab that is shown.
+func (st *stack) activeClient() (Client, bool) {
+	if lf := st.activeLeaf(); lf != nil {
+		return lf.client, true
+	}
+	return nil, false
+}
+
+func (st *stack) SetParent(n node) {
+	st.parent = n
+}
+
+func (st *stack) ValidDims(t *tree, w, h, minw, minh, maxw, maxh int) bool {
+	_, bad := st.validDimsReason(t, w, h, minw, minh, maxw, maxh)
+	return bad == nil
+}
+
+// validDimsReason only checks the active leaf, since it is the only one that
+// can be seen.
+func (st *stack) validDimsReason(t *tree,
+	w, h, minw, minh, maxw, maxh int) (bool, *leaf) {
+
+	if lf := st.activeLeaf(); lf != nil {
+		return lf.validDimsReason(t, w, h, minw, minh, maxw, maxh)
+	}
+	return false, nil
+}
+
+// MinSize for a stack is the minimum size of its active leaf.
+func (st *stack) MinSize(t *tree) (width, height int) {
+	if lf := st.activeLeaf(); lf != nil {
+		return lf.MinSize(t)
+	}
+	return 0, 0
+}
+
+func (st *stack) VisitLeafNodes(f func(lf *leaf) bool) bool {
+	for _, lf := range st.leaves {
+		if !f(lf) {
+			return false
+		}
+	}
+	return true
+}
+
+func (st *stack) VisitLeafNodesReverse(f func(lf *leaf) bool) bool {
+	for i := len(st.leaves) - 1; i >= 0; i-- {
+		if !f(st.leaves[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// AddNode adds a leaf to the stack. The active tab doesn't change. It panics
+// if n isn't a leaf, since a stack can only hold leaves.
+func (st *stack) AddNode(n node, last bool) {
+	lf, ok := n.(*leaf)
+	if !ok {
+		panic(fmt.Sprintf("Only leaves can be stacked, not %T.", n))
+	}
+	lf.SetParent(st)
+	lf.SetProportion(fullPortion)
+	if last || len(st.leaves) == 0 {
+		st.leaves = append(st.leaves, lf)
+		return
+	}
+	st.leaves = append([]*leaf{lf}, st.leaves...)
+	st.active++
+}
+
+// RemoveNode removes a leaf from the stack. If it was the active tab, the
+// tab before it becomes active, or the tab after it if it was the first one.
+// Note that the client of the removed leaf is left as it is, which means it
+// stays unmapped if it wasn't active.
+func (st *stack) RemoveNode(n node) error {
+	i := st.ChildIndex(n)
+	if i < 0 {
+		return fmt.Errorf("The node '%s' is not in the stack '%s'.", n, st)
+	}
+	st.leaves = append(st.leaves[:i], st.leaves[i+1:]...)
+	if i <= st.active {
+		st.active = misc.Max(0, st.active-1)
+	}
+	return nil
+}
+
+// SetChildProportion is a no-op, since every leaf fills the whole stack.
+func (st *stack) SetChildProportion(n node, newProp proportion) {}
+
+func (st *stack) Size() int {
+	return len(st.leaves)
+}
+
+func (st *stack) Child(i int) node {
+	return st.leaves[i]
+}
+
+func (st *stack) ChildIndex(n node) int {
+	for i, lf := range st.leaves {
+		if lf == n {
+			return i
+		}
+	}
+	return -1
+}
+
+func (st *stack) PropsSave()     {}
+func (st *stack) PropsRollback() {}
+func (st *stack) PropsClear()    {}
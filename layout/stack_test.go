@@ -0,0 +1,62 @@
+package layout
+
+import "testing"
+
+// tabs returns a stack with a tab for each of cs, in that order, and the
+// given tab active.
+func tabs(cs []*fakeClient, active int) *stack {
+	st := newStack(nil)
+	for _, c := range cs {
+		st.AddNode(newLeaf(nil, c), true)
+	}
+	st.active = active
+	return st
+}
+
+func TestStackRemoveNode(t *testing.T) {
+	cs := newFakes(3)
+	tests := []struct {
+		name           string
+		active, remove int
+		want           Client
+	}{
+		{"active", 1, 1, cs[0]},
+		{"active first", 0, 0, cs[1]},
+		{"active last", 2, 2, cs[1]},
+		{"earlier", 2, 0, cs[2]},
+		{"later", 0, 2, cs[0]},
+	}
+	for _, test := range tests {
+		st := tabs(cs, test.active)
+		if err := st.RemoveNode(st.Child(test.remove)); err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if got, _ := st.activeClient(); got != test.want {
+			t.Errorf("%s: '%s' is active instead of '%s'.", test.name, got,
+				test.want)
+		}
+	}
+}
+
+func TestStackRemoveAll(t *testing.T) {
+	st := tabs(newFakes(3), 1)
+	for st.Size() > 0 {
+		if err := st.RemoveNode(st.activeLeaf()); err != nil {
+			t.Fatal(err)
+		}
+		if st.Size() > 0 && (st.active < 0 || st.active >= st.Size()) {
+			t.Fatalf("The active tab %d is not one of %d tabs.", st.active,
+				st.Size())
+		}
+	}
+	if _, ok := st.activeClient(); ok {
+		t.Fatal("An empty stack has an active client.")
+	}
+}
+
+func TestStackRemoveMissing(t *testing.T) {
+	st := tabs(newFakes(2), 0)
+	if err := st.RemoveNode(newLeaf(nil, newFake(3))); err == nil {
+		t.Fatal("Removing a leaf that isn't in the stack succeeded.")
+	}
+}
@@ -0,0 +1,177 @@
+package layout
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+// A named layout (or layout template) is the arrangement of a tree saved to
+// disk with saveLayout, so that it can be recalled later with loadLayout,
+// on any workspace. Templates are stored as JSON (see MarshalJSON), one file
+// per name, in layoutDir.
+
+// layoutDir is the directory that named layouts are stored in. If it is
+// empty, $XDG_DATA_HOME/wingo/layouts is used, or
+// $HOME/.local/share/wingo/layouts if XDG_DATA_HOME isn't set.
+var layoutDir = ""
+
+// clientMatcher picks the client among candidates that belongs in a leaf
+// with the given hint when a named layout is loaded, or returns nil if none
+// of them does.
+type clientMatcher func(hint clientHint, candidates []Client) Client
+
+// SetClientMatcher makes loadLayout and UnmarshalBinary use match to find
+// the clients of the leaves of a decoded layout. A nil match restores the
+// default (see matchClient).
+func (t *tree) SetClientMatcher(match clientMatcher) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.matcher = match
+}
+
+// matchClient is the default clientMatcher. The client with the same
+// identifier is preferred, which only exists if the layout was saved in the
+// same session. Otherwise, a client with the same class and title is picked,
+// and finally one with just the same class (or instance, if the class is
+// the same for everything made by a toolkit).
+func matchClient(hint clientHint, candidates []Client) Client {
+	for _, c := range candidates {
+		if clientIdent(c) == hint.Id {
+			return c
+		}
+	}
+	tests := []func(h clientHint) bool{
+		func(h clientHint) bool {
+			return h.Class == hint.Class && h.Title == hint.Title
+		},
+		func(h clientHint) bool {
+			return h.Class == hint.Class && h.Instance == hint.Instance
+		},
+		func(h clientHint) bool {
+			return h.Class == hint.Class
+		},
+	}
+	for _, test := range tests {
+		for _, c := range candidates {
+			if test(hintOf(c)) {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// clientResolver returns a resolver that gives the leaves of a decoded tree
+// the tiled clients of the tree, using its clientMatcher. Every client is
+// given to one leaf at most, and unmatched returns the clients that haven't
+// been given to any leaf yet.
+func (t *tree) clientResolver() (resolve func(hint clientHint) Client,
+	unmatched func() []Client) {
+
+	match := t.matcher
+	if match == nil {
+		match = matchClient
+	}
+	candidates := t.clients()
+	resolve = func(hint clientHint) Client {
+		c := match(hint, candidates)
+		for i, candidate := range candidates {
+			if candidate == c {
+				candidates = append(candidates[:i], candidates[i+1:]...)
+				return c
+			}
+		}
+		return nil
+	}
+	unmatched = func() []Client {
+		return candidates
+	}
+	return resolve, unmatched
+}
+
+// layoutPath returns the file that the named layout is stored in.
+func layoutPath(name string) (string, error) {
+	if len(name) == 0 || strings.ContainsAny(name, "/\x00") ||
+		name[0] == '.' {
+
+		return "", fmt.Errorf("'%s' is not a valid layout name.", name)
+	}
+
+	dir := layoutDir
+	if len(dir) == 0 {
+		xdgData := os.Getenv("XDG_DATA_HOME")
+		home := os.Getenv("HOME")
+		if len(xdgData) > 0 && strings.HasPrefix(xdgData, "/") {
+			dir = path.Join(xdgData, "wingo", "layouts")
+		} else if len(home) > 0 && strings.HasPrefix(home, "/") {
+			dir = path.Join(home, ".local", "share", "wingo", "layouts")
+		} else {
+			return "", fmt.Errorf("Could not find a directory for layouts "+
+				"in XDG_DATA_HOME ('%s') or HOME ('%s').", xdgData, home)
+		}
+	}
+	return path.Join(dir, name+".json"), nil
+}
+
+// saveLayout stores the arrangement of the tree under name, replacing any
+// layout that was saved under that name before.
+func (t *tree) saveLayout(name string) error {
+	fpath, err := layoutPath(name)
+	if err != nil {
+		return err
+	}
+	data, err := t.marshalJSON()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(path.Dir(fpath), 0777); err != nil {
+		return fmt.Errorf("Could not create directory '%s': %s",
+			path.Dir(fpath), err)
+	}
+	if err := ioutil.WriteFile(fpath, data, 0666); err != nil {
+		return fmt.Errorf("Could not save layout '%s': %s", name, err)
+	}
+	return nil
+}
+
+// loadLayout rearranges the tiled clients of the tree into the layout saved
+// under name. Every leaf of the layout is given one of the clients with the
+// tree's clientMatcher. Leaves that don't match any client are left out,
+// and their siblings share their space. Clients that don't match any leaf
+// are added beside the active client afterwards. The gaps of the tree are
+// left as they are. The tree is placed again afterwards.
+//
+// An error is returned if the layout can't be read, in which case the tree
+// isn't changed.
+func (t *tree) loadLayout(name string) error {
+	fpath, err := layoutPath(name)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return fmt.Errorf("Could not load layout '%s': %s", name, err)
+	}
+
+	resolve, unmatched := t.clientResolver()
+	loaded, err := unmarshalTree(data, resolve)
+	if err != nil {
+		return fmt.Errorf("Could not load layout '%s': %s", name, err)
+	}
+
+	return t.mutateErr("loadLayout", func() error {
+		t.unmonocled, t.selection = nil, nil
+		t.setChild(loaded.child)
+		for _, c := range unmatched() {
+			if err := t.tileBesideActive(c); err != nil {
+				return err
+			}
+		}
+		t.replace()
+		return nil
+	})
+}
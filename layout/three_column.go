@@ -0,0 +1,39 @@
+package layout
+
+// defaultCenterProportion is the proportion given to the center column of a
+// tree created by newThreeColumn when the requested proportion is invalid.
+const defaultCenterProportion proportion = 0.5
+
+// newThreeColumn creates a tree for wide screens: an hsplit with left,
+// center and right as its children. The center client is given centerProp,
+// and the sides share the rest evenly. If centerProp isn't strictly between
+// zero and fullPortion, defaultCenterProportion is used instead.
+//
+// A nil client is left out, in which case the remaining clients still get
+// the proportions they would have had, scaled to fill the screen.
+func newThreeColumn(left, center, right Client, centerProp proportion) *tree {
+	if centerProp <= 0 || centerProp >= fullPortion {
+		centerProp = defaultCenterProportion
+	}
+	side := (fullPortion - centerProp) / 2
+
+	t := newTree()
+	root := newHSplit(nil)
+	root.SetProportion(fullPortion)
+	t.setChild(root)
+
+	columns := []struct {
+		client Client
+		prop   proportion
+	}{{left, side}, {center, centerProp}, {right, side}}
+	for _, col := range columns {
+		if col.client == nil {
+			continue
+		}
+		lf := newLeaf(root, col.client)
+		lf.SetProportion(col.prop)
+		root.children = append(root.children, lf)
+	}
+	root.normalize()
+	return t
+}
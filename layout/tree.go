@@ -3,46 +3,385 @@ package layout
 import (
 	"fmt"
 	"math"
+	"strings"
+	"sync"
+
+	"github.com/BurntSushi/xgb/xproto"
 
 	"github.com/BurntSushi/xgbutil/xrect"
 
+	"github.com/cshapeshifter/wingo/logger"
 	"github.com/cshapeshifter/wingo/misc"
 )
 
 const (
 	fullPortion proportion = 1.0
 	epsilon                = 0.0001
+
+	// defaultMinProportion is the smallest proportion that an interactive
+	// resize will shrink a node to, and defaultMaxProportion is the largest
+	// that it will grow a node to.
+	defaultMinProportion proportion = 0.1
+	defaultMaxProportion proportion = 0.9
+
+	// defaultResizeThreshold is the smallest change in proportion that
+	// resizeChild makes. Smaller deltas are saved up until they reach it.
+	defaultResizeThreshold proportion = 0.002
+
+	// zoomSliver is the proportion that zoom leaves to each sibling of the
+	// zoomed node.
+	zoomSliver proportion = 0.01
+
+	// maxWeightTotal is the largest sum of weights that weights will use to
+	// approximate the proportions of a split.
+	maxWeightTotal = 100
+
+	// defaultMaxDepth is the default number of splits that a leaf can be
+	// nested in before new clients are stacked instead.
+	defaultMaxDepth = 8
+)
+
+// Proportion is the share of its parent split that a node is given, where
+// the shares of the children of a split add up to one.
+type Proportion float64
+
+// proportion is what Proportion is called within the package.
+type proportion = Proportion
+
+// NewProportion returns the proportion f. It is not checked, since a
+// proportion outside of zero and one can still be useful in arithmetic.
+func NewProportion(f float64) Proportion {
+	return Proportion(f)
+}
+
+// ProportionFromWeights returns the proportions that split something in the
+// ratio of the given weights, so that the weights 2, 1 and 1 give a half and
+// two quarters. Weights that aren't positive count as zero. If no weight is
+// positive, the proportions are all equal.
+func ProportionFromWeights(weights []int) []Proportion {
+	total := 0
+	for _, w := range weights {
+		if w > 0 {
+			total += w
+		}
+	}
+	props := make([]Proportion, len(weights))
+	for i, w := range weights {
+		switch {
+		case total == 0:
+			props[i] = fullPortion / Proportion(len(weights))
+		case w > 0:
+			props[i] = Proportion(w) / Proportion(total)
+		}
+	}
+	return props
+}
+
+// Portion takes a proportion of size.
+func (p Proportion) Portion(size int) int {
+	return p.portionBy(RoundNearest, size)
+}
+
+// portionBy takes a proportion of size, rounded with the given mode.
+func (p Proportion) portionBy(mode RoundMode, size int) int {
+	return mode.round(float64(proportion(size) * p))
+}
+
+// RoundMode is how the pixels that tiles are given are rounded, since a
+// proportion of a size is hardly ever a whole number of pixels. Whatever is
+// lost (or gained) by rounding always goes to the last tile of a split, but
+// some modes leave fewer 1px seams on some setups than others.
+type RoundMode int
+
+const (
+	// RoundNearest rounds to the nearest pixel, and halves up.
+	RoundNearest RoundMode = iota
+
+	// RoundFloor always rounds down.
+	RoundFloor
+
+	// RoundBankers rounds to the nearest pixel, and halves to the nearest
+	// even number of pixels.
+	RoundBankers
 )
 
-type proportion float64
+func (mode RoundMode) round(f float64) int {
+	switch mode {
+	case RoundFloor:
+		return int(math.Floor(f))
+	case RoundBankers:
+		floor := math.Floor(f)
+		switch diff := f - floor; {
+		case diff < 0.5:
+			return int(floor)
+		case diff > 0.5:
+			return int(floor) + 1
+		}
+		if math.Mod(floor, 2) == 0 {
+			return int(floor)
+		}
+		return int(floor) + 1
+	}
+	return misc.Round(f)
+}
 
-// portion takes a proportion of size.
-func (p proportion) portion(size int) int {
-	return misc.Round(float64(proportion(size) * p))
+// valid returns false if p is NaN or infinite, which can only be the result
+// of a bug (like dividing by the number of children of an empty split).
+func (p Proportion) valid() bool {
+	return !math.IsNaN(float64(p)) && !math.IsInf(float64(p), 0)
 }
 
-func (p1 proportion) equal(p2 proportion) bool {
+// Equal returns true if p1 and p2 are the same, give or take the error that
+// floating point arithmetic introduces.
+func (p1 Proportion) Equal(p2 Proportion) bool {
 	return math.Abs(float64(p1-p2)) < epsilon
 }
 
+// anchor is the edge of a child of a split that stays put when the child is
+// resized along the split, which decides the siblings that the space is
+// taken from (or given to).
+type anchor int
+
+const (
+	// anchorStart keeps the first edge of the child in place, so that the
+	// sibling after it makes up the difference.
+	anchorStart anchor = iota
+
+	// anchorCenter keeps the child centered, so that the difference is
+	// split evenly between the siblings before and after it.
+	anchorCenter
+
+	// anchorEnd keeps the last edge of the child in place, so that the
+	// sibling before it makes up the difference.
+	anchorEnd
+)
+
+// direction is used to specify which way an operation on the tree should
+// move relative to some node.
+type direction int
+
+const (
+	dirLeft direction = iota
+	dirRight
+	dirUp
+	dirDown
+)
+
+// horizontal returns true if the direction moves along the x-axis.
+func (dir direction) horizontal() bool {
+	return dir == dirLeft || dir == dirRight
+}
+
+// forward returns true if the direction moves toward the end of a split's
+// list of children.
+func (dir direction) forward() bool {
+	return dir == dirRight || dir == dirDown
+}
+
+// parseDirection returns the direction named by name, which is one of
+// "left", "right", "up" or "down" in any case.
+func parseDirection(name string) (direction, error) {
+	switch strings.ToLower(name) {
+	case "left":
+		return dirLeft, nil
+	case "right":
+		return dirRight, nil
+	case "up":
+		return dirUp, nil
+	case "down":
+		return dirDown, nil
+	}
+	return 0, fmt.Errorf("'%s' is not a direction. It must be one of Left, "+
+		"Right, Up or Down.", name)
+}
+
+// tree is safe for concurrent use through its exported methods, which take
+// the lock that it embeds: the write lock around anything that changes or
+// places the tree, and the read lock around anything that only reads it (see
+// locked.go). The unexported methods don't take the lock, since they call
+// each other freely (a mutation finds leaves and places the tree, and may run
+// other mutations) and a goroutine can't take a lock it already holds. Code
+// that calls them must hold the lock itself, which also lets it make several
+// changes at once; the layouts built on trees (like Vertical and Horizontal)
+// and the workspaces do so in every method. Hooks registered with the tree
+// and the step functions of animated placements run with the write lock
+// held, so they may only call unexported methods.
 type tree struct {
+	sync.RWMutex
+
 	child node
+
+	// innerGap is the number of pixels between adjacent tiles, and outerGap
+	// is the number of pixels between the tiles and the edge of the
+	// geometry given to place.
+	innerGap, outerGap int
+
+	// The struts are the number of pixels at each edge of the geometry given
+	// to place that are reserved by panels and docks. The outer gap is
+	// measured from the inside of the struts.
+	strutTop, strutRight, strutBottom, strutLeft int
+
+	// minLeafPx is the smallest width or height that any leaf is tiled at,
+	// regardless of what its client says.
+	minLeafPx int
+
+	// scale multiplies the gaps, minLeafPx and the fixed sizes of nodes when
+	// the tree is placed, so that they take up the same physical space on
+	// screens of different densities. The sizes of clients are already in
+	// the pixels of the screen, so they aren't scaled.
+	scale float64
+
+	// scrollOverflow makes a split whose children don't fit at minLeafPx
+	// show as many of them as fit at a time (see split.scroll), instead of
+	// stacking the rest in its last cell.
+	scrollOverflow bool
+
+	// stackFallback makes place turn a split that is too small for the
+	// minimum sizes of its clients into a stack, instead of giving up.
+	stackFallback bool
+
+	// focusWrap makes leafInDirection wrap around to the leaf at the other
+	// end of the tree when there is nothing in the given direction.
+	focusWrap bool
+
+	// roundMode is how divide rounds the pixels given to each tile.
+	roundMode RoundMode
+
+	// removalPolicy is which siblings of a node removed with removeNode get
+	// its share.
+	removalPolicy RemovalPolicy
+
+	// dropCenter is the fraction of the width and height of a tile that is
+	// its center zone for dropTarget.
+	dropCenter proportion
+
+	// maxDepth is the largest number of splits that splitLeaf and
+	// insertBeside will nest a leaf in. Beyond that, new clients are stacked.
+	maxDepth int
+
+	// maxChildren, when positive, is the largest number of children that
+	// addNode will give a split before nesting.
+	maxChildren int
+
+	// snapStep, when positive, is the step that proportions are snapped to
+	// after an interactive resize.
+	snapStep proportion
+
+	// geom is the geometry that the tree was last placed in, and drawn is
+	// the geometry that each client was given then.
+	geom  xrect.Rect
+	drawn map[Client]xrect.Rect
+
+	// lastDrawn is what drawn was before the placement in progress, so that
+	// the leaves whose clients already have the right geometry aren't moved
+	// again. It is nil if there is no placement in progress, or if every
+	// client must be moved. forced is set by placeForce.
+	lastDrawn map[Client]xrect.Rect
+	forced    bool
+
+	// dryRun makes placing the tree leave its clients alone: only drawn is
+	// updated, and nothing is moved, resized, mapped or unmapped. It is set
+	// on the copies of the tree made by preview.
+	dryRun bool
+
+	// anim is the last animated placement, which may still be in progress.
+	anim *animation
+
+	// floating holds the clients that belong to the layout but aren't tiled,
+	// like dialogs. They are left alone by place.
+	floating []Client
+
+	// placeHooks are called after every placement, in the order that they
+	// were registered with onPlace. lastHook is the id of the last one.
+	placeHooks []placeHook
+	lastHook   int
+
+	// shownHooks and hiddenHooks are called when the tree maps or unmaps a
+	// client (see onLeafShown and onLeafHidden). hidden holds the clients
+	// that the tree has unmapped. Any other client is assumed to be visible.
+	shownHooks, hiddenHooks []clientHook
+	hidden                  map[Client]bool
+
+	// masterCol and stackCol are only set for trees created with
+	// newMasterStack.
+	masterCol, stackCol *vsplit
+	masterProp          proportion
+
+	// unmonocled is the root from before the tree was turned into a monocle
+	// by toMonocle, or nil if the tree isn't a monocle.
+	unmonocled node
+
+	// selection is the stack or split selected with focusParent, or nil if
+	// only the active leaf is selected. selectedFor is the client that was
+	// active when it was selected (see selection.go).
+	selection   node
+	selectedFor Client
+
+	// undoStack and redoStack hold the states of the tree before each
+	// mutation that can be undone or redone. mutating is true while a
+	// mutation is running. snapSize is the number of nodes in the last
+	// snapshot, which the next one makes room for up front.
+	undoStack, redoStack []*snapshot
+	mutating             bool
+	parked               map[Client]bool
+	snapSize             int
+
+	// records is the history of mutations kept when recordMutations is set,
+	// as a ring buffer whose oldest record is at nextRecord once it is full.
+	records    []mutationRecord
+	nextRecord int
+
+	// remembered holds the proportions of clients whose leaves were removed,
+	// by window id, and rememberOrder the order they were remembered in,
+	// oldest first (see memory.go). rememberProps turns this on.
+	remembered    map[xproto.Window]proportion
+	rememberOrder []xproto.Window
+	rememberProps bool
+
+	// alive, when set, reports whether a client that isn't in the tree still
+	// exists. It is used to decide whether undo and redo can bring a client
+	// back into the tree.
+	alive func(c Client) bool
+
+	// matcher, when set, is used by loadLayout instead of matchClient.
+	matcher clientMatcher
 }
 
+// node is implemented by everything that can be placed in a tree. The tree
+// that a node belongs to is passed down through MoveResize, ValidDims and
+// MinSize so that nodes can use the tree's settings (like gaps).
+//
+// validDimsReason is like ValidDims, but it also returns the first leaf
+// that cannot be given valid dimensions (or nil if there is none) and whether
+// that leaf would be too small (as opposed to too large).
+//
+// VisitLeafNodes calls f on every leaf in the node in order, which is
+// depth-first in the order of each split's children (i.e., left to right in
+// hsplits and top to bottom in vsplits). VisitLeafNodesReverse visits the
+// same leaves in the opposite order. Both stop as soon as f returns false,
+// and return false if they were stopped.
 type node interface {
-	MoveResize(x, y, width, height int)
+	MoveResize(t *tree, x, y, width, height int)
 	Proportion() proportion
 	SetProportion(p proportion)
+	FixedSize() int
+	SetFixedSize(px int)
 	Parent() node
 	SetParent(n node)
-	ValidDims(w, h, minw, minh, maxw, maxh int) bool
+	ValidDims(t *tree, w, h, minw, minh, maxw, maxh int) bool
+	validDimsReason(t *tree, w, h, minw, minh, maxw, maxh int) (bool, *leaf)
+	MinSize(t *tree) (width, height int)
+	cache() *geomCache
+	activeClient() (Client, bool)
 	VisitLeafNodes(f func(lf *leaf) bool) bool
+	VisitLeafNodesReverse(f func(lf *leaf) bool) bool
+	String() string
 }
 
 type splitter interface {
 	node
 	AddNode(n node, last bool)
-	RemoveNode(n node)
+	RemoveNode(n node) error
 	SetChildProportion(n node, newProp proportion)
 	Size() int
 	Child(i int) node
@@ -62,206 +401,3637 @@ type vsplit struct {
 }
 
 type split struct {
+	geomCache
+
 	parent   node
 	children []node
 	prop     proportion
 	saved    []proportion
+	minProp  proportion
+	maxProp  proportion
+	anchor   anchor
+
+	// threshold is the smallest change that resizeChild makes, and pending
+	// is the sum of the deltas for pendingChild that were too small so far.
+	threshold    proportion
+	pending      proportion
+	pendingChild node
+
+	// fixedPx is the number of pixels that the split is given along the axis
+	// of its parent, or zero if it shares the space proportionally.
+	fixedPx int
+
+	// unzoomed holds the proportions of the children from before one of them
+	// was zoomed, or nil if no child is zoomed.
+	unzoomed []proportion
+
+	// scrollOffset is the index of the first child shown when the tree
+	// scrolls overflowing splits, and hiding is true if some children were
+	// hidden the last time the split was placed.
+	scrollOffset int
+	hiding       bool
+}
+
+type leaf struct {
+	geomCache
+
+	parent  splitter
+	client  Client
+	prop    proportion
+	fixedPx int
+
+	// label is an arbitrary name given to the leaf by the user, like
+	// "editor". It stays with the leaf when its client is replaced.
+	label string
+
+	// sticky leaves keep their proportion when their siblings are added,
+	// removed or balanced (see SetSticky).
+	sticky bool
+}
+
+func newTree() *tree {
+	return &tree{
+		child:         nil,
+		maxDepth:      defaultMaxDepth,
+		dropCenter:    defaultDropCenter,
+		scale:         1,
+		stackFallback: true,
+		rememberProps: true,
+		drawn:         make(map[Client]xrect.Rect),
+		hidden:        make(map[Client]bool),
+		parked:        make(map[Client]bool),
+	}
+}
+
+// placement is the outcome of placing a tree.
+type placement int
+
+const (
+	// placeOK means that every client in the tree was moved and resized.
+	placeOK placement = iota
+
+	// placeEmpty means that there are no clients in the tree to place.
+	placeEmpty
+
+	// placeNoGeom means that the tree hasn't been given a geometry yet.
+	placeNoGeom
+
+	// placeTooSmall means that the geometry is too small for the tree, either
+	// because a client would be smaller than its minimum size or because the
+	// outer gap leaves no room for the tiles at all.
+	placeTooSmall
+
+	// placeTooLarge means that a client would be larger than its maximum
+	// size.
+	placeTooLarge
+)
+
+func (p placement) String() string {
+	switch p {
+	case placeOK:
+		return "placed"
+	case placeEmpty:
+		return "empty tree"
+	case placeNoGeom:
+		return "no geometry"
+	case placeTooSmall:
+		return "too small"
+	case placeTooLarge:
+		return "too large"
+	}
+	return fmt.Sprintf("placement(%d)", int(p))
+}
+
+// place moves and resizes every client in the tree to fit in geom, and then
+// calls the callbacks registered with onPlace. Unless placeOK is returned,
+// nothing is moved, and the result says why: the tree is empty, geom is nil,
+// or the tree cannot fit in geom.
+func (t *tree) place(geom xrect.Rect) placement {
+	result := t.placeTree(geom)
+	t.firePlaced(result == placeOK)
+	return result
+}
+
+func (t *tree) placeTree(geom xrect.Rect) placement {
+	if geom == nil {
+		return placeNoGeom
+	}
+	if t.child == nil {
+		return placeEmpty
+	}
+	t.geom = geom
+
+	x, y, w, h := t.inset(geom)
+	if w <= 0 || h <= 0 {
+		return placeTooSmall
+	}
+	small, lf := t.child.validDimsReason(t, w, h, 1, 1, w, h)
+	for lf != nil && small && t.stackFallback && t.stackAround(lf) {
+		small, lf = t.child.validDimsReason(t, w, h, 1, 1, w, h)
+	}
+	if lf != nil {
+		if small {
+			minw, minh := t.minimumBase()
+			logger.Message.Printf("Could not place tiles since client "+
+				"'%s' would be too small. The layout needs at least %dx%d, "+
+				"but only has %dx%d.", lf.client, minw, minh,
+				geom.Width(), geom.Height())
+			return placeTooSmall
+		}
+		logger.Message.Printf("Could not place tiles since client '%s' "+
+			"would be %s.", lf.client, placeTooLarge)
+		return placeTooLarge
+	}
+	// The clients of an animation may be anywhere between two frames, so
+	// what was drawn before can't be trusted.
+	t.lastDrawn = t.drawn
+	if t.anim != nil || t.forced {
+		t.lastDrawn = nil
+	}
+	t.anim.cancel()
+	t.anim = nil
+	t.drawn = make(map[Client]xrect.Rect)
+	t.moveNode(t.child, xrect.New(x, y, w, h))
+	t.lastDrawn = nil
+	t.forgetHidden()
+	return placeOK
+}
+
+// placeForce is like place, except that every client is moved and resized,
+// even those that the tree already gave the same geometry the last time. It
+// should be used when clients may have been moved behind the tree's back.
+func (t *tree) placeForce(geom xrect.Rect) placement {
+	t.invalidate()
+	t.forced = true
+	defer func() { t.forced = false }()
+	return t.place(geom)
+}
+
+// minimumBase returns the smallest width and height of a geometry that the
+// tree can be placed in, i.e., for which ValidDims passes, including the
+// outer gap and the struts. This is the minimum size of the root of the tree
+// plus those, since divide gives every child its minimum size first and only
+// shares out what's left, whatever the proportions are. (0, 0) is returned
+// for an empty tree.
+func (t *tree) minimumBase() (w, h int) {
+	if t.child == nil {
+		return 0, 0
+	}
+	w, h = t.child.MinSize(t)
+	w += t.strutLeft + t.strutRight + 2*t.margin()
+	h += t.strutTop + t.strutBottom + 2*t.margin()
+	return w, h
+}
+
+// stackAround is the fallback for a tree that is too small for the minimum
+// size of the client of lf: the lowest split containing lf is replaced by a
+// stack of all of the leaves in it, showing the active client (if it is one
+// of them), so that at least that client is usable. The split's proportion
+// and fixed size are kept. stackAround returns false if lf isn't in a split.
+//
+// This isn't recorded as a mutation that can be undone, since undoing it
+// would just make the next placement do it again.
+func (t *tree) stackAround(lf *leaf) bool {
+	var n node = lf
+	if st, ok := lf.parent.(*stack); ok {
+		n = st
+	}
+	s := n.Parent()
+	if asSplit(s) == nil {
+		return false
+	}
+
+	st := newStack(nil)
+	st.SetProportion(s.Proportion())
+	st.SetFixedSize(s.FixedSize())
+	s.VisitLeafNodes(func(visit *leaf) bool {
+		visit.SetFixedSize(0)
+		st.AddNode(visit, true)
+		if visit.client.IsActive() {
+			st.active = st.Size() - 1
+		}
+		return true
+	})
+	t.substitute(s, st)
+	t.invalidate()
+	logger.Message.Printf("Stacking %d clients, since the split they "+
+		"were in is too small for '%s'.", st.Size(), lf.client)
+	return true
+}
+
+// geomOf returns the geometry that the client c would be given if the tree
+// were placed in base (without actually placing it). The geometry is computed
+// with childRects, just like MoveResize does, so it matches what place draws
+// exactly. false is returned if c isn't in the tree or if the tree cannot be
+// placed in base.
+func (t *tree) geomOf(c Client, base xrect.Rect) (xrect.Rect, bool) {
+	lf := t.findLeaf(c)
+	if lf == nil || base == nil {
+		return nil, false
+	}
+	x, y, w, h := t.inset(base)
+	if w <= 0 || h <= 0 {
+		return nil, false
+	}
+	if _, bad := t.child.validDimsReason(t, w, h, 1, 1, w, h); bad != nil {
+		return nil, false
+	}
+
+	// Collect the path from the root of the tree down to lf, and then walk
+	// it to narrow down the geometry one level at a time.
+	var path []node
+	for n := node(lf); n != nil; n = n.Parent() {
+		path = append([]node{n}, path...)
+	}
+	if path[0] != t.child {
+		return nil, false
+	}
+	var geom xrect.Rect = xrect.New(x, y, w, h)
+	for i := 1; i < len(path); i++ {
+		parent, ok := path[i-1].(splitter)
+		if !ok {
+			return nil, false
+		}
+		rects := childRects(t, parent,
+			geom.X(), geom.Y(), geom.Width(), geom.Height())
+		ci := parent.ChildIndex(path[i])
+		if ci < 0 || ci >= len(rects) {
+			return nil, false
+		}
+		geom = rects[ci]
+	}
+	return lf.fit(geom), true
+}
+
+// eachLeafGeom calls f with every client in the tree and the geometry that
+// it would be given if the tree were placed in base, in the order of
+// VisitLeafNodes. It is like calling geomOf for every client, but only walks
+// the tree once. It stops as soon as f returns false, and doesn't call f at
+// all if the tree cannot be placed in base.
+func (t *tree) eachLeafGeom(base xrect.Rect,
+	f func(c Client, r xrect.Rect) bool) {
+
+	if t.child == nil || base == nil {
+		return
+	}
+	x, y, w, h := t.inset(base)
+	if w <= 0 || h <= 0 {
+		return
+	}
+	if _, bad := t.child.validDimsReason(t, w, h, 1, 1, w, h); bad != nil {
+		return
+	}
+	eachNodeGeom(t, t.child, xrect.New(x, y, w, h), f)
+}
+
+func eachNodeGeom(t *tree, n node, geom xrect.Rect,
+	f func(c Client, r xrect.Rect) bool) bool {
+
+	if lf, ok := n.(*leaf); ok {
+		return f(lf.client, lf.fit(geom))
+	}
+	s, ok := n.(splitter)
+	if !ok {
+		return true
+	}
+	rects := childRects(t, n, geom.X(), geom.Y(), geom.Width(), geom.Height())
+	for i, r := range rects {
+		if !eachNodeGeom(t, s.Child(i), r, f) {
+			return false
+		}
+	}
+	return true
+}
+
+// placeHook is a callback registered with onPlace.
+type placeHook struct {
+	id int
+	f  func(placed bool)
+}
+
+// onPlace registers f to be called at the end of every placement of the tree,
+// with placed set to whether any clients were actually moved. (They aren't
+// if the tree is empty or doesn't fit.) The returned function unregisters f.
+func (t *tree) onPlace(f func(placed bool)) (unsubscribe func()) {
+	t.lastHook++
+	id := t.lastHook
+	t.placeHooks = append(t.placeHooks, placeHook{id, f})
+	return func() {
+		for i, hook := range t.placeHooks {
+			if hook.id == id {
+				t.placeHooks = append(t.placeHooks[:i], t.placeHooks[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func (t *tree) firePlaced(placed bool) {
+	// Copy the hooks, since a hook may unsubscribe itself.
+	for _, hook := range append([]placeHook{}, t.placeHooks...) {
+		hook.f(placed)
+	}
+}
+
+// clientHook is a callback registered with onLeafShown or onLeafHidden.
+type clientHook struct {
+	id int
+	f  func(c Client)
+}
+
+// onLeafShown registers f to be called whenever placing the tree maps a
+// client that the tree had unmapped, like a tab of a stack that becomes
+// active or a child of a split that is scrolled into view. The returned
+// function unregisters f.
+func (t *tree) onLeafShown(f func(c Client)) (unsubscribe func()) {
+	return t.addClientHook(&t.shownHooks, f)
+}
+
+// onLeafHidden registers f to be called whenever placing the tree unmaps a
+// client that was visible, like a tab of a stack that is no longer active.
+// A client that stays hidden only calls f once. The returned function
+// unregisters f.
+func (t *tree) onLeafHidden(f func(c Client)) (unsubscribe func()) {
+	return t.addClientHook(&t.hiddenHooks, f)
+}
+
+func (t *tree) addClientHook(hooks *[]clientHook,
+	f func(c Client)) (unsubscribe func()) {
+
+	t.lastHook++
+	id := t.lastHook
+	*hooks = append(*hooks, clientHook{id, f})
+	return func() {
+		for i, hook := range *hooks {
+			if hook.id == id {
+				*hooks = append((*hooks)[:i], (*hooks)[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// isVisible returns true if c is in the tree and is drawn when the tree is
+// placed: its leaf must be the active tab of the stack it is in (which is the
+// root of a monocle), and it must not have been scrolled out of view in a
+// split whose children overflow (see split.scroll). Floating clients aren't
+// in the tree, so they are never visible as far as it is concerned.
+func (t *tree) isVisible(c Client) bool {
+	lf := t.findLeaf(c)
+	if lf == nil {
+		return false
+	}
+	var child node = lf
+	for p := lf.Parent(); p != nil; child, p = p, p.Parent() {
+		if st, ok := p.(*stack); ok && st.activeLeaf() != child {
+			return false
+		}
+		s := asSplit(p)
+		if s == nil || !s.hiding {
+			continue
+		}
+		r, cell := child.cache().rect, p.cache().rect
+		if r != nil && cell != nil && outside(r, cell) {
+			return false
+		}
+	}
+	return true
+}
+
+// show maps c, and calls the onLeafShown hooks if the tree had hidden it.
+func (t *tree) show(c Client) {
+	if !t.dryRun {
+		c.Map()
+	}
+	if !t.hidden[c] {
+		return
+	}
+	delete(t.hidden, c)
+	for _, hook := range append([]clientHook{}, t.shownHooks...) {
+		hook.f(c)
+	}
+}
+
+// hide unmaps c, and calls the onLeafHidden hooks if it wasn't hidden
+// already.
+func (t *tree) hide(c Client) {
+	if !t.dryRun {
+		c.Unmap()
+	}
+	if t.hidden[c] {
+		return
+	}
+	t.hidden[c] = true
+	for _, hook := range append([]clientHook{}, t.hiddenHooks...) {
+		hook.f(c)
+	}
+}
+
+// forgetHidden stops tracking whether clients that have left the tree are
+// hidden, so that they start out as visible if they ever come back.
+func (t *tree) forgetHidden() {
+	if len(t.hidden) == 0 {
+		return
+	}
+	present := make(map[Client]bool)
+	for _, c := range t.clients() {
+		present[c] = true
+	}
+	for c := range t.hidden {
+		if !present[c] {
+			delete(t.hidden, c)
+		}
+	}
+}
+
+// inset returns the geometry given to the root of the tree when the tree is
+// placed in geom.
+func (t *tree) inset(geom xrect.Rect) (x, y, w, h int) {
+	x, y, w, h = geom.X(), geom.Y(), geom.Width(), geom.Height()
+	x, y = x+t.strutLeft+t.margin(), y+t.strutTop+t.margin()
+	w -= t.strutLeft + t.strutRight + 2*t.margin()
+	h -= t.strutTop + t.strutBottom + 2*t.margin()
+	return
+}
+
+// setStruts reserves the given number of pixels at each edge of the geometry
+// that the tree is placed in, e.g., for the struts of panels, so that no tile
+// covers them. Negative values are treated as zero.
+func (t *tree) setStruts(top, right, bottom, left int) {
+	t.strutTop, t.strutRight = misc.Max(0, top), misc.Max(0, right)
+	t.strutBottom, t.strutLeft = misc.Max(0, bottom), misc.Max(0, left)
+	t.invalidate()
+}
+
+// SetMinLeafSize sets the smallest width or height, in pixels, that any leaf
+// will be tiled at. When a split is too small for all of its children to get
+// this size, the children that don't fit are stacked in the same cell.
+func (t *tree) SetMinLeafSize(px int) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.minLeafPx = misc.Max(0, px)
+	t.invalidate()
+}
+
+// SetScrollOverflow changes what happens when a split is too small for all
+// of its children to get the minimum leaf size: if on is true, the split
+// shows only as many children as fit, across its whole size, and the rest
+// are unmapped until the split is scrolled to them (see split.scroll).
+// Otherwise, the children that don't fit are stacked in the last cell.
+func (t *tree) SetScrollOverflow(on bool) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.scrollOverflow = on
+	t.invalidate()
+}
+
+// SetStackFallback changes what place does when the tree is too small for
+// the minimum sizes of its clients: if on is true (the default), the
+// offending splits are turned into stacks (see stackAround). Otherwise,
+// nothing is placed at all.
+func (t *tree) SetStackFallback(on bool) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.stackFallback = on
+	t.invalidate()
+}
+
+// SetFocusWrap changes what leafInDirection does at the edge of the tree: if
+// on is true, moving past the last leaf in a row or column wraps around to
+// the first one. Otherwise (the default), nothing is found, so that the caller
+// can move the focus to another monitor instead.
+func (t *tree) SetFocusWrap(on bool) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.focusWrap = on
+}
+
+// SetRoundMode sets how the pixels that tiles are given are rounded. The
+// default is RoundNearest.
+func (t *tree) SetRoundMode(mode RoundMode) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.roundMode = mode
+	t.invalidate()
+}
+
+// SetRemovalPolicy sets which siblings of a node that is removed from the
+// tree get its share of their split. The default is RemoveEven.
+func (t *tree) SetRemovalPolicy(policy RemovalPolicy) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.removalPolicy = policy
+}
+
+// SetMaxDepth sets the largest number of splits that a leaf may be nested in
+// by splitLeaf or insertBeside. When a new client would be nested any
+// deeper, it is stacked with the leaf it was meant to go beside instead.
+// Negative values are treated as zero.
+func (t *tree) SetMaxDepth(depth int) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.maxDepth = misc.Max(0, depth)
+}
+
+// SetSnapStep makes interactive resizes snap the proportions of the tree to
+// multiples of step afterwards (see snapProportions). A step of zero turns
+// snapping off.
+func (t *tree) SetSnapStep(step float64) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.snapStep = proportion(math.Max(0, step))
+}
+
+// SetMaxChildren sets the largest number of children that addNode will give
+// any split. Beyond that, children are nested in a split of the same
+// orientation. Values less than two mean that there is no limit.
+func (t *tree) SetMaxChildren(n int) {
+	t.Lock()
+	defer t.Unlock()
+
+	if n < 2 {
+		n = 0
+	}
+	t.maxChildren = n
+}
+
+// SetFixedSize makes n keep exactly px pixels (times the tree's scale) along
+// the axis of the split it is in, however the tree is resized. The other
+// children of that split share what is left proportionally, and nodes that
+// are added to or removed from it don't change n's share. A px of zero (or
+// less) clears the fixed size. The tree is placed again afterwards.
+func (t *tree) SetFixedSize(n node, px int) {
+	t.Lock()
+	defer t.Unlock()
+
+	n.SetFixedSize(misc.Max(0, px))
+	markDirty(n)
+	t.replace()
+}
+
+// depth returns the number of splits that n is nested in.
+func depth(n node) int {
+	d := 0
+	for p := n.Parent(); p != nil; p = p.Parent() {
+		if asSplit(p) != nil {
+			d++
+		}
+	}
+	return d
+}
+
+// clients returns the client of every leaf in the tree (including every tab
+// of a stack), in the order of VisitLeafNodes: left to right and top to
+// bottom. The order only changes when the tree does. Floating clients aren't
+// included; they can be appended from t.floating if they are wanted.
+func (t *tree) clients() []Client {
+	clients := make([]Client, 0)
+	if t.child == nil {
+		return clients
+	}
+	t.child.VisitLeafNodes(func(lf *leaf) bool {
+		clients = append(clients, lf.client)
+		return true
+	})
+	return clients
+}
+
+// leafCount returns the number of leaves in the tree (including every leaf
+// in a stack).
+func (t *tree) leafCount() int {
+	if t.child == nil {
+		return 0
+	}
+	return countLeaves(t.child)
+}
+
+// depth returns the number of levels of splits in the tree, which is the
+// largest number of splits that any leaf is nested in.
+func (t *tree) depth() int {
+	if t.child == nil {
+		return 0
+	}
+	return height(t.child)
+}
+
+// countLeaves returns the number of leaves in n. Like height, it walks the
+// tree directly rather than with VisitLeafNodes so that it doesn't allocate.
+func countLeaves(n node) int {
+	switch n := n.(type) {
+	case *leaf:
+		return 1
+	case *stack, *grid:
+		return n.(splitter).Size()
+	}
+	count := 0
+	if s := asSplit(n); s != nil {
+		for _, child := range s.children {
+			count += countLeaves(child)
+		}
+	}
+	return count
+}
+
+// height returns the number of levels of splits in n. It is zero for leaves,
+// stacks and grids.
+func height(n node) int {
+	s := asSplit(n)
+	if s == nil {
+		return 0
+	}
+	h := 0
+	for _, child := range s.children {
+		h = misc.Max(h, height(child))
+	}
+	return h + 1
+}
+
+// replace places the tree again in the geometry it was last placed in.
+// It is used after the structure of the tree is changed.
+func (t *tree) replace() placement {
+	return t.place(t.geom)
+}
+
+func (t *tree) setChild(n node) {
+	t.child = n
+}
+
+// SetGaps sets the number of pixels between adjacent tiles (inner) and
+// between the tiles and the edge of the screen (outer). Negative values are
+// treated as zero.
+func (t *tree) SetGaps(inner, outer int) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.innerGap, t.outerGap = misc.Max(0, inner), misc.Max(0, outer)
+	t.invalidate()
+}
+
+// SetScale sets the factor that the gaps, the minimum leaf size and fixed
+// sizes are multiplied by, e.g., 2 for a HiDPI screen. Proportions don't
+// depend on the scale. A scale that isn't positive is treated as 1.
+func (t *tree) SetScale(scale float64) {
+	t.Lock()
+	defer t.Unlock()
+
+	if scale <= 0 {
+		scale = 1
+	}
+	t.scale = scale
+	t.invalidate()
+}
+
+// px scales a size in pixels by the tree's scale, rounding to the nearest
+// pixel.
+func (t *tree) px(n int) int {
+	return int(math.Floor(float64(n)*t.scale + 0.5))
+}
+
+// gap returns the scaled number of pixels between adjacent tiles.
+func (t *tree) gap() int {
+	return t.px(t.innerGap)
+}
+
+// margin returns the scaled number of pixels between the tiles and the
+// edge of the geometry given to place.
+func (t *tree) margin() int {
+	return t.px(t.outerGap)
+}
+
+// minLeaf returns the scaled minimum leaf size.
+func (t *tree) minLeaf() int {
+	return t.px(t.minLeafPx)
+}
+
+// switchClients swaps the clients of two leaves. The leaves themselves stay
+// put, so anything attached to a leaf (rather than to its client) stays in
+// the same cell. Use swapLeaves to move the leaves themselves.
+func (t *tree) switchClients(lf1, lf2 *leaf) {
+	if lf1 == nil || lf2 == nil {
+		return
+	}
+	lf1.client, lf2.client = lf2.client, lf1.client
+	markDirty(lf1)
+	markDirty(lf2)
+}
+
+// floatClient takes c out of the tiled part of the tree and makes it a
+// floating client, leaving it at its current geometry. Its proportion is
+// given to its siblings as if it were removed. It returns false if c isn't
+// tiled in the tree. The tree is placed again afterwards.
+func (t *tree) floatClient(c Client) bool {
+	return t.mutate("floatClient", func() bool {
+		lf := t.findLeaf(c)
+		if lf == nil {
+			return false
+		}
+		if t.child == lf {
+			t.setChild(nil)
+		} else if err := t.removeNode(lf); err != nil {
+			logger.Warning.Println(err)
+			return false
+		}
+		t.floating = append(t.floating, c)
+		delete(t.drawn, c)
+		t.replace()
+		return true
+	})
+}
+
+// tileClient puts the floating client c back into the tiled part of the
+// tree, beside the leaf of the active client (or the last leaf, if no client
+// is active). An error is returned if c isn't floating. The tree is placed
+// again afterwards.
+func (t *tree) tileClient(c Client) error {
+	return t.mutateErr("tileClient", func() error {
+		i := t.floatingIndex(c)
+		if i < 0 {
+			return fmt.Errorf("Client '%s' is not floating.", c)
+		}
+		t.floating = append(t.floating[:i], t.floating[i+1:]...)
+		return t.tileBesideActive(c)
+	})
+}
+
+// tileBesideActive adds a leaf for c beside the leaf of the active client (or
+// the last leaf, if no client is active), or makes it the root if the tree is
+// empty. This is a single mutation either way, so that rollback can take it
+// back. The tree is placed again afterwards.
+func (t *tree) tileBesideActive(c Client) error {
+	return t.mutateErr("tileBesideActive", func() error {
+		if t.child == nil {
+			t.setChild(newLeaf(nil, c))
+			t.replace()
+			return nil
+		}
+		var focused *leaf
+		t.child.VisitLeafNodes(func(lf *leaf) bool {
+			focused = lf
+			return !lf.client.IsActive()
+		})
+		if asSplit(focused.parent) != nil {
+			err := t.insertBeside(focused.client, newLeaf(nil, c), true)
+			if err != nil {
+				return err
+			}
+			t.replace()
+			return nil
+		}
+		return t.splitLeaf(focused.client, dirRight, c)
+	})
+}
+
+// addAuto adds c to the tree by splitting the largest tile in two, along its
+// longer side, which builds a balanced layout as clients are added one by
+// one (four clients in an empty tree make a grid of two by two). The size of
+// a tile is what it was given when the tree was last placed, or, if the tree
+// hasn't been placed yet, what its proportions make it. Ties go to the first
+// tile. Tabs of stacks are never split, so if the tree holds nothing else, c
+// is added beside the active leaf instead. The tree is placed again
+// afterwards.
+func (t *tree) addAuto(c Client) error {
+	return t.mutateErr("addAuto", func() error {
+		if t.child == nil {
+			t.setChild(newLeaf(nil, c))
+			t.replace()
+			return nil
+		}
+
+		var target *leaf
+		var bestW, bestH float64
+		t.child.VisitLeafNodes(func(lf *leaf) bool {
+			if _, ok := lf.parent.(*stack); ok {
+				return true
+			}
+			var w, h float64
+			if geom, ok := t.geomOf(lf.client, t.geom); ok {
+				w, h = float64(geom.Width()), float64(geom.Height())
+			} else {
+				_, _, w, h = unitRect(lf)
+			}
+			if target == nil || w*h > bestW*bestH {
+				target, bestW, bestH = lf, w, h
+			}
+			return true
+		})
+		if target == nil {
+			return t.tileBesideActive(c)
+		}
+		dir := dirDown
+		if bestW >= bestH {
+			dir = dirRight
+		}
+		return t.splitLeaf(target.client, dir, c)
+	})
+}
+
+// isFloating returns true if c is a floating client of the tree.
+func (t *tree) isFloating(c Client) bool {
+	return t.floatingIndex(c) >= 0
+}
+
+func (t *tree) floatingIndex(c Client) int {
+	for i, fc := range t.floating {
+		if fc == c {
+			return i
+		}
+	}
+	return -1
+}
+
+// centerOver returns the position that centers a floating window of w by h
+// pixels (like a dialog) over the tile that parent would have if the tree
+// were placed in base (see geomOf). If parent isn't tiled in the tree, or
+// the tree can't be placed in base, the window is centered in base instead.
+// A window that is larger than the tile overhangs it evenly, but it is
+// moved back into base (as far as it fits) rather than off the screen.
+func (t *tree) centerOver(parent Client, w, h int,
+	base xrect.Rect) (x, y int) {
+
+	area := base
+	if geom, ok := t.geomOf(parent, base); ok {
+		area = geom
+	}
+	x = area.X() + (area.Width()-w)/2
+	y = area.Y() + (area.Height()-h)/2
+	x = misc.Max(base.X(), misc.Min(x, base.X()+base.Width()-w))
+	y = misc.Max(base.Y(), misc.Min(y, base.Y()+base.Height()-h))
+	return x, y
+}
+
+// replaceClient puts the client new in the leaf of old, so that new takes
+// over the exact position, proportion and label of old in the tree. It
+// returns false if old isn't in the tree or if new already is. The tree is
+// not placed again, so that several replacements can be made at once.
+func (t *tree) replaceClient(old, new Client) bool {
+	return t.mutate("replaceClient", func() bool {
+		lf := t.findLeaf(old)
+		if lf == nil || t.findLeaf(new) != nil {
+			return false
+		}
+		lf.client = new
+		return true
+	})
+}
+
+// swapLeaves exchanges the positions of the leaves containing c1 and c2 in
+// their parents (see swapNodes). Unlike switchClients, the leaves are moved
+// along with their clients, which means a window inherits the destination
+// cell (even when the two parents have different orientations) and takes
+// everything attached to its leaf with it. The tree is placed again
+// afterwards.
+func (t *tree) swapLeaves(c1, c2 Client) {
+	lf1, lf2 := t.findLeaf(c1), t.findLeaf(c2)
+	if lf1 == nil || lf2 == nil || lf1 == lf2 {
+		return
+	}
+	if err := t.swapNodes(lf1, lf2); err != nil {
+		logger.Warning.Println(err)
+	}
+}
+
+// swapNodes exchanges the positions of the nodes n1 and n2, which may be
+// whole subtrees, in their parent splits. Each node takes on the proportion
+// (and fixed size) of the cell it moves into, so that the proportions of
+// each parent still add up to fullPortion. The tree is placed again
+// afterwards.
+//
+// An error is returned if either node isn't the child of a split, or if one
+// of them contains the other, since the tree would then contain itself.
+func (t *tree) swapNodes(n1, n2 node) error {
+	return t.mutateErr("swapNodes", func() error {
+		if n1 == n2 {
+			return fmt.Errorf("Cannot swap '%s' with itself.", n1)
+		}
+		for _, pair := range [][2]node{{n1, n2}, {n2, n1}} {
+			for _, a := range ancestors(pair[1]) {
+				if a == pair[0] {
+					return fmt.Errorf("Cannot swap '%s' with '%s', "+
+						"since it contains it.", pair[0], pair[1])
+				}
+			}
+		}
+		p1, p2 := asSplit(n1.Parent()), asSplit(n2.Parent())
+		if p1 == nil || p2 == nil {
+			return fmt.Errorf("Cannot swap '%s' with '%s', since they "+
+				"aren't both in splits.", n1, n2)
+		}
+
+		i1, i2 := p1.ChildIndex(n1), p2.ChildIndex(n2)
+		parent1, parent2 := n1.Parent(), n2.Parent()
+		p1.children[i1], p2.children[i2] = n2, n1
+		n1.SetParent(parent2)
+		n2.SetParent(parent1)
+
+		prop1, fixed1 := n1.Proportion(), n1.FixedSize()
+		n1.SetProportion(n2.Proportion())
+		n1.SetFixedSize(n2.FixedSize())
+		n2.SetProportion(prop1)
+		n2.SetFixedSize(fixed1)
+		t.replace()
+		return nil
+	})
+}
+
+// resizeLeaf grows the leaf containing c by delta in the direction dir.
+// The space is taken from the neighbor of the leaf (or of the leaf's nearest
+// ancestor) in the first enclosing split with the same orientation as dir.
+// A negative delta shrinks the leaf instead. If that split is anchored at
+// the center, the space is taken from the neighbors on both sides instead
+// (see resizeCentered), whichever way dir points. If c is active and a stack
+// or split is selected, the selection is resized instead of the leaf.
+// resizeLeaf returns false if there is no such neighbor.
+func (t *tree) resizeLeaf(c Client, dir direction, delta proportion) bool {
+	return t.mutate("resizeLeaf", func() bool {
+		lf := t.findLeaf(c)
+		if lf == nil {
+			return false
+		}
+
+		child := t.scope(lf)
+		for p := child.Parent(); p != nil; child, p = p, p.Parent() {
+			s := asSplit(p)
+			if s == nil || isHorizontal(p) != dir.horizontal() {
+				continue
+			}
+			if s.anchor == anchorCenter && s.Size() > 1 {
+				s.resizeCentered(child, delta)
+				return true
+			}
+
+			i := s.ChildIndex(child)
+			if dir.forward() {
+				i++
+			} else {
+				i--
+			}
+			if i < 0 || i >= s.Size() {
+				continue
+			}
+			s.resizeBetween(child, s.Child(i), delta)
+			return true
+		}
+		return false
+	})
+}
+
+// grow is like resizeLeaf, except that the leaf isn't limited to the space
+// of its neighbor in a single split. delta is relative to the first enclosing
+// split with the same orientation as dir. If that split can't give the leaf
+// all of delta (because the neighbor would become smaller than the split's
+// minimum proportion), the rest is taken from the next enclosing split along
+// the same axis, by growing the child containing the leaf in it, and so on,
+// until all of delta has been used or the root is reached. Since a split is
+// only a part of its parent, the rest of delta is scaled at every level so
+// that it always amounts to the same number of pixels. A negative delta
+// shrinks the leaf in the same way.
+//
+// If c is active and a stack or split is selected, the selection is grown
+// instead of the leaf. grow returns false if nothing could be resized.
+func (t *tree) grow(c Client, dir direction, delta proportion) bool {
+	return t.mutate("grow", func() bool {
+		lf := t.findLeaf(c)
+		if lf == nil {
+			return false
+		}
+
+		// rest is what is left of delta, relative to the root of the tree.
+		child, grown := t.scope(lf), false
+		rest, first := proportion(0), true
+		for p := child.Parent(); p != nil; child, p = p, p.Parent() {
+			s := asSplit(p)
+			if s == nil || isHorizontal(p) != dir.horizontal() {
+				continue
+			}
+			size := extent(p, dir.horizontal())
+			if first {
+				rest, first = delta*size, false
+			}
+
+			i := s.ChildIndex(child)
+			if dir.forward() {
+				i++
+			} else {
+				i--
+			}
+			if i < 0 || i >= s.Size() {
+				continue
+			}
+			moved := s.resizeBetween(child, s.Child(i), rest/size)
+			if moved != 0 {
+				grown = true
+			}
+			if rest -= moved * size; rest.Equal(0) {
+				break
+			}
+		}
+		return grown
+	})
+}
+
+// leafInDirection returns the leaf adjacent to the leaf containing from in
+// the direction dir. This is done by walking up the tree until a split is
+// found that is oriented along dir and has a neighbor in that direction.
+// The neighbor is then descended into, choosing the leaf that is
+// geometrically nearest to the leaf containing from.
+//
+// nil is returned if there is no leaf in that direction (i.e., we're at the
+// edge of the tree), so that the caller can decide what to do. If focusWrap
+// is set, the search wraps around instead: the leaf nearest to the leaf
+// containing from at the opposite end of the outermost split oriented along
+// dir is returned. nil is still returned if that is the leaf we started in.
+func (t *tree) leafInDirection(from Client, dir direction) *leaf {
+	lf := t.findLeaf(from)
+	if lf == nil {
+		return nil
+	}
+
+	var child node = lf
+	var outer *split
+	for p := lf.Parent(); p != nil; child, p = p, p.Parent() {
+		s := asSplit(p)
+		if s == nil || isHorizontal(p) != dir.horizontal() {
+			continue
+		}
+		outer = s
+
+		i := s.ChildIndex(child)
+		if dir.forward() {
+			i++
+		} else {
+			i--
+		}
+		if i < 0 || i >= s.Size() {
+			continue
+		}
+		return nearestLeaf(s.Child(i), lf, dir)
+	}
+	if !t.focusWrap || outer == nil {
+		return nil
+	}
+
+	first := outer.Child(outer.Size() - 1)
+	if dir.forward() {
+		first = outer.Child(0)
+	}
+	if wrapped := nearestLeaf(first, lf, dir); wrapped != lf {
+		return wrapped
+	}
+	return nil
+}
+
+// nearestLeaf descends into n, which was entered by moving in the direction
+// dir from the node 'from', and returns the leaf in n that is closest to
+// 'from'.
+func nearestLeaf(n, from node, dir direction) *leaf {
+	// The position of 'from' along the axis perpendicular to dir.
+	fx, fy, fw, fh := unitRect(from)
+	target := fx + fw/2
+	if dir.horizontal() {
+		target = fy + fh/2
+	}
+
+	for {
+		if lf, ok := n.(*leaf); ok {
+			return lf
+		}
+		if st, ok := n.(*stack); ok {
+			return st.activeLeaf()
+		}
+		s := asSplit(n)
+		if s == nil || s.Size() == 0 {
+			return nil
+		}
+
+		// If the split is oriented along dir, the closest child is always
+		// the one on the side we entered from. Otherwise, pick the child
+		// whose center is closest to the target.
+		if isHorizontal(n) == dir.horizontal() {
+			if dir.forward() {
+				n = s.Child(0)
+			} else {
+				n = s.Child(s.Size() - 1)
+			}
+			continue
+		}
+
+		best, bestDist := s.Child(0), math.Inf(1)
+		for _, child := range s.children {
+			x, y, w, h := unitRect(child)
+			center := x + w/2
+			if dir.horizontal() {
+				center = y + h/2
+			}
+			if dist := math.Abs(center - target); dist < bestDist {
+				best, bestDist = child, dist
+			}
+		}
+		n = best
+	}
+}
+
+// extent returns the width (if horizontal is true) or height of n relative
+// to the root of its tree (see unitRect).
+func extent(n node, horizontal bool) proportion {
+	_, _, w, h := unitRect(n)
+	if horizontal {
+		return proportion(w)
+	}
+	return proportion(h)
+}
+
+// unitRect returns the geometry of n relative to the root of its tree, where
+// the root occupies the unit square. This is solely computed from
+// proportions, and is therefore useful for comparing the relative positions
+// of nodes without knowing the actual geometry of the tree.
+func unitRect(n node) (x, y, w, h float64) {
+	x, y, w, h = 0, 0, 1, 1
+	for child, p := n, n.Parent(); p != nil; child, p = p, p.Parent() {
+		if _, ok := p.(*stack); ok {
+			continue // every leaf in a stack fills it
+		}
+		s := asSplit(p)
+		if s == nil {
+			break
+		}
+
+		start, size := 0.0, float64(child.Proportion())
+		for _, sibling := range s.children {
+			if sibling == child {
+				break
+			}
+			start += float64(sibling.Proportion())
+		}
+		if isHorizontal(p) {
+			x, w = start+x*size, w*size
+		} else {
+			y, h = start+y*size, h*size
+		}
+	}
+	return
+}
+
+// rotateSplit converts the split containing n (or n itself, if n is a split)
+// from an hsplit to a vsplit or vice versa. If n is the active leaf and a
+// split is selected, that split is rotated. The children and their
+// proportions are preserved. The tree is placed again afterwards.
+// rotateSplit returns false if there was no split to rotate.
+func (t *tree) rotateSplit(n node) bool {
+	return t.mutate("rotateSplit", func() bool {
+		target := n
+		if lf, ok := n.(*leaf); ok {
+			if target = t.scope(lf); asSplit(target) == nil {
+				target = target.Parent()
+			}
+		}
+		old := asSplit(target)
+		if old == nil {
+			return false
+		}
+
+		var rotated splitter
+		if isHorizontal(target) {
+			rotated = &vsplit{*old}
+		} else {
+			rotated = &hsplit{*old}
+		}
+		for _, child := range old.children {
+			child.SetParent(rotated)
+		}
+		if !t.substitute(target, rotated) {
+			for _, child := range old.children {
+				child.SetParent(target)
+			}
+			return false
+		}
+		if t.selection == target {
+			t.selection = rotated
+		}
+		t.replace()
+		return true
+	})
+}
+
+// rotateClients shifts the clients of the split containing the leaf of c (or
+// its stack) by one position, while the cells of the split stay as they are:
+// if forward is true, every client moves to the next leaf and the client of
+// the last leaf moves to the first, and the other way around otherwise. All
+// leaves within the split are included, even those in nested splits. Unlike
+// rotateSplit and moveClient, the structure of the tree isn't changed. The
+// tree is placed again afterwards. false is returned if c isn't in a split
+// with at least one other client.
+func (t *tree) rotateClients(c Client, forward bool) bool {
+	return t.mutate("rotateClients", func() bool {
+		lf := t.findLeaf(c)
+		if lf == nil {
+			return false
+		}
+		var child node = lf
+		if st, ok := lf.parent.(*stack); ok {
+			child = st
+		}
+		if asSplit(child.Parent()) == nil {
+			return false
+		}
+
+		var leaves []*leaf
+		child.Parent().VisitLeafNodes(func(visit *leaf) bool {
+			leaves = append(leaves, visit)
+			return true
+		})
+		if len(leaves) < 2 {
+			return false
+		}
+		clients := make([]Client, len(leaves))
+		for i, visit := range leaves {
+			clients[i] = visit.client
+		}
+		shift := 1
+		if !forward {
+			shift = -1
+		}
+		for i, client := range clients {
+			leaves[misc.Mod(i+shift, len(leaves))].client = client
+		}
+		t.replace()
+		return true
+	})
+}
+
+// substitute puts n in the place of old, which is either the root of the tree
+// or a child of some split. The parent of n is updated, but proportions are
+// not touched. It returns false if old is not in the tree.
+func (t *tree) substitute(old, n node) bool {
+	if t.child == old {
+		n.SetParent(nil)
+		t.setChild(n)
+		return true
+	}
+	parent := asSplit(old.Parent())
+	if parent == nil {
+		return false
+	}
+	i := parent.ChildIndex(old)
+	if i < 0 {
+		return false
+	}
+	parent.children[i] = n
+	n.SetParent(old.Parent())
+	return true
+}
+
+// splitLeaf splits the leaf containing c in two, adding a leaf for newClient
+// on the side of c given by dir. Normally, the leaf is replaced by a new
+// split (an hsplit if dir is horizontal and a vsplit otherwise) that
+// inherits the leaf's proportion and contains both clients at an even
+// proportion. But if the leaf's parent already has the requested
+// orientation, the new leaf is inserted beside it instead of nesting a
+// redundant split. The tree is placed again afterwards.
+func (t *tree) splitLeaf(c Client, dir direction, newClient Client) error {
+	return t.mutateErr("splitLeaf", func() error {
+		lf := t.findLeaf(c)
+		if lf == nil {
+			return fmt.Errorf("Client '%s' is not in the tree.", c)
+		}
+		added := newLeaf(nil, newClient)
+		if depth(lf)+1 > t.maxDepth {
+			t.stackLeaf(lf, added)
+			t.replace()
+			return nil
+		}
+
+		if asSplit(lf.parent) != nil &&
+			isHorizontal(lf.parent) == dir.horizontal() {
+			if err := t.insertBeside(c, added, dir.forward()); err != nil {
+				return err
+			}
+			t.replace()
+			return nil
+		}
+
+		var s splitter
+		if dir.horizontal() {
+			s = newHSplit(nil)
+		} else {
+			s = newVSplit(nil)
+		}
+		s.SetProportion(lf.Proportion())
+		s.SetFixedSize(lf.FixedSize())
+		if !t.substitute(lf, s) {
+			return fmt.Errorf("The leaf of client '%s' has no parent.", c)
+		}
+
+		lf.SetParent(s)
+		added.SetParent(s)
+		lf.SetFixedSize(0)
+		lf.SetProportion(fullPortion / 2)
+		added.SetProportion(fullPortion / 2)
+		sp := asSplit(s)
+		if dir.forward() {
+			sp.children = append(sp.children, lf, added)
+		} else {
+			sp.children = append(sp.children, added, lf)
+		}
+		t.replace()
+		return nil
+	})
+}
+
+// insertBeside inserts n into the split containing the leaf of existing,
+// immediately after that leaf if after is true and immediately before it
+// otherwise. The leaf of existing gives up half of its proportion to n, and
+// no other nodes are affected, unless n is a leaf whose client was removed
+// before, which gets its old proportion back instead (see memory.go). If
+// this would nest a leaf deeper than the tree's maximum depth, n (which must
+// then be a leaf) is stacked with the leaf of existing instead. An error is
+// returned if existing isn't in the tree, or if n is too deep to be inserted
+// or stacked.
+func (t *tree) insertBeside(existing Client, n node, after bool) error {
+	return t.mutateErr("insertBeside", func() error {
+		lf := t.findLeaf(existing)
+		if lf == nil {
+			return fmt.Errorf("Client '%s' is not in the tree.", existing)
+		}
+		parent := asSplit(lf.parent)
+		if parent == nil {
+			return fmt.Errorf("The leaf of client '%s' has no parent.",
+				existing)
+		}
+
+		if depth(lf)+height(n) > t.maxDepth {
+			added, ok := n.(*leaf)
+			if !ok {
+				return fmt.Errorf("Cannot insert '%s' beside client '%s' "+
+					"without nesting splits more than %d deep.",
+					n, existing, t.maxDepth)
+			}
+			t.stackLeaf(lf, added)
+			return nil
+		}
+
+		t.insertNextTo(lf, n, after)
+		t.recall(n)
+		return nil
+	})
+}
+
+// insertNextTo inserts n into the split containing anchor, immediately after
+// anchor if after is true and immediately before it otherwise. anchor gives
+// up half of its proportion to n.
+func (t *tree) insertNextTo(anchor, n node, after bool) {
+	parentNode := anchor.Parent()
+	parent := asSplit(parentNode)
+
+	i := parent.ChildIndex(anchor)
+	if after {
+		i++
+	}
+	parent.children = append(parent.children, nil)
+	copy(parent.children[i+1:], parent.children[i:])
+	parent.children[i] = n
+	n.SetParent(parentNode)
+
+	half := anchor.Proportion() / 2
+	anchor.SetProportion(half)
+	n.SetProportion(half)
+	parent.flatten(parentNode, t.maxChildren)
+}
+
+// moveClient moves the leaf of c one step in the direction dir, changing the
+// structure of the tree as needed:
+//
+// If the leaf's split is oriented along dir and the leaf has a sibling on
+// that side, the leaf trades places with the sibling, or, if the sibling is
+// a split with more than one child, moves into it next to the leaf nearest
+// to c.
+//
+// Otherwise, the leaf moves out of its split into the nearest enclosing split
+// that is oriented along dir, right beside the child of that split that
+// contained it. Its share of that split is the same as if it were added with
+// addNode, which also nests it if the split already has the tree's maximum
+// number of children (see addNodeBeside). If there is no such split, a new
+// one is made the root of the tree, containing the old root and the leaf
+// side by side.
+//
+// If c is active and a stack or split is selected, the whole selection is
+// moved in the same way instead of the leaf.
+//
+// moveClient returns false if c isn't in the tree or is already at the edge
+// of the screen in the direction dir. The tree is placed again afterwards.
+func (t *tree) moveClient(c Client, dir direction) bool {
+	return t.mutate("moveClient", func() bool {
+		lf := t.findLeaf(c)
+		if lf == nil {
+			return false
+		}
+		n := t.scope(lf)
+		if t.child == n {
+			return false
+		}
+		from := n.Parent().(splitter)
+		along := asSplit(from) != nil &&
+			isHorizontal(from) == dir.horizontal()
+
+		if along {
+			ps := asSplit(from)
+			i := ps.ChildIndex(n)
+			j := i - 1
+			if dir.forward() {
+				j = i + 1
+			}
+			if j >= 0 && j < ps.Size() {
+				sibling := ps.children[j]
+				if ss := asSplit(sibling); ss == nil || ss.Size() < 2 {
+					ps.children[i], ps.children[j] = sibling, n
+					t.replace()
+					return true
+				}
+				return t.moveInto(n, sibling, dir)
+			}
+		}
+
+		var child node = from
+		for a := from.Parent(); a != nil; child, a = a, a.Parent() {
+			as := asSplit(a)
+			if as == nil || isHorizontal(a) != dir.horizontal() {
+				continue
+			}
+			if !t.unlink(n) {
+				return false
+			}
+			// n is paired with the sibling that it moves next to if the
+			// split is full, or with child if there is no such sibling.
+			anchor, after := child, dir.forward()
+			if i := as.ChildIndex(child); after && i+1 < as.Size() {
+				anchor, after = as.children[i+1], false
+			} else if !after && i > 0 {
+				anchor, after = as.children[i-1], true
+			}
+			t.addNodeBeside(anchor, n, after)
+			if asSplit(n) != nil {
+				// A selected split may have the same orientation as a.
+				as.flatten(a, t.maxChildren)
+			}
+			t.tidy(from)
+			t.replace()
+			return true
+		}
+
+		// There's nowhere further to go if the leaf was already at the edge
+		// of a split oriented along dir.
+		if along || !t.unlink(n) {
+			return false
+		}
+		var s splitter
+		if dir.horizontal() {
+			s = newHSplit(nil)
+		} else {
+			s = newVSplit(nil)
+		}
+		root := t.child
+		s.SetProportion(root.Proportion())
+		t.substitute(root, s)
+		root.SetParent(s)
+		root.SetProportion(fullPortion / 2)
+		n.SetParent(s)
+		n.SetProportion(fullPortion / 2)
+		if dir.forward() {
+			asSplit(s).children = []node{root, n}
+		} else {
+			asSplit(s).children = []node{n, root}
+		}
+		if asSplit(n) != nil {
+			asSplit(s).flatten(s, t.maxChildren)
+		}
+		t.tidy(from)
+		t.replace()
+		return true
+	})
+}
+
+// moveInto moves n into the split target, which n entered by moving in the
+// direction dir, and puts it beside the leaf (or stack) of target that is
+// nearest to where n came from.
+func (t *tree) moveInto(n, target node, dir direction) bool {
+	var anchor node = nearestLeaf(target, n, dir)
+	if anchor == nil {
+		return false
+	}
+	if st, ok := anchor.Parent().(*stack); ok {
+		anchor = st
+	}
+	from := n.Parent().(splitter)
+	if !t.unlink(n) {
+		return false
+	}
+
+	// When entering a split with the same orientation, n goes on the side
+	// that it came from.
+	after := true
+	if isHorizontal(anchor.Parent()) == dir.horizontal() {
+		after = !dir.forward()
+	}
+	t.insertNextTo(anchor, n, after)
+	t.tidy(from)
+	t.replace()
+	return true
+}
+
+// detach cuts n, and everything in it, out of the tree, so that it can be
+// grafted onto another part of the tree with attach. Its siblings share its
+// proportion as if it were removed with removeNode, and its old parent is
+// tidied up, but the proportions inside n are left alone. The detached node
+// has no parent, and its clients stay where they are until it is attached
+// again. An error is returned if n is the root of the tree or isn't in it.
+func (t *tree) detach(n node) (node, error) {
+	var detached node
+	err := t.mutateErr("detach", func() error {
+		if n == t.child {
+			return fmt.Errorf("Cannot detach the root of the tree.")
+		}
+		if t.child == nil || !within(n, t.child) {
+			return fmt.Errorf("The node '%s' is not in the tree.", n)
+		}
+		parent := n.Parent().(splitter)
+		if err := parent.RemoveNode(n); err != nil {
+			return err
+		}
+		n.SetParent(nil)
+		if err := t.tidy(parent); err != nil {
+			return err
+		}
+		t.replace()
+		detached = n
+		return nil
+	})
+	return detached, err
+}
+
+// attach inserts n, which must not be in the tree (e.g., because it was
+// detached), beside target on the side of it given by dir. If target is in a
+// split oriented along dir, n is inserted into it and target gives up half of
+// its proportion, like insertBeside does. Otherwise, target is replaced by a
+// new split oriented along dir that holds target and n evenly, like
+// splitLeaf does. A target in a stack stands for the whole stack. If n is a
+// split with the orientation of the split it ends up in, its children are
+// spliced into that split (see flatten).
+//
+// An error is returned if target isn't in the tree, if it is in n (which
+// would make n a part of itself), if it is in a grid, or if the leaves of n
+// would be nested deeper than the tree's maximum depth. The tree is placed
+// again afterwards.
+func (t *tree) attach(n, target node, dir direction) error {
+	return t.mutateErr("attach", func() error {
+		if within(target, n) {
+			return fmt.Errorf("Cannot attach '%s' to '%s', which is a part "+
+				"of it.", n, target)
+		}
+		if n.Parent() != nil || n == t.child {
+			return fmt.Errorf("The node '%s' must be detached before it can "+
+				"be attached.", n)
+		}
+		if t.child == nil || !within(target, t.child) {
+			return fmt.Errorf("The node '%s' is not in the tree.", target)
+		}
+		if st, ok := target.Parent().(*stack); ok {
+			target = st
+		}
+		if _, ok := target.Parent().(*grid); ok {
+			return fmt.Errorf("Cannot attach '%s' beside '%s', since it is "+
+				"in a grid.", n, target)
+		}
+
+		along := asSplit(target.Parent()) != nil &&
+			isHorizontal(target.Parent()) == dir.horizontal()
+		levels := depth(target) + height(n)
+		if !along {
+			levels++
+		}
+		if levels > t.maxDepth {
+			return fmt.Errorf("Cannot attach '%s' beside '%s' without "+
+				"nesting splits more than %d deep.", n, target, t.maxDepth)
+		}
+
+		if along {
+			t.insertNextTo(target, n, dir.forward())
+			t.replace()
+			return nil
+		}
+		var s splitter
+		if dir.horizontal() {
+			s = newHSplit(nil)
+		} else {
+			s = newVSplit(nil)
+		}
+		s.SetProportion(target.Proportion())
+		s.SetFixedSize(target.FixedSize())
+		t.substitute(target, s)
+
+		target.SetParent(s)
+		n.SetParent(s)
+		target.SetFixedSize(0)
+		target.SetProportion(fullPortion / 2)
+		n.SetProportion(fullPortion / 2)
+		sp := asSplit(s)
+		if dir.forward() {
+			sp.children = []node{target, n}
+		} else {
+			sp.children = []node{n, target}
+		}
+		sp.flatten(s, t.maxChildren)
+		t.replace()
+		return nil
+	})
+}
+
+// within returns true if n is a or is somewhere inside it.
+func within(n, a node) bool {
+	for ; n != nil; n = n.Parent() {
+		if n == a {
+			return true
+		}
+	}
+	return false
+}
+
+// unlink removes n from its parent without tidying the parent up, so that
+// the rest of the tree keeps its structure until n has been put somewhere
+// else.
+func (t *tree) unlink(n node) bool {
+	if err := n.Parent().(splitter).RemoveNode(n); err != nil {
+		logger.Warning.Println(err)
+		return false
+	}
+	return true
+}
+
+// RemovalPolicy is which siblings of a node that is removed from a split
+// with removeNode get its share of the split.
+type RemovalPolicy int
+
+const (
+	// RemoveEven gives every sibling a part of the share, in proportion to
+	// the share it already has (see split.RemoveNode).
+	RemoveEven RemovalPolicy = iota
+
+	// RemoveToNeighbor gives all of the share to the sibling before the
+	// node, or after it if it was the first child. That is the sibling that
+	// takes its place, just like the tab that becomes active when a tab is
+	// removed from a stack (see stack.RemoveNode).
+	RemoveToNeighbor
+
+	// RemoveToLargest gives all of the share to the largest sibling.
+	RemoveToLargest
+)
+
+// removeNode removes n from its parent split (or stack). Unlike calling
+// RemoveNode on the split directly, this gives the share of n to the
+// siblings that the tree's removal policy says (see RemovalPolicy), keeps
+// the tree free of redundant splits (see tidy), and remembers the
+// proportion of a leaf in case its client comes back (see memory.go).
+//
+// Layouts that keep references to particular splits (like the masters and
+// slaves of Vertical and Horizontal) should call RemoveNode on the split
+// instead so that their splits are never discarded.
+//
+// An error is returned if n is not in its parent.
+func (t *tree) removeNode(n node) error {
+	return t.mutateErr("removeNode", func() error {
+		parent, ok := n.Parent().(splitter)
+		if !ok {
+			return fmt.Errorf("The node '%s' has no parent.", n)
+		}
+		if lf, ok := n.(*leaf); ok && parent.ChildIndex(n) >= 0 {
+			t.remember(lf)
+		}
+		if s := asSplit(parent); s != nil && t.removalPolicy != RemoveEven {
+			if err := s.removeToOne(n, t.removalPolicy); err != nil {
+				return err
+			}
+			return t.tidy(parent)
+		}
+		if err := parent.RemoveNode(n); err != nil {
+			return err
+		}
+		return t.tidy(parent)
+	})
+}
+
+// removeClient takes c out of the tree, whether it is tiled or floating, like
+// a window that was closed. A tiled client is removed with removeNode, and the
+// last tiled client leaves the tree empty. An error is returned if c isn't in
+// the tree.
+func (t *tree) removeClient(c Client) error {
+	if t.isFloating(c) {
+		t.forget(c)
+		return nil
+	}
+	lf := t.findLeaf(c)
+	if lf == nil {
+		return fmt.Errorf("Client '%s' is not in the tree.", c)
+	}
+	err := t.mutateErr("removeClient", func() error {
+		if lf.parent == nil {
+			t.setChild(nil)
+			return nil
+		}
+		return t.removeNode(lf)
+	})
+	if err == nil {
+		t.forget(c)
+	}
+	return err
+}
+
+// tidy cleans up the split (or stack) parent after one of its children was
+// removed. If parent is left with a single child, that child takes its place
+// (and proportion) in the grandparent. If it is left with no children, it is
+// removed as well (unless it is the root). A grid keeps its shape for as
+// long as it has any leaves, since its empty cells are part of it.
+func (t *tree) tidy(parent splitter) error {
+	if _, ok := parent.(*grid); ok && parent.Size() > 0 {
+		return nil
+	}
+	switch parent.Size() {
+	case 0:
+		if t.child != parent {
+			return t.removeNode(parent)
+		}
+	case 1:
+		grand := parent.Parent()
+		t.collapse(parent)
+		if gs := asSplit(grand); gs != nil {
+			gs.flatten(grand, t.maxChildren)
+		}
+	}
+	return nil
+}
+
+// addNode adds n to the split s, as the last child if last is true and as
+// the first child otherwise. It is like calling AddNode on s, except that
+// the change can be undone and that the tree's maximum number of children is
+// respected: if s would have too many children, the children at the end (or
+// start) that don't fit are moved into a nested split with the same
+// orientation, which takes up the same space that they did. If there already
+// is such a split at that end of s, n is added to it instead. A leaf whose
+// client was removed before gets its old proportion back (see memory.go).
+func (t *tree) addNode(s splitter, n node, last bool) {
+	t.mutate("addNode", func() bool {
+		if asSplit(s) == nil || s.Size() == 0 {
+			defer t.recall(n)
+			s.AddNode(n, last)
+			return true
+		}
+		if last {
+			t.addNodeBeside(s.Child(s.Size()-1), n, true)
+		} else {
+			t.addNodeBeside(s.Child(0), n, false)
+		}
+		return true
+	})
+}
+
+// addNodeBeside adds n to the split containing anchor, immediately after
+// anchor if after is true and immediately before it otherwise. n gets the
+// share that AddNode would give it, and the tree's maximum number of
+// children is respected like in addNode: if the split is full, n and anchor
+// are moved into a nested split in their place, or, if anchor is a split
+// with the same orientation, n is added to it at the end nearest to its
+// place instead. A leaf whose client was removed before gets its old
+// proportion back (see memory.go).
+func (t *tree) addNodeBeside(anchor, n node, after bool) {
+	t.mutate("addNodeBeside", func() bool {
+		defer t.recall(n)
+		parent := anchor.Parent().(splitter)
+		sp := asSplit(parent)
+		full := t.maxChildren > 0 && sp.Size() >= t.maxChildren
+		if as := asSplit(anchor); full && as != nil &&
+			isHorizontal(anchor) == isHorizontal(parent) {
+
+			if after {
+				t.addNodeBeside(as.children[as.Size()-1], n, true)
+			} else {
+				t.addNodeBeside(as.children[0], n, false)
+			}
+			return true
+		}
+
+		i := sp.ChildIndex(anchor)
+		if after {
+			i++
+		}
+		sp.insertAt(n, i)
+		n.SetParent(parent)
+		if full {
+			t.nest(parent, misc.Min(i, sp.ChildIndex(anchor)),
+				misc.Max(i, sp.ChildIndex(anchor))+1)
+		}
+		return true
+	})
+}
+
+// addNodes adds nodes to the end of the split s all at once, as described by
+// split.addNodes, and makes s their parent. The change can be undone as a
+// whole. If s isn't a split, or would get more than the tree's maximum
+// number of children, the nodes are added one at a time with addNode
+// instead. Unlike addNode, proportions remembered for the clients of the
+// nodes aren't recalled, since the nodes bring their own.
+func (t *tree) addNodes(s splitter, nodes []node, even bool) {
+	t.mutate("addNodes", func() bool {
+		sp := asSplit(s)
+		if sp == nil || (t.maxChildren > 0 &&
+			s.Size()+len(nodes) > t.maxChildren) {
+
+			for _, n := range nodes {
+				t.addNode(s, n, true)
+			}
+			return len(nodes) > 0
+		}
+		sp.addNodes(nodes, even)
+		for _, n := range nodes {
+			n.SetParent(s)
+		}
+		return len(nodes) > 0
+	})
+}
+
+// nest moves the children of s from index i up to (but not including) j into
+// a new split with the same orientation as s, in their place. The new split
+// takes their combined proportion, so the geometry of the tree is unchanged
+// (ignoring gaps).
+func (t *tree) nest(s splitter, i, j int) {
+	var nested splitter
+	if isHorizontal(s) {
+		nested = newHSplit(s)
+	} else {
+		nested = newVSplit(s)
+	}
+	sp, np := asSplit(s), asSplit(nested)
+
+	sum := proportion(0)
+	for _, child := range sp.children[i:j] {
+		sum += child.Proportion()
+	}
+	for _, child := range sp.children[i:j] {
+		child.SetProportion(child.Proportion() / sum)
+		child.SetParent(nested)
+		np.children = append(np.children, child)
+	}
+	nested.SetProportion(sum)
+
+	rest := append([]node{}, sp.children[:i]...)
+	rest = append(rest, nested)
+	sp.children = append(rest, sp.children[j:]...)
+	np.checkPortions()
+	sp.checkPortions()
+}
+
+// collapse replaces the split (or stack) s, which must have exactly one
+// child, with that child. The child inherits the proportion of s.
+func (t *tree) collapse(s node) {
+	var survivor node
+	if st, ok := s.(*stack); ok {
+		survivor = st.leaves[0]
+		st.leaves = st.leaves[:0]
+	} else {
+		sp := asSplit(s)
+		survivor = sp.children[0]
+		sp.children = sp.children[:0]
+	}
+	survivor.SetProportion(s.Proportion())
+	survivor.SetFixedSize(s.FixedSize())
+	t.substitute(s, survivor)
+}
+
+// balance resets the children of every split in the tree to equal
+// proportions, except for sticky leaves, which keep theirs. It is a no-op on
+// an empty tree.
+func (t *tree) balance() {
+	t.mutate("balance", func() bool {
+		if t.child == nil {
+			return false
+		}
+		balanceNode(t.child)
+		return true
+	})
+}
+
+// equalizeSplit gives every child of the split containing the leaf of c (or
+// its stack) an equal proportion, without touching the rest of the tree.
+// Sticky leaves keep their proportions. It returns false if c isn't in a
+// split, if it is the only child of its split, or if every child is sticky
+// (in which case there is nothing to equalize). The tree is placed again
+// afterwards.
+func (t *tree) equalizeSplit(c Client) bool {
+	return t.mutate("equalizeSplit", func() bool {
+		lf := t.findLeaf(c)
+		if lf == nil {
+			return false
+		}
+		var child node = lf
+		if st, ok := lf.parent.(*stack); ok {
+			child = st
+		}
+		s := asSplit(child.Parent())
+		if s == nil || s.Size() < 2 {
+			return false
+		}
+
+		if !s.equalize() {
+			return false
+		}
+		t.replace()
+		return true
+	})
+}
+
+func balanceNode(n node) {
+	s := asSplit(n)
+	if s == nil || len(s.children) == 0 {
+		return
+	}
+	s.equalize()
+	for _, child := range s.children {
+		balanceNode(child)
+	}
+}
+
+// setSplitRatio gives the children of the split n (or of the split containing
+// n, if n is a leaf) the proportions in ratios, in order. An error is
+// returned if the number of ratios doesn't match the number of children, or
+// if the ratios don't add up to fullPortion. The tree is placed again
+// afterwards.
+func (t *tree) setSplitRatio(n node, ratios []proportion) error {
+	return t.mutateErr("setSplitRatio", func() error {
+		target := n
+		if _, ok := n.(*leaf); ok {
+			target = n.Parent()
+		}
+		s := asSplit(target)
+		if s == nil {
+			return fmt.Errorf("The node '%s' is not in a split.", n)
+		}
+		if len(ratios) != len(s.children) {
+			return fmt.Errorf("Cannot apply %d ratios to a split with %d "+
+				"children.", len(ratios), len(s.children))
+		}
+
+		sum := proportion(0)
+		for _, ratio := range ratios {
+			sum += ratio
+		}
+		if !sum.Equal(fullPortion) {
+			return fmt.Errorf("The ratios add up to %f instead of %f.",
+				sum, fullPortion)
+		}
+
+		for i, child := range s.children {
+			child.SetProportion(ratios[i])
+		}
+		t.replace()
+		return nil
+	})
+}
+
+// goldenRatio returns the ratios of a two child split at the golden ratio,
+// with the larger child first.
+func goldenRatio() []proportion {
+	major := proportion((math.Sqrt(5) - 1) / 2)
+	return []proportion{major, fullPortion - major}
+}
+
+// thirds returns the ratios of a three child split with equal children.
+func thirds() []proportion {
+	third := fullPortion / 3
+	return []proportion{third, third, fullPortion - 2*third}
+}
+
+// commonAncestor returns the lowest split that contains the leaves of both
+// c1 and c2. nil is returned if either client isn't in the tree (or if the
+// only leaf in the tree contains both).
+func (t *tree) commonAncestor(c1, c2 Client) node {
+	lf1, lf2 := t.findLeaf(c1), t.findLeaf(c2)
+	if lf1 == nil || lf2 == nil {
+		return nil
+	}
+
+	// The chains are listed from the root of the tree down to each leaf, so
+	// the last node they share is the lowest common ancestor.
+	chain1, chain2 := ancestors(lf1), ancestors(lf2)
+	var common node
+	for i := 0; i < len(chain1) && i < len(chain2); i++ {
+		if chain1[i] != chain2[i] {
+			break
+		}
+		if asSplit(chain1[i]) != nil {
+			common = chain1[i]
+		}
+	}
+	return common
+}
+
+// ancestors returns the parents of n, starting at the root of the tree.
+func ancestors(n node) []node {
+	var chain []node
+	for p := n.Parent(); p != nil; p = p.Parent() {
+		chain = append([]node{p}, chain...)
+	}
+	return chain
+}
+
+// zoom makes the leaf containing c take up nearly all of its split, leaving
+// only a sliver to each of its siblings (which are still kept at least as
+// large as their minimum sizes). Zooming any client in a zoomed split puts
+// the proportions back the way they were before. If c is in a stack, the
+// stack is zoomed, and splits with a single child are skipped over. If c is
+// active and a stack or split is selected, the whole selection is zoomed.
+// The tree is placed again afterwards.
+func (t *tree) zoom(c Client) bool {
+	return t.mutate("zoom", func() bool {
+		lf := t.findLeaf(c)
+		if lf == nil {
+			return false
+		}
+		child := t.scope(lf)
+		if st, ok := lf.parent.(*stack); ok && child == node(lf) {
+			child = st
+		}
+		s := asSplit(child.Parent())
+		for s != nil && s.Size() < 2 {
+			child = child.Parent()
+			s = asSplit(child.Parent())
+		}
+		if s == nil {
+			return false
+		}
+
+		if s.unzoomed != nil && len(s.unzoomed) == len(s.children) {
+			for i, child := range s.children {
+				child.SetProportion(s.unzoomed[i])
+			}
+			s.unzoomed = nil
+			t.replace()
+			return true
+		}
+
+		s.unzoomed = s.props()
+		sliver := zoomSliver
+		if max := fullPortion / proportion(2*s.Size()); sliver > max {
+			sliver = max
+		}
+		for _, sibling := range s.children {
+			sibling.SetProportion(sliver)
+		}
+		child.SetProportion(fullPortion - sliver*proportion(s.Size()-1))
+		s.checkPortions()
+		t.replace()
+		return true
+	})
+}
+
+// snapProportions rounds the proportion of every child of every split to the
+// nearest multiple of step (but never below step). The largest child of each
+// split absorbs whatever is needed to make the split add up to fullPortion
+// again. snapProportions returns false if step isn't between zero and
+// fullPortion. The tree is placed again afterwards.
+func (t *tree) snapProportions(step proportion) bool {
+	if step <= 0 || step > fullPortion {
+		return false
+	}
+	return t.mutate("snapProportions", func() bool {
+		if t.child == nil {
+			return false
+		}
+		snapNode(t.child, step)
+		t.replace()
+		return true
+	})
+}
+
+func snapNode(n node, step proportion) {
+	s := asSplit(n)
+	if s == nil || len(s.children) == 0 {
+		return
+	}
+
+	sum, largest := proportion(0), s.children[0]
+	for _, child := range s.children {
+		p := step * proportion(math.Floor(float64(child.Proportion()/step)+0.5))
+		if p < step {
+			p = step
+		}
+		child.SetProportion(p)
+		sum += p
+		if p > largest.Proportion() {
+			largest = child
+		}
+	}
+	if fixed := largest.Proportion() + fullPortion - sum; fixed >= step {
+		largest.SetProportion(fixed)
+	} else {
+		s.normalize()
+	}
+	s.checkPortions()
+
+	for _, child := range s.children {
+		snapNode(child, step)
+	}
+}
+
+// mirror flips the tree horizontally (if horizontal is true) or vertically,
+// by reversing the order of the children of every hsplit or vsplit,
+// respectively. Each child keeps its proportion, so mirroring twice yields the
+// original tree. The tree is placed again afterwards.
+func (t *tree) mirror(horizontal bool) {
+	t.mutate("mirror", func() bool {
+		if t.child == nil {
+			return false
+		}
+		mirrorNode(t.child, horizontal)
+		t.replace()
+		return true
+	})
+}
+
+func mirrorNode(n node, horizontal bool) {
+	s := asSplit(n)
+	if s == nil {
+		return
+	}
+	if isHorizontal(n) == horizontal {
+		for i, j := 0, len(s.children)-1; i < j; i, j = i+1, j-1 {
+			s.children[i], s.children[j] = s.children[j], s.children[i]
+		}
+	}
+	for _, child := range s.children {
+		mirrorNode(child, horizontal)
+	}
+}
+
+// preview returns the geometry that every client would have if op were done
+// to the tree and it were then placed in base, without changing the tree or
+// any client. op is given a copy of the tree (see clone) on which placing
+// doesn't touch the clients, so it may use any mutation, including those that
+// place the tree. Tabs of a stack that aren't shown are given the geometry of
+// the stack. The map is empty if the copy cannot be placed in base.
+func (t *tree) preview(op func(*tree), base xrect.Rect) map[Client]xrect.Rect {
+	c := t.clone()
+	c.dryRun = true
+	op(c)
+	geoms := make(map[Client]xrect.Rect)
+	c.eachLeafGeom(base, func(client Client, r xrect.Rect) bool {
+		geoms[client] = r
+		return true
+	})
+	return geoms
+}
+
+// clone returns a deep copy of the structure of the tree, so that changes can
+// be tried out on the copy without affecting the original. The copy shares
+// the clients (which are live objects) and the settings of the original, but
+// starts with no undo history, place hooks or animation.
+func (t *tree) clone() *tree {
+	c := newTree()
+	copySettings(c, t)
+	c.rememberOrder = append([]xproto.Window{}, t.rememberOrder...)
+	if t.remembered != nil {
+		c.remembered = make(map[xproto.Window]proportion)
+		for id, p := range t.remembered {
+			c.remembered[id] = p
+		}
+	}
+	c.geom, c.masterProp, c.alive = t.geom, t.masterProp, t.alive
+	c.matcher = t.matcher
+	c.floating = append([]Client{}, t.floating...)
+	for client, geom := range t.drawn {
+		c.drawn[client] = geom
+	}
+	for client := range t.hidden {
+		c.hidden[client] = true
+	}
+
+	copies := make(map[node]node)
+	if t.child != nil {
+		c.child = cloneNode(t.child, nil, copies)
+	}
+	if t.unmonocled != nil {
+		c.unmonocled = cloneNode(t.unmonocled, nil, copies)
+	}
+	if t.masterCol != nil {
+		c.masterCol, _ = copies[t.masterCol].(*vsplit)
+	}
+	if t.stackCol != nil {
+		c.stackCol, _ = copies[t.stackCol].(*vsplit)
+	}
+	return c
+}
+
+// copySettings gives dst the settings of src, which are everything that
+// MarshalJSON saves apart from the nodes.
+func copySettings(dst, src *tree) {
+	dst.innerGap, dst.outerGap = src.innerGap, src.outerGap
+	dst.strutTop, dst.strutRight = src.strutTop, src.strutRight
+	dst.strutBottom, dst.strutLeft = src.strutBottom, src.strutLeft
+	dst.minLeafPx, dst.scale = src.minLeafPx, src.scale
+	dst.scrollOverflow, dst.stackFallback = src.scrollOverflow,
+		src.stackFallback
+	dst.focusWrap, dst.rememberProps = src.focusWrap, src.rememberProps
+	dst.roundMode, dst.removalPolicy = src.roundMode, src.removalPolicy
+	dst.dropCenter, dst.snapStep = src.dropCenter, src.snapStep
+	dst.maxDepth, dst.maxChildren = src.maxDepth, src.maxChildren
+}
+
+// cloneNode returns a deep copy of n with the given parent. copies records
+// the copy of every node, so that references to nodes can be carried over.
+func cloneNode(n, parent node, copies map[node]node) node {
+	var dup node
+	switch n := n.(type) {
+	case *leaf:
+		lf := newLeaf(nil, n.client)
+		lf.SetLabel(n.Label())
+		lf.SetSticky(n.Sticky())
+		dup = lf
+	case *stack:
+		st := newStack(parent)
+		for _, lf := range n.leaves {
+			st.leaves = append(st.leaves,
+				cloneNode(lf, st, copies).(*leaf))
+		}
+		st.active = n.active
+		dup = st
+	case *grid:
+		g := newGrid(n.rows, n.cols)
+		g.rowProps = append([]proportion{}, n.rowProps...)
+		g.colProps = append([]proportion{}, n.colProps...)
+		n.each(func(r, c int, lf *leaf) bool {
+			g.cells[r][c] = cloneNode(lf, g, copies).(*leaf)
+			return true
+		})
+		dup = g
+	case *hsplit:
+		hs := &hsplit{n.split}
+		hs.children = cloneChildren(hs, n.children, copies)
+		dup = hs
+	case *vsplit:
+		vs := &vsplit{n.split}
+		vs.children = cloneChildren(vs, n.children, copies)
+		dup = vs
+	default:
+		panic(fmt.Sprintf("Cannot clone node of type %T.", n))
+	}
+	if s := asSplit(dup); s != nil {
+		s.saved = append([]proportion{}, s.saved...)
+		if s.unzoomed != nil {
+			s.unzoomed = append([]proportion{}, s.unzoomed...)
+		}
+	}
+	dup.SetParent(parent)
+	dup.SetProportion(n.Proportion())
+	dup.SetFixedSize(n.FixedSize())
+	*dup.cache() = geomCache{}
+	copies[n] = dup
+	return dup
+}
+
+func cloneChildren(parent node, children []node,
+	copies map[node]node) []node {
+
+	dups := make([]node, len(children))
+	for i, child := range children {
+		dups[i] = cloneNode(child, parent, copies)
+	}
+	return dups
+}
+
+// activeLeaf returns the leaf of the active client, provided that it is
+// shown. If the active client is a tab that is hidden in a stack, the leaf
+// of the tab that is shown instead is returned, so that focus never goes to
+// a client that can't be seen. nil is returned if no tiled client is active.
+func (t *tree) activeLeaf() *leaf {
+	if t.child == nil {
+		return nil
+	}
+	var lf *leaf
+	t.child.VisitLeafNodes(func(visit *leaf) bool {
+		if visit.client.IsActive() {
+			lf = visit
+			return false
+		}
+		return true
+	})
+	if lf == nil {
+		return nil
+	}
+	if st, ok := lf.parent.(*stack); ok {
+		return st.activeLeaf()
+	}
+	return lf
+}
+
+func (t *tree) findLeaf(c Client) *leaf {
+	if t.child == nil {
+		return nil
+	}
+	var lf *leaf
+	t.child.VisitLeafNodes(func(visit *leaf) bool {
+		if visit.client == c {
+			lf = visit
+			return false // stop visiting
+		}
+		return true // keep going
+	})
+	return lf
+}
+
+// findLeafByLabel returns the first leaf with the given label (see
+// leaf.SetLabel), or nil if there is none. Leaves without a label can't be
+// found this way.
+func (t *tree) findLeafByLabel(label string) *leaf {
+	if t.child == nil || len(label) == 0 {
+		return nil
+	}
+	var lf *leaf
+	t.child.VisitLeafNodes(func(visit *leaf) bool {
+		if visit.label == label {
+			lf = visit
+			return false
+		}
+		return true
+	})
+	return lf
+}
+
+func newLeaf(parent splitter, client Client) *leaf {
+	return &leaf{
+		parent: parent,
+		client: client,
+	}
+}
+
+func newHSplit(parent node) *hsplit {
+	return &hsplit{split{
+		parent:    parent,
+		children:  make([]node, 0),
+		saved:     make([]proportion, 0),
+		minProp:   defaultMinProportion,
+		maxProp:   defaultMaxProportion,
+		threshold: defaultResizeThreshold,
+	}}
+}
+
+func newVSplit(parent node) *vsplit {
+	return &vsplit{split{
+		parent:    parent,
+		children:  make([]node, 0),
+		saved:     make([]proportion, 0),
+		minProp:   defaultMinProportion,
+		maxProp:   defaultMaxProportion,
+		threshold: defaultResizeThreshold,
+	}}
+}
+
+// asSplit returns the split underlying an hsplit or a vsplit, or nil if n
+// is not a split.
+func asSplit(n node) *split {
+	switch s := n.(type) {
+	case *hsplit:
+		return &s.split
+	case *vsplit:
+		return &s.split
+	}
+	return nil
+}
+
+// isHorizontal returns true if n lays out its children along the x-axis.
+func isHorizontal(n node) bool {
+	_, ok := n.(*hsplit)
+	return ok
+}
+
+func (s *split) Proportion() proportion {
+	return s.prop
+}
+
+func (s *split) SetProportion(p proportion) {
+	s.prop = p
+	s.markDirty()
+}
+
+func (s *split) FixedSize() int {
+	return s.fixedPx
+}
+
+func (s *split) SetFixedSize(px int) {
+	s.fixedPx = px
+}
+
+// strictPortions makes checkPortions panic instead of fixing the proportions
+// of a split. It is meant for debugging and tests.
+var strictPortions = false
+
+// checkPortions makes sure that the proportions of the children of s add up
+// to exactly fullPortion, scaling them if they don't. Small drift from
+// floating point error is expected, but drift of more than epsilon (or a
+// proportion that isn't finite) is a bug, so a warning is logged (or, if
+// strictPortions is set, checkPortions panics).
+func (s *split) checkPortions() {
+	if len(s.children) == 0 {
+		return
+	}
+
+	sum, finite := proportion(0), true
+	for i, child := range s.children {
+		if !child.Proportion().valid() {
+			msg := fmt.Sprintf("portion of child %d ('%s') is not finite: %f",
+				i, child, child.Proportion())
+			if strictPortions {
+				panic(msg)
+			}
+			logger.Warning.Println(msg)
+			finite = false
+		}
+		sum += child.Proportion()
+	}
+	if finite && sum == fullPortion {
+		return
+	}
+	if finite && !sum.Equal(fullPortion) {
+		msg := fmt.Sprintf("portions not equal: %f != %f", sum, fullPortion)
+		if strictPortions {
+			panic(msg)
+		}
+		logger.Warning.Println(msg)
+	}
+
+	for _, child := range s.children {
+		if finite && sum > 0 {
+			child.SetProportion(child.Proportion() * (fullPortion / sum))
+		} else {
+			child.SetProportion(fullPortion / proportion(len(s.children)))
+		}
+	}
+}
+
+// normalize scales the proportions of the children of s so that they sum to
+// fullPortion. If they sum to zero, every child gets an even share.
+func (s *split) normalize() {
+	sum := proportion(0)
+	for _, child := range s.children {
+		sum += child.Proportion()
+	}
+	for _, child := range s.children {
+		if sum > 0 {
+			child.SetProportion(child.Proportion() / sum)
+		} else {
+			child.SetProportion(fullPortion / proportion(len(s.children)))
+		}
+	}
+	s.checkPortions()
+}
+
+// setWeights sets the proportions of the children of s from integer weights,
+// so that the weights 2, 1 and 1 give the first child half of the split and
+// the others a quarter each. An error is returned if the number of weights
+// doesn't match the number of children, or if any weight isn't positive.
+func (s *split) setWeights(weights []int) error {
+	if len(weights) != len(s.children) {
+		return fmt.Errorf("Cannot apply %d weights to a split with %d "+
+			"children.", len(weights), len(s.children))
+	}
+	for _, w := range weights {
+		if w <= 0 {
+			return fmt.Errorf("Weights must be positive, but got %d.", w)
+		}
+	}
+	for i, prop := range ProportionFromWeights(weights) {
+		s.children[i].SetProportion(prop)
+	}
+	s.checkPortions()
+	return nil
+}
+
+// weights returns the smallest integer weights (see setWeights) that match
+// the proportions of the children of s. If no weights adding up to at most
+// maxWeightTotal match exactly, the proportions are approximated as
+// percentages instead.
+func (s *split) weights() []int {
+	weights := make([]int, len(s.children))
+	for total := 1; total <= maxWeightTotal; total++ {
+		exact := true
+		for i, child := range s.children {
+			weights[i] = child.Proportion().Portion(total)
+			p := proportion(weights[i]) / proportion(total)
+			if weights[i] == 0 || !p.Equal(child.Proportion()) {
+				exact = false
+				break
+			}
+		}
+		if exact {
+			return weights
+		}
+	}
+	for i, child := range s.children {
+		weights[i] = misc.Max(1, child.Proportion().Portion(maxWeightTotal))
+	}
+	return weights
+}
+
+func (s *split) String() string {
+	return fmt.Sprintf("split with %d children [%f]", len(s.children), s.prop)
+}
+
+func (hs *hsplit) String() string {
+	return nodeString(nil, hs, nil, 0, make(map[node]bool))
+}
+
+func (vs *vsplit) String() string {
+	return nodeString(nil, vs, nil, 0, make(map[node]bool))
+}
+
+func (s *split) Parent() node {
+	return s.parent
+}
+
+// activeClient returns nothing for a split, since all of its children are
+// shown at once.
+func (s *split) activeClient() (Client, bool) {
+	return nil, false
+}
+
+func (s *split) SetParent(n node) {
+	s.parent = n
+}
+
+func (s *split) VisitLeafNodes(f func(lf *leaf) bool) bool {
+	for _, child := range s.children {
+		if !child.VisitLeafNodes(f) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *split) VisitLeafNodesReverse(f func(lf *leaf) bool) bool {
+	for i := len(s.children) - 1; i >= 0; i-- {
+		if !s.children[i].VisitLeafNodesReverse(f) {
+			return false
+		}
+	}
+	return true
+}
+
+// AddNode adds n to the hsplit and makes the hsplit its parent. The
+// proportions are adjusted as described by split.AddNode.
+func (hs *hsplit) AddNode(n node, last bool) {
+	hs.split.AddNode(n, last)
+	n.SetParent(hs)
+}
+
+// AddNode adds n to the vsplit and makes the vsplit its parent. The
+// proportions are adjusted as described by split.AddNode.
+func (vs *vsplit) AddNode(n node, last bool) {
+	vs.split.AddNode(n, last)
+	n.SetParent(vs)
+}
+
+// AddNode adds n to the split as its last child if last is true and as its
+// first child otherwise. n gets an even share of the split, which is taken
+// from the other children in proportion to their size. Since the split
+// doesn't know the hsplit or vsplit that it belongs to, it cannot set the
+// parent of n; use the AddNode of the hsplit or vsplit instead.
+func (s *split) AddNode(n node, last bool) {
+	kept, flexible, fixedProp := s.room(n.String())
+
+	// Get the proportion of the new leaf.
+	chop := fullPortion / proportion(flexible+1)
+	newProp := (fullPortion - fixedProp) * chop
+
+	// Now push everything else over by an even amount.
+	for _, child := range s.children {
+		if !kept(child) {
+			child.SetProportion(
+				child.Proportion() - (child.Proportion() * chop))
+		}
+	}
+
+	n.SetProportion(newProp)
+
+	if last {
+		s.children = append(s.children, n)
+	} else {
+		s.children = append([]node{n}, s.children...)
+	}
+
+	s.checkPortions()
+	s.markDirty()
+}
+
+// insertAt adds n to the split as its child at index i, with the share that
+// AddNode gives it.
+func (s *split) insertAt(n node, i int) {
+	s.AddNode(n, true)
+	copy(s.children[i+1:], s.children[i:])
+	s.children[i] = n
+}
+
+// removeToOne removes n from the split like RemoveNode, except that all of
+// its proportion goes to a single sibling, chosen by policy (see
+// RemovalPolicy). Children with a fixed size and sticky leaves are passed
+// over. If there is no sibling to give it to, it is shared out by RemoveNode
+// instead.
+func (s *split) removeToOne(n node, policy RemovalPolicy) error {
+	i := s.ChildIndex(n)
+	if i < 0 {
+		return fmt.Errorf("The node '%s' is not in the split '%s'.", n, s)
+	}
+	flexible := func(child node) bool {
+		return child != n && child.FixedSize() <= 0 && !isSticky(child)
+	}
+
+	var taker node
+	switch policy {
+	case RemoveToNeighbor:
+		if i > 0 && flexible(s.children[i-1]) {
+			taker = s.children[i-1]
+		} else if i+1 < len(s.children) && flexible(s.children[i+1]) {
+			taker = s.children[i+1]
+		}
+	case RemoveToLargest:
+		for _, child := range s.children {
+			if flexible(child) && (taker == nil ||
+				child.Proportion() > taker.Proportion()) {
+
+				taker = child
+			}
+		}
+	}
+	if taker == nil {
+		return s.RemoveNode(n)
+	}
+
+	s.children = append(s.children[:i], s.children[i+1:]...)
+	taker.SetProportion(taker.Proportion() + n.Proportion())
+	s.checkPortions()
+	s.markDirty()
+	return nil
+}
+
+// addNodes adds nodes to the end of the split all at once. This is much
+// faster than adding them one at a time with AddNode when there are many of
+// them (e.g., when a session is restored), since the proportions are only
+// redistributed once. Together, the new nodes get as much of the split as
+// they would if it were balanced afterwards, and the flexible children (see
+// AddNode) keep their shares of the rest. If even is true, the new nodes get
+// equal shares. Otherwise, they are given shares in the ratio of the
+// proportions they already have, so that nodes added to an empty split keep
+// the proportions they were given. Like AddNode, addNodes cannot set the
+// parents of the nodes; use tree.addNodes instead.
+func (s *split) addNodes(nodes []node, even bool) {
+	if len(nodes) == 0 {
+		return
+	}
+	kept, flexible, fixedProp := s.room(
+		fmt.Sprintf("%d new nodes", len(nodes)))
+
+	chop := proportion(len(nodes)) / proportion(flexible+len(nodes))
+	for _, child := range s.children {
+		if !kept(child) {
+			child.SetProportion(child.Proportion() * (fullPortion - chop))
+		}
+	}
+
+	sum := proportion(0)
+	for _, n := range nodes {
+		if p := n.Proportion(); p.valid() && p > 0 {
+			sum += p
+		} else {
+			even = true
+		}
+	}
+	share := (fullPortion - fixedProp) * chop
+	for _, n := range nodes {
+		if even {
+			n.SetProportion(share / proportion(len(nodes)))
+		} else {
+			n.SetProportion(share * n.Proportion() / sum)
+		}
+	}
+
+	s.children = append(s.children, nodes...)
+	s.checkPortions()
+	s.markDirty()
+}
+
+// room returns which children of s keep their proportions when nodes are
+// added to it, the number of children that don't, and the sum of the
+// proportions of those that do. Children with a fixed size are kept, and so
+// are sticky leaves, so that new nodes only take space from the flexible
+// ones. But if the sticky leaves leave no space at all, they give way, and a
+// warning that names what was added is logged.
+func (s *split) room(added string) (kept func(child node) bool,
+	flexible int, fixedProp proportion) {
+
+	kept = func(child node) bool {
+		return child.FixedSize() > 0 || isSticky(child)
+	}
+	flexible, fixedProp = s.flexible(kept)
+	if fixedProp > fullPortion-epsilon && s.hasSticky() {
+		logger.Warning.Printf("The sticky children of '%s' leave no room "+
+			"for '%s', so they are shrunk anyway.", s, added)
+		kept = func(child node) bool { return child.FixedSize() > 0 }
+		flexible, fixedProp = s.flexible(kept)
+	}
+	return
+}
+
+// RemoveNode removes n from the split and distributes its proportion among
+// the remaining children. An error is returned (and nothing is changed) if n
+// is not a child of the split, which can happen if a client is removed twice.
+func (s *split) RemoveNode(n node) error {
+	// Remove it from the list of children.
+	removed := false
+	for i, child := range s.children {
+		if child == n {
+			s.children = append(s.children[:i], s.children[i+1:]...)
+			removed = true
+			break
+		}
+	}
+	if !removed {
+		return fmt.Errorf("The node '%s' is not in the split '%s'.", n, s)
+	}
+	s.markDirty()
+
+	// Distribute this node's portion to the rest.
+	// Give more to those who don't have much, and less to those who have
+	// a lot. Children with a fixed size and sticky leaves are left out,
+	// unless there are no other children to give it to.
+	if len(s.children) > 0 {
+		takers := make([]node, 0, len(s.children))
+		sum := proportion(0)
+		for _, child := range s.children {
+			if child.FixedSize() <= 0 && !isSticky(child) {
+				takers = append(takers, child)
+				sum += child.Proportion()
+			}
+		}
+		if len(takers) == 0 {
+			if s.hasSticky() {
+				logger.Warning.Printf("Every child left in '%s' is sticky "+
+					"or fixed, so they grow anyway.", s)
+			}
+			takers, sum = s.children, 1.0-n.Proportion()
+		}
+		if sum <= 0 {
+			// The remaining children had nothing, so share it evenly rather
+			// than dividing by zero.
+			s.normalize()
+			return nil
+		}
+		normalized := make([]proportion, len(takers))
+		for i, child := range takers {
+			normalized[i] = child.Proportion() / sum
+		}
+		for i, child := range takers {
+			child.SetProportion(
+				child.Proportion() + normalized[i]*n.Proportion())
+		}
+
+		s.checkPortions()
+	}
+	return nil
+}
+
+// flexible returns the number of children of s for which kept returns false,
+// and the sum of the proportions of the others.
+func (s *split) flexible(kept func(child node) bool) (int, proportion) {
+	flexible, keptProp := 0, proportion(0)
+	for _, child := range s.children {
+		if kept(child) {
+			keptProp += child.Proportion()
+		} else {
+			flexible++
+		}
+	}
+	return flexible, keptProp
+}
+
+// hasSticky returns true if some child of s is a sticky leaf.
+func (s *split) hasSticky() bool {
+	for _, child := range s.children {
+		if isSticky(child) {
+			return true
+		}
+	}
+	return false
+}
+
+// equalize gives every child of s that isn't a sticky leaf an equal share of
+// what the sticky leaves leave over. It returns false, and logs a warning, if
+// every child is sticky.
+func (s *split) equalize() bool {
+	flexible, free := s.flexible(isSticky)
+	if flexible == 0 {
+		logger.Warning.Printf("Every child of '%s' is sticky, so there is "+
+			"nothing to balance.", s)
+		return false
+	}
+	even := (fullPortion - free) / proportion(flexible)
+	for _, child := range s.children {
+		if !isSticky(child) {
+			child.SetProportion(even)
+		}
+	}
+	s.checkPortions()
+	return true
+}
+
+func (s *split) SetChildProportion(n node, newProp proportion) {
+	// An only child has no siblings to take the difference from.
+	if s.Size() < 2 {
+		return
+	}
+
+	// Find the difference between the old proportion and the new. Then
+	// spread the difference over the node's siblings.
+	diff := n.Proportion() - newProp
+	chops := diff / proportion(s.Size()-1)
+
+	// Normalize proportions that don't include the 'n' node.
+	// normalized := make([]proportion, 0, s.Size() - 1)
+	// sum := proportion(0)
+	// for _, child := range s.children {
+	// if child != n {
+	// sum += child.Proportion()
+	// }
+	// }
+	// for _, child := range s.children {
+	// if child != n {
+	// normalized = append(normalized, child.Proportion() / sum)
+	// }
+	// }
+
+	for _, child := range s.children {
+		if child != n {
+			child.SetProportion(child.Proportion() + chops)
+		}
+	}
+	n.SetProportion(newProp)
+	s.checkPortions()
+}
+
+// setMinProportion sets the smallest proportion that resizeChild will
+// shrink any child of this split to.
+func (s *split) setMinProportion(p proportion) {
+	s.minProp = p
+}
+
+// SetProportionBounds sets the smallest and largest proportions that an
+// interactive resize (resizeChild, transfer, resizeLeaf or grow) will shrink
+// or grow a child of the split n (or of the split containing n, if n isn't a
+// split) to. A resize that would go past a bound stops at it. An error is
+// returned if there is no such split, or unless 0 <= min <= max <= 1.
+func (t *tree) SetProportionBounds(n node, min, max proportion) error {
+	t.Lock()
+	defer t.Unlock()
+
+	if min < 0 || min > max || max > fullPortion {
+		return fmt.Errorf("Proportion bounds must be between 0 and 1, with "+
+			"the minimum no larger than the maximum, but got [%f, %f].",
+			min, max)
+	}
+	s := asSplit(n)
+	if s == nil && n.Parent() != nil {
+		s = asSplit(n.Parent())
+	}
+	if s == nil {
+		return fmt.Errorf("The node '%s' is not in a split.", n)
+	}
+	s.minProp, s.maxProp = min, max
+	return nil
+}
+
+// setAnchor sets the edge of a child that stays put when it is resized with
+// resizeChild. If a is anchorCenter, resizeLeaf also keeps the child
+// centered, whichever direction it is resized in.
+func (s *split) setAnchor(a anchor) {
+	s.anchor = a
+}
+
+// setResizeThreshold sets the smallest change in proportion that
+// resizeChild will make. A threshold of zero makes every delta count.
+func (s *split) setResizeThreshold(p proportion) {
+	s.threshold = p
+	s.pending, s.pendingChild = 0, nil
+}
+
+// resizeChild grows the child n by delta and shrinks its immediate sibling
+// by the same amount. The sibling is the next child, unless n is the last
+// child, in which case it is the previous child. No other children are
+// affected, which makes this the operation for dragging a single divider.
+// If the split is anchored at the end, the previous child is preferred
+// instead, and if it is anchored at the center, both are shrunk (see
+// resizeCentered). The amount of proportion actually moved is returned.
+//
+// To keep windows from jittering during a drag, a delta smaller than the
+// split's threshold isn't applied right away. Instead, it is added to the
+// deltas saved up for n since the last resize, and the resize happens once
+// their sum reaches the threshold. Resizing a different child starts over.
+func (s *split) resizeChild(n node, delta proportion) proportion {
+	i := s.ChildIndex(n)
+	if i < 0 || len(s.children) < 2 {
+		return 0
+	}
+	if n != s.pendingChild {
+		s.pending, s.pendingChild = 0, n
+	}
+	s.pending += delta
+	if math.Abs(float64(s.pending)) < float64(s.threshold) {
+		return 0
+	}
+	delta, s.pending = s.pending, 0
+	switch {
+	case s.anchor == anchorCenter:
+		return s.resizeCentered(n, delta)
+	case s.anchor == anchorEnd && i > 0:
+		return s.resizeBetween(n, s.children[i-1], delta)
+	case i < len(s.children)-1:
+		return s.resizeBetween(n, s.children[i+1], delta)
+	}
+	return s.resizeBetween(n, s.children[i-1], delta)
+}
+
+// resizeCentered grows n by delta, taking half of it from the sibling before
+// n and half from the sibling after it, so that n stays centered. If one of
+// them can't give up its half without dropping below the split's minimum
+// proportion, the other one makes up for it. If n is the first or last
+// child, all of delta is taken from its only neighbor. A negative delta
+// shrinks n and gives the space to its neighbors in the same way. The amount
+// of proportion actually moved is returned.
+func (s *split) resizeCentered(n node, delta proportion) proportion {
+	i := s.ChildIndex(n)
+	if i < 0 || len(s.children) < 2 {
+		return 0
+	}
+	if i == 0 {
+		return s.resizeBetween(n, s.children[1], delta)
+	}
+	if i == len(s.children)-1 {
+		return s.resizeBetween(n, s.children[i-1], delta)
+	}
+
+	before, after := s.children[i-1], s.children[i+1]
+	moved := s.resizeBetween(n, before, delta/2)
+	moved += s.resizeBetween(n, after, delta-moved)
+	if !moved.Equal(delta) {
+		moved += s.resizeBetween(n, before, delta-moved)
+	}
+	return moved
+}
+
+// resizeBothSides grows n by delta, taking half of it from the sibling
+// before n and half from the sibling after it, so that both of its dividers
+// move. Unlike resizeCentered, each sibling is clamped on its own: if one of
+// them can't give up its whole half without dropping below the split's
+// minimum proportion, the other one still only gives up its half, and the
+// divider next to n on that side just moves less. If n is the first or last
+// child, all of delta is taken from its only neighbor, like resizeChild
+// does. A negative delta shrinks n and gives the space to its neighbors in
+// the same way. The amount of proportion actually moved is returned.
+func (s *split) resizeBothSides(n node, delta proportion) proportion {
+	i := s.ChildIndex(n)
+	if i < 0 || len(s.children) < 2 {
+		return 0
+	}
+	if i == 0 {
+		return s.resizeBetween(n, s.children[1], delta)
+	}
+	if i == len(s.children)-1 {
+		return s.resizeBetween(n, s.children[i-1], delta)
+	}
+	moved := s.resizeBetween(n, s.children[i-1], delta/2)
+	return moved + s.resizeBetween(n, s.children[i+1], delta/2)
+}
+
+// resizeBetween grows n by delta and shrinks sibling by delta. The delta is
+// clamped so that neither node drops below the split's minimum proportion or
+// grows past its maximum proportion. The clamped delta is returned.
+func (s *split) resizeBetween(n, sibling node, delta proportion) proportion {
+	switch {
+	case delta > 0:
+		if most := sibling.Proportion() - s.minProp; delta > most {
+			delta = most
+		}
+		if most := s.maxProp - n.Proportion(); delta > most {
+			delta = most
+		}
+		if delta < 0 {
+			delta = 0
+		}
+	case delta < 0:
+		if least := s.minProp - n.Proportion(); delta < least {
+			delta = least
+		}
+		if least := sibling.Proportion() - s.maxProp; delta < least {
+			delta = least
+		}
+		if delta > 0 {
+			delta = 0
+		}
+	}
+
+	n.SetProportion(n.Proportion() + delta)
+	sibling.SetProportion(sibling.Proportion() - delta)
+	s.checkPortions()
+	return delta
+}
+
+// transfer moves delta from the child from to the child to, which need not
+// be adjacent, clamped like resizeBetween so that from doesn't drop below
+// the split's minimum proportion and to doesn't grow past its maximum. The
+// amount actually moved is returned. An error is returned if either node
+// isn't a child of s, or if they're the same node.
+func (s *split) transfer(from, to node, delta proportion) (proportion, error) {
+	if s.ChildIndex(from) < 0 {
+		return 0, fmt.Errorf("The node '%s' is not in the split '%s'.",
+			from, s)
+	}
+	if s.ChildIndex(to) < 0 {
+		return 0, fmt.Errorf("The node '%s' is not in the split '%s'.",
+			to, s)
+	}
+	if from == to {
+		return 0, fmt.Errorf("Cannot transfer space from '%s' to itself.",
+			from)
+	}
+	return s.resizeBetween(to, from, delta), nil
+}
+
+// claim gives the child n the proportion p, making room for it by scaling
+// the children that don't have a fixed size and aren't sticky, so that they
+// keep their shares among themselves. p is clamped so that none of them drops
+// below the split's minimum proportion. Nothing happens if there are no such
+// children.
+func (s *split) claim(n node, p proportion) {
+	others, sum, free := 0, proportion(0), fullPortion
+	for _, child := range s.children {
+		switch {
+		case child == n:
+		case child.FixedSize() > 0 || isSticky(child):
+			free -= child.Proportion()
+		default:
+			others++
+			sum += child.Proportion()
+		}
+	}
+	if others == 0 || s.ChildIndex(n) < 0 {
+		return
+	}
+	if most := free - s.minProp*proportion(others); p > most {
+		p = most
+	}
+	if p < s.minProp {
+		return
+	}
+
+	for _, child := range s.children {
+		if child == n || child.FixedSize() > 0 || isSticky(child) {
+			continue
+		}
+		if sum > 0 {
+			child.SetProportion(child.Proportion() / sum * (free - p))
+		} else {
+			child.SetProportion((free - p) / proportion(others))
+		}
+	}
+	n.SetProportion(p)
+	s.checkPortions()
+	s.markDirty()
+}
+
+// growFromLargest grows the leaf of c (or its stack) by delta within its
+// split, taking the space from its largest sibling wherever it is. If c is
+// active and a stack or split is selected, the selection is grown instead.
+// false is returned if c isn't in a split with at least one other child, or
+// if nothing could be moved.
+func (t *tree) growFromLargest(c Client, delta proportion) bool {
+	return t.mutate("growFromLargest", func() bool {
+		lf := t.findLeaf(c)
+		if lf == nil {
+			return false
+		}
+		n := t.scope(lf)
+		if st, ok := lf.parent.(*stack); ok && n == node(lf) {
+			n = st
+		}
+		s := asSplit(n.Parent())
+		if s == nil {
+			return false
+		}
+
+		var largest node
+		for _, child := range s.children {
+			if child != n && (largest == nil ||
+				child.Proportion() > largest.Proportion()) {
+
+				largest = child
+			}
+		}
+		if largest == nil {
+			return false
+		}
+		moved, err := s.transfer(largest, n, delta)
+		if err != nil {
+			logger.Warning.Println(err)
+			return false
+		}
+		return moved != 0
+	})
+}
+
+// refreshConstraints makes the tree catch up with a change to the size hints
+// of c. If the cell of c was smaller than the new minimum size of c the last
+// time the tree was placed, the cell is grown to fit it along each axis that
+// is too short, taking the space from its siblings in the innermost split
+// along that axis (see split.claim). The tree is placed again afterwards,
+// which falls back to stacking if there still isn't enough room. false is
+// returned if c isn't in the tree.
+func (t *tree) refreshConstraints(c Client) bool {
+	return t.mutate("refreshConstraints", func() bool {
+		lf := t.findLeaf(c)
+		if lf == nil {
+			return false
+		}
+		markDirty(lf)
+		var child node = lf
+		if st, ok := lf.parent.(*stack); ok {
+			child = st
+		}
+		if lf.rect != nil {
+			minw, minh := lf.MinSize(t)
+			t.growBy(child, true, minw-lf.rect.Width())
+			t.growBy(child, false, minh-lf.rect.Height())
+		}
+		t.replace()
+		return true
+	})
 }
 
-type leaf struct {
-	parent splitter
-	client Client
-	prop   proportion
+// growBy grows n by px pixels along the horizontal or vertical axis, in the
+// innermost split along that axis that contains it. The pixels are turned
+// into a proportion with the size of that split the last time it was placed,
+// so this does nothing if it hasn't been placed yet.
+func (t *tree) growBy(n node, horizontal bool, px int) {
+	if px <= 0 {
+		return
+	}
+	for child, p := n, n.Parent(); p != nil; child, p = p, p.Parent() {
+		s := asSplit(p)
+		if s == nil || isHorizontal(p) != horizontal {
+			continue
+		}
+		r := p.cache().rect
+		if r == nil {
+			return
+		}
+		length := r.Height()
+		if horizontal {
+			length = r.Width()
+		}
+		length -= t.gap() * (s.Size() - 1)
+		if length > 0 {
+			delta := proportion(px) / proportion(length)
+			s.claim(child, child.Proportion()+delta)
+		}
+		return
+	}
 }
 
-func newTree() *tree {
-	return &tree{
-		child: nil,
+// divide divides size pixels according to the proportions props, after
+// taking out gap pixels between each pair of adjacent pieces. mins[i] is the
+// smallest number of pixels that piece i may be given. Each piece's minimum
+// is reserved first, and the remaining space is distributed proportionally
+// among the pieces that don't need more than their share. Thus, if every
+// piece's share already satisfies its minimum, the result is identical to a
+// plain proportional division (corrected for rounding by fillRemainder).
+// Pieces are rounded according to mode.
+//
+// If fixed is not nil, a piece with a positive fixed[i] is given exactly that
+// many pixels (or its minimum, if that is larger) before anything else, and
+// only the space left over is divided among the other pieces, in proportion
+// to their share of the proportions of the pieces that aren't fixed.
+//
+// If the minimums cannot all be satisfied, each piece gets an even share and
+// false is returned so the caller knows that the layout is infeasible.
+func divide(size, gap int, mode RoundMode,
+	props []proportion, mins, fixed []int) ([]int, bool) {
+
+	out := make([]int, len(props))
+	if len(out) == 0 {
+		return out, true
+	}
+	size -= gap * (len(out) - 1)
+	if fixed != nil {
+		pieces, ok, found := divideFixed(size, mode, props, mins, fixed)
+		if found {
+			return pieces, ok
+		}
 	}
-}
 
-func (t *tree) place(geom xrect.Rect) bool {
-	if t.child == nil || geom == nil {
-		return false
+	sumMin := 0
+	for _, min := range mins {
+		sumMin += min
+	}
+	if sumMin > size || size < 0 {
+		even := fullPortion / proportion(len(out))
+		for i := range out {
+			out[i] = even.portionBy(mode, size)
+		}
+		if size >= 0 {
+			fillRemainder(out, size, nil)
+		}
+		return out, false
 	}
 
-	x, y, w, h := geom.X(), geom.Y(), geom.Width(), geom.Height()
-	if !t.child.ValidDims(w, h, 1, 1, w, h) {
-		return false
+	reserved := make([]bool, len(out))
+	for {
+		remaining, sum := size, proportion(0)
+		for i, p := range props {
+			if reserved[i] {
+				remaining -= out[i]
+			} else {
+				sum += p
+			}
+		}
+
+		more := false
+		for i, p := range props {
+			if reserved[i] {
+				continue
+			}
+			if remaining == size {
+				out[i] = p.portionBy(mode, size)
+			} else if sum > 0 {
+				out[i] = (p / sum).portionBy(mode, remaining)
+			} else {
+				out[i] = 0
+			}
+			if out[i] < mins[i] {
+				out[i] = mins[i]
+				reserved[i] = true
+				more = true
+			}
+		}
+		if !more {
+			break
+		}
 	}
-	t.child.MoveResize(x, y, w, h)
-	return true
+	fillRemainder(out, size, mins)
+	return out, true
 }
 
-func (t *tree) setChild(n node) {
-	t.child = n
-}
+// divideFixed divides size pixels (with the gaps already taken out) among
+// pieces of which some have a fixed size, as described by divide. found is
+// false if no piece has a fixed size, in which case nothing is divided. ok is
+// false if the fixed sizes leave too little room, or if the minimums of the
+// other pieces don't fit in what is left, just like the result of divide.
+func divideFixed(size int, mode RoundMode, props []proportion,
+	mins, fixed []int) (pieces []int, ok, found bool) {
 
-func (t *tree) switchClients(lf1, lf2 *leaf) {
-	if lf1 == nil || lf2 == nil {
-		return
+	pieces = make([]int, len(props))
+	flexProps, flexMins := []proportion{}, []int{}
+	reserved, flexSum := 0, proportion(0)
+	for i := range props {
+		if fixed[i] > 0 {
+			pieces[i] = misc.Max(fixed[i], mins[i])
+			reserved += pieces[i]
+			found = true
+			continue
+		}
+		flexProps = append(flexProps, props[i])
+		flexMins = append(flexMins, mins[i])
+		flexSum += props[i]
+	}
+	if !found {
+		return nil, false, false
 	}
-	lf1.client, lf2.client = lf2.client, lf1.client
-}
 
-func (t *tree) findLeaf(c Client) *leaf {
-	if t.child == nil {
-		return nil
+	left := size - reserved
+	if len(flexProps) == 0 {
+		// With nothing to absorb the difference, the last piece takes it so
+		// that the pieces still tile the whole size.
+		if left >= 0 {
+			fillRemainder(pieces, size, nil)
+		}
+		return pieces, left >= 0, true
 	}
-	var lf *leaf
-	t.child.VisitLeafNodes(func(visit *leaf) bool {
-		if visit.client == c {
-			lf = visit
-			return false // stop visiting
+	for i := range flexProps {
+		if flexSum > 0 {
+			flexProps[i] /= flexSum
+		} else {
+			flexProps[i] = fullPortion / proportion(len(flexProps))
 		}
-		return true // keep going
-	})
-	return lf
+	}
+	flex, ok := divide(left, 0, mode, flexProps, flexMins, nil)
+	for i := range pieces {
+		if fixed[i] <= 0 {
+			pieces[i], flex = flex[0], flex[1:]
+		}
+	}
+	return pieces, ok && left >= 0, true
 }
 
-func newLeaf(parent splitter, client Client) *leaf {
-	return &leaf{
-		parent: parent,
-		client: client,
+// fillRemainder corrects the rounding error of pieces that should add up to
+// exactly size pixels. Since each piece is rounded independently, the sum can
+// be a few pixels off, which would leave a sliver (or an overlap) at the end
+// of the split. The difference is given to the last piece that can take it
+// without going below its minimum in mins (which may be nil).
+func fillRemainder(pieces []int, size int, mins []int) {
+	diff := size
+	for _, piece := range pieces {
+		diff -= piece
+	}
+	for i := len(pieces) - 1; i >= 0 && diff != 0; i-- {
+		if mins == nil || pieces[i]+diff >= mins[i] {
+			pieces[i] += diff
+			return
+		}
 	}
 }
 
-func newHSplit(parent node) *hsplit {
-	return &hsplit{split{
-		parent:   parent,
-		children: make([]node, 0),
-		saved:    make([]proportion, 0),
-	}}
+// fixedSizes returns the scaled fixed size of each child of s, or nil if none
+// of them has one.
+func (s *split) fixedSizes(t *tree) []int {
+	var sizes []int
+	for i, child := range s.children {
+		if child.FixedSize() <= 0 {
+			continue
+		}
+		if sizes == nil {
+			sizes = make([]int, len(s.children))
+		}
+		sizes[i] = t.px(child.FixedSize())
+	}
+	return sizes
 }
 
-func newVSplit(parent node) *vsplit {
-	return &vsplit{split{
-		parent:   parent,
-		children: make([]node, 0),
-		saved:    make([]proportion, 0),
-	}}
+// props returns the proportions of the children of s.
+func (s *split) props() []proportion {
+	props := make([]proportion, len(s.children))
+	for i, child := range s.children {
+		props[i] = child.Proportion()
+	}
+	return props
 }
 
-func (s *split) Proportion() proportion {
-	return s.prop
-}
+// spans returns the offset (from the start of s) and length of each child of
+// s along its axis, given that s is size pixels long along that axis.
+// horizontal indicates whether that axis is the x-axis.
+//
+// If the children cannot all be given at least the tree's minimum leaf size,
+// the children that don't fit are stacked in the same cell as the last child
+// that does fit. If the tree scrolls overflowing splits, the children that
+// fit are shown starting at the scroll offset instead, and the others are
+// put just outside of s (see scrollSpans).
+//
+// false is returned if the minimum sizes of the children cannot be satisfied.
+func (s *split) spans(t *tree, size int,
+	horizontal bool) (offsets, lengths []int, ok bool) {
 
-func (s *split) SetProportion(p proportion) {
-	s.prop = p
-}
+	props, mins := s.props(), s.childMins(t, horizontal)
+	lengths, ok = divide(size, t.gap(), t.roundMode, props, mins,
+		s.fixedSizes(t))
+	offsets = make([]int, len(lengths))
 
-func (s *split) checkPortions() {
-	if len(s.children) == 0 {
-		return
+	fit := len(s.children)
+	if !ok && t.minLeaf() > 0 {
+		fit = (size + t.gap()) / (t.minLeaf() + t.gap())
+		if fit < 1 {
+			fit = 1
+		}
 	}
-
-	sum := proportion(0)
-	for _, child := range s.children {
-		sum += child.Proportion()
+	if fit >= len(s.children) {
+		next := 0
+		for i := range lengths {
+			offsets[i] = next
+			next += lengths[i] + t.gap()
+		}
+		return offsets, lengths, ok
 	}
-	if !sum.equal(fullPortion) {
-		panic(fmt.Sprintf("portions not equal: %f != %f", sum, fullPortion))
+
+	if t.scrollOverflow {
+		return s.scrollSpans(t, size, fit, props, mins)
 	}
-}
 
-func (s *split) Parent() node {
-	return s.parent
+	// Fold the overflowing children into the last cell that fits. Fixed sizes
+	// are ignored here, since the children don't fit anyway.
+	slotProps, slotMins := props[:fit:fit], mins[:fit:fit]
+	for i := fit; i < len(props); i++ {
+		slotProps[fit-1] += props[i]
+		slotMins[fit-1] = misc.Max(slotMins[fit-1], mins[i])
+	}
+	slots, ok := divide(size, t.gap(), t.roundMode, slotProps, slotMins,
+		nil)
+	next := 0
+	for i := range lengths {
+		if i < fit {
+			offsets[i], lengths[i] = next, slots[i]
+			next += slots[i] + t.gap()
+		} else {
+			offsets[i], lengths[i] = offsets[fit-1], lengths[fit-1]
+		}
+	}
+	return offsets, lengths, ok
 }
 
-func (s *split) SetParent(n node) {
-	s.parent = n
-}
+// scrollSpans is spans for a split of which only fit children can be shown.
+// The children from the scroll offset on divide the whole size of s among
+// themselves, while the ones before them are put just before the start of s
+// and the ones after them just after its end, where they are hidden by
+// MoveResize. The scroll offset is clamped so that fit children are shown.
+func (s *split) scrollSpans(t *tree, size, fit int, props []proportion,
+	mins []int) (offsets, lengths []int, ok bool) {
 
-func (s *split) VisitLeafNodes(f func(lf *leaf) bool) bool {
-	for _, child := range s.children {
-		if !child.VisitLeafNodes(f) {
-			return false
+	s.scrollOffset = misc.Max(0, misc.Min(s.scrollOffset, len(props)-fit))
+	first, last := s.scrollOffset, s.scrollOffset+fit
+	shownProps, sum := make([]proportion, fit), proportion(0)
+	for _, p := range props[first:last] {
+		sum += p
+	}
+	for i, p := range props[first:last] {
+		if sum > 0 {
+			shownProps[i] = p / sum
+		} else {
+			shownProps[i] = fullPortion / proportion(fit)
 		}
 	}
-	return true
-}
+	shown, ok := divide(size, t.gap(), t.roundMode, shownProps,
+		mins[first:last], nil)
 
-func (s *split) AddNode(n node, last bool) {
-	// Get the proportion of the new leaf.
-	newProp := fullPortion / proportion(len(s.children)+1)
-
-	// Now push everything else over by an even amount.
-	if len(s.children) > 0 {
-		// chop := newProp / proportion(len(s.children))
-		for _, child := range s.children {
-			child.SetProportion(
-				child.Proportion() - (child.Proportion() * newProp))
+	offsets, lengths = make([]int, len(props)), make([]int, len(props))
+	next := 0
+	for i := range props {
+		switch {
+		case i < first:
+			offsets[i], lengths[i] = -size-t.gap(), shown[0]
+		case i >= last:
+			offsets[i], lengths[i] = size+t.gap(), shown[fit-1]
+		default:
+			offsets[i], lengths[i] = next, shown[i-first]
+			next += shown[i-first] + t.gap()
 		}
 	}
+	return offsets, lengths, ok
+}
 
-	n.SetProportion(newProp)
+// scroll moves the children that are shown by a split that overflows (when
+// the tree scrolls overflowing splits) delta children towards its end, or
+// towards its start if delta is negative. The offset stops at the first and
+// last children. The tree must be placed again to show the change.
+func (s *split) scroll(delta int) {
+	s.scrollOffset = misc.Max(0,
+		misc.Min(s.scrollOffset+delta, len(s.children)-1))
+	s.markDirty()
+}
 
-	if last {
-		s.children = append(s.children, n)
-	} else {
-		s.children = append([]node{n}, s.children...)
-	}
+// markDirty is markDirty for s, which can't be passed to markDirty itself
+// since it isn't a node (only the hsplit or vsplit containing it is).
+func (s *split) markDirty() {
+	s.dirty = true
+	markDirty(s.parent)
+}
 
-	s.checkPortions()
+// moveChildren gives each child of s its geometry in rects, where cell is the
+// geometry of s itself. Children that are placed outside of cell (because
+// the split scrolls) have their clients unmapped, and are mapped again once
+// they are back inside.
+func (s *split) moveChildren(t *tree, cell xrect.Rect, rects []xrect.Rect) {
+	hiding := false
+	for i, r := range rects {
+		child := s.children[i]
+		if outside(r, cell) {
+			t.moveNode(child, r)
+			child.VisitLeafNodes(func(lf *leaf) bool {
+				t.hide(lf.client)
+				return true
+			})
+			hiding = true
+			continue
+		}
+		if s.hiding {
+			showActiveTabs(t, child)
+			child.VisitLeafNodes(func(lf *leaf) bool {
+				if _, ok := lf.parent.(*stack); !ok {
+					t.show(lf.client)
+				}
+				return true
+			})
+		}
+		t.moveNode(child, r)
+	}
+	s.hiding = hiding
 }
 
-func (s *split) RemoveNode(n node) {
-	// Remove it from the list of children.
-	removed := false
+// syncFixed brings the proportions of the children of s with a fixed size in
+// line with the pixels they were just given, so that a fixed size that stays
+// put while the screen changes size also takes up a different share of it.
+// lengths are the pixels given to each child out of the size of s. The other
+// children are scaled so that they keep their shares of the rest, which
+// doesn't change their geometry. Nothing is changed unless every fixed child
+// really got its fixed size (which it doesn't when s overflows).
+func (s *split) syncFixed(t *tree, size int, lengths []int) {
+	size -= t.gap() * (len(lengths) - 1)
+	if size <= 0 || len(lengths) != len(s.children) {
+		return
+	}
+	fixedShare, flexSum, found := proportion(0), proportion(0), false
 	for i, child := range s.children {
-		if child == n {
-			s.children = append(s.children[:i], s.children[i+1:]...)
-			removed = true
+		if child.FixedSize() <= 0 {
+			flexSum += child.Proportion()
+			continue
+		}
+		if lengths[i] != t.px(child.FixedSize()) {
+			return
 		}
+		fixedShare += proportion(lengths[i]) / proportion(size)
+		found = true
 	}
-	if !removed {
-		panic(fmt.Sprintf("The node '%s' is not in the split '%s'.", n, s))
+	if !found || flexSum <= 0 || fixedShare >= fullPortion {
+		return
 	}
-
-	// Distribute this node's portion to the rest.
-	// Give more to those who don't have much, and less to those who have
-	// a lot.
-	if len(s.children) > 0 {
-		normalized := make([]proportion, len(s.children))
-		sum := 1.0 - n.Proportion()
-		for i, child := range s.children {
-			normalized[i] = child.Proportion() / sum
-		}
-		for i, child := range s.children {
+	for i, child := range s.children {
+		if child.FixedSize() > 0 {
+			child.SetProportion(proportion(lengths[i]) / proportion(size))
+		} else {
 			child.SetProportion(
-				child.Proportion() + normalized[i]*n.Proportion())
+				child.Proportion() / flexSum * (fullPortion - fixedShare))
 		}
+	}
+	s.checkPortions()
+}
 
-		s.checkPortions()
+// outside returns true if r and cell don't overlap at all.
+func outside(r, cell xrect.Rect) bool {
+	return r.X()+r.Width() <= cell.X() || r.X() >= cell.X()+cell.Width() ||
+		r.Y()+r.Height() <= cell.Y() || r.Y() >= cell.Y()+cell.Height()
+}
+
+// childMins returns the minimum width (if horizontal is true) or height of
+// each child of s.
+func (s *split) childMins(t *tree, horizontal bool) []int {
+	mins := make([]int, len(s.children))
+	for i, child := range s.children {
+		w, h := child.MinSize(t)
+		if horizontal {
+			mins[i] = w
+		} else {
+			mins[i] = h
+		}
 	}
+	return mins
 }
 
-func (s *split) SetChildProportion(n node, newProp proportion) {
-	// Find the difference between the old proportion and the new. Then
-	// spread the difference over the node's siblings.
-	diff := n.Proportion() - newProp
-	chops := diff / proportion(s.Size()-1)
+// flatten splices the children of every child split that has the same
+// orientation as s directly into s, in place of that child. The spliced
+// children's proportions are scaled by the proportion of the split they came
+// from, so that the geometry of the tree is unchanged (ignoring gaps).
+// self must be the hsplit or vsplit that s belongs to. If max is positive, a
+// child split is left alone if splicing it would give s more than max
+// children.
+func (s *split) flatten(self node, max int) {
+	for i := 0; i < len(s.children); {
+		child := s.children[i]
+		cs := asSplit(child)
+		if cs == nil || len(cs.children) == 0 ||
+			isHorizontal(child) != isHorizontal(self) ||
+			(max > 0 && len(s.children)-1+len(cs.children) > max) {
 
-	// Normalize proportions that don't include the 'n' node.
-	// normalized := make([]proportion, 0, s.Size() - 1)
-	// sum := proportion(0)
-	// for _, child := range s.children {
-	// if child != n {
-	// sum += child.Proportion()
-	// }
-	// }
-	// for _, child := range s.children {
-	// if child != n {
-	// normalized = append(normalized, child.Proportion() / sum)
-	// }
-	// }
+			i++
+			continue
+		}
 
-	for _, child := range s.children {
-		if child != n {
-			child.SetProportion(child.Proportion() + chops)
+		spliced := make([]node, 0, len(s.children)+len(cs.children)-1)
+		spliced = append(spliced, s.children[:i]...)
+		for _, grandchild := range cs.children {
+			grandchild.SetProportion(
+				grandchild.Proportion() * child.Proportion())
+			grandchild.SetParent(self)
+			spliced = append(spliced, grandchild)
 		}
+		spliced = append(spliced, s.children[i+1:]...)
+		s.children = spliced
+
+		// Don't advance i, since the spliced children may be splits with the
+		// same orientation too.
 	}
-	n.SetProportion(newProp)
 	s.checkPortions()
 }
 
@@ -300,51 +4070,217 @@ func (s *split) PropsClear() {
 	s.saved = s.saved[:0]
 }
 
-func (hs *hsplit) MoveResize(x, y, width, height int) {
+// firstLeaf returns the first leaf visited in n, or nil if n has no leaves.
+func firstLeaf(n node) *leaf {
+	var first *leaf
+	n.VisitLeafNodes(func(lf *leaf) bool {
+		first = lf
+		return false
+	})
+	return first
+}
+
+// childRects returns the geometry of each child of n when n is given the
+// geometry (x, y, width, height). It returns nil if n has no children.
+// Everything that needs to know where nodes are should use this, so that
+// the results always match what MoveResize does.
+func childRects(t *tree, n node, x, y, width, height int) []xrect.Rect {
+	switch n := n.(type) {
+	case *hsplit:
+		return n.childRects(t, x, y, width, height)
+	case *vsplit:
+		return n.childRects(t, x, y, width, height)
+	case *grid:
+		return n.childRects(t, x, y, width, height)
+	case *stack:
+		rects := make([]xrect.Rect, len(n.leaves))
+		for i := range rects {
+			rects[i] = xrect.New(x, y, width, height)
+		}
+		return rects
+	}
+	return nil
+}
+
+func (hs *hsplit) childRects(t *tree, x, y, width, height int) []xrect.Rect {
 	// In hsplits, y and height remain constant. Width varies based on the
 	// proportion, and x is derived from width.
-	nextx := x
-	for _, child := range hs.children {
-		w := child.Proportion().portion(width)
-		child.MoveResize(nextx, y, w, height)
-		nextx += w
+	xs, ws, _ := hs.spans(t, width, true)
+	rects := make([]xrect.Rect, len(ws))
+	for i := range hs.children {
+		rects[i] = xrect.New(x+xs[i], y, ws[i], height)
 	}
+	return rects
 }
 
-func (hs *hsplit) ValidDims(w, h, minw, minh, maxw, maxh int) bool {
-	for _, child := range hs.children {
-		childw := child.Proportion().portion(w)
-		if !child.ValidDims(childw, h, minw, minh, maxw, maxh) {
-			return false
+func (hs *hsplit) MoveResize(t *tree, x, y, width, height int) {
+	rects := hs.childRects(t, x, y, width, height)
+	hs.moveChildren(t, xrect.New(x, y, width, height), rects)
+
+	lengths := make([]int, len(rects))
+	for i, r := range rects {
+		lengths[i] = r.Width()
+	}
+	hs.syncFixed(t, width, lengths)
+}
+
+func (hs *hsplit) ValidDims(t *tree, w, h, minw, minh, maxw, maxh int) bool {
+	_, lf := hs.validDimsReason(t, w, h, minw, minh, maxw, maxh)
+	return lf == nil
+}
+
+func (hs *hsplit) validDimsReason(t *tree,
+	w, h, minw, minh, maxw, maxh int) (bool, *leaf) {
+
+	_, ws, ok := hs.spans(t, w, true)
+	for i, child := range hs.children {
+		small, lf := child.validDimsReason(t, ws[i], h, minw, minh, maxw, maxh)
+		if lf != nil {
+			return small, lf
 		}
 	}
-	return true
+	if !ok {
+		return true, firstLeaf(hs)
+	}
+	return false, nil
+}
+
+// MinSize for an hsplit is the sum of its children's minimum widths (plus
+// the gaps between them) and the largest of its children's minimum heights.
+func (hs *hsplit) MinSize(t *tree) (width, height int) {
+	for i, child := range hs.children {
+		w, h := child.MinSize(t)
+		if i > 0 {
+			width += t.gap()
+		}
+		width += misc.Max(w, t.px(child.FixedSize()))
+		height = misc.Max(height, h)
+	}
+	return
 }
 
-func (vs *vsplit) MoveResize(x, y, width, height int) {
+func (vs *vsplit) childRects(t *tree, x, y, width, height int) []xrect.Rect {
 	// In vsplits, x and width remain constant. Height varies based on the
 	// proportion, and y is derived from height.
-	nexty := y
-	for _, child := range vs.children {
-		h := child.Proportion().portion(height)
-		child.MoveResize(x, nexty, width, h)
-		nexty += h
+	ys, hs, _ := vs.spans(t, height, false)
+	rects := make([]xrect.Rect, len(hs))
+	for i := range vs.children {
+		rects[i] = xrect.New(x, y+ys[i], width, hs[i])
 	}
+	return rects
 }
 
-func (vs *vsplit) ValidDims(w, h, minw, minh, maxw, maxh int) bool {
-	for _, child := range vs.children {
-		childh := child.Proportion().portion(h)
-		if !child.ValidDims(w, childh, minw, minh, maxw, maxh) {
-			return false
+func (vs *vsplit) MoveResize(t *tree, x, y, width, height int) {
+	rects := vs.childRects(t, x, y, width, height)
+	vs.moveChildren(t, xrect.New(x, y, width, height), rects)
+
+	lengths := make([]int, len(rects))
+	for i, r := range rects {
+		lengths[i] = r.Height()
+	}
+	vs.syncFixed(t, height, lengths)
+}
+
+func (vs *vsplit) ValidDims(t *tree, w, h, minw, minh, maxw, maxh int) bool {
+	_, lf := vs.validDimsReason(t, w, h, minw, minh, maxw, maxh)
+	return lf == nil
+}
+
+func (vs *vsplit) validDimsReason(t *tree,
+	w, h, minw, minh, maxw, maxh int) (bool, *leaf) {
+
+	_, hs, ok := vs.spans(t, h, false)
+	for i, child := range vs.children {
+		small, lf := child.validDimsReason(t, w, hs[i], minw, minh, maxw, maxh)
+		if lf != nil {
+			return small, lf
 		}
 	}
-	return true
+	if !ok {
+		return true, firstLeaf(vs)
+	}
+	return false, nil
+}
+
+// MinSize for a vsplit is the largest of its children's minimum widths and
+// the sum of its children's minimum heights (plus the gaps between them).
+func (vs *vsplit) MinSize(t *tree) (width, height int) {
+	for i, child := range vs.children {
+		w, h := child.MinSize(t)
+		if i > 0 {
+			height += t.gap()
+		}
+		width = misc.Max(width, w)
+		height += misc.Max(h, t.px(child.FixedSize()))
+	}
+	return
 }
 
-func (lf *leaf) MoveResize(x, y, width, height int) {
+// MoveResize gives the client of lf the given geometry. If the client
+// requires an aspect ratio or has a maximum size, it is given the largest
+// geometry that satisfies them instead, centered within the given one (see
+// fit). The geometry is that of the client's frame, which is made a tiling
+// frame first with FrameTile and fits the client window in what its
+// decorations leave (see Client.FrameInsets). Nothing is sent to the client
+// if the last placement already gave it that geometry, unless the tree is
+// placed with placeForce.
+func (lf *leaf) MoveResize(t *tree, x, y, width, height int) {
+	geom := lf.fit(xrect.New(x, y, width, height))
+	t.drawn[lf.client] = geom
+	if t.dryRun || sameRect(t.lastDrawn[lf.client], geom) {
+		// The client is already there (or is only being previewed), so
+		// don't bother the X server.
+		return
+	}
 	lf.client.FrameTile()
-	lf.client.MoveResize(x, y, width, height)
+	lf.client.MoveResize(geom.X(), geom.Y(), geom.Width(), geom.Height())
+}
+
+// fit returns the geometry that the client of lf is given in the cell geom.
+// This is the cell itself unless the client requires an aspect ratio or the
+// cell is larger than the client's maximum size. Otherwise, the client gets
+// the largest geometry within the cell that satisfies both, centered in the
+// cell, which leaves some padding around it. Both only apply to the client
+// window, so the frame around it is left out of them.
+func (lf *leaf) fit(geom xrect.Rect) xrect.Rect {
+	fw, fh := lf.frameSize()
+	w, h := geom.Width()-fw, geom.Height()-fh
+	maxw, maxh := lf.client.MaxSize()
+	if maxw > 0 {
+		w = misc.Min(w, maxw)
+	}
+	if maxh > 0 {
+		h = misc.Min(h, maxh)
+	}
+	if num, den, ok := lf.client.AspectRatio(); ok {
+		w, h = aspectFit(w, h, num, den)
+	}
+	w, h = w+fw, h+fh
+	if w == geom.Width() && h == geom.Height() {
+		return geom
+	}
+	return xrect.New(geom.X()+(geom.Width()-w)/2,
+		geom.Y()+(geom.Height()-h)/2, w, h)
+}
+
+// aspectFit returns the largest width and height that fit in w by h and have
+// the ratio num:den.
+func aspectFit(w, h, num, den int) (int, int) {
+	if num <= 0 || den <= 0 {
+		return w, h
+	}
+	if w*den > h*num {
+		return h * num / den, h
+	}
+	return w, w * den / num
+}
+
+func (lf *leaf) String() string {
+	if lf.client == nil {
+		return fmt.Sprintf("leaf with no client [%f]", lf.prop)
+	}
+	return fmt.Sprintf("leaf with client '%s' (0x%x) [%f]",
+		lf.client, lf.client.Id(), lf.prop)
 }
 
 func (lf *leaf) Proportion() proportion {
@@ -353,20 +4289,133 @@ func (lf *leaf) Proportion() proportion {
 
 func (lf *leaf) SetProportion(p proportion) {
 	lf.prop = p
+	markDirty(lf)
+}
+
+func (lf *leaf) FixedSize() int {
+	return lf.fixedPx
+}
+
+func (lf *leaf) SetFixedSize(px int) {
+	lf.fixedPx = px
+}
+
+func (lf *leaf) Label() string {
+	return lf.label
+}
+
+// SetLabel names the leaf, so that it can be found with findLeafByLabel. An
+// empty label removes the name.
+func (lf *leaf) SetLabel(label string) {
+	lf.label = label
+}
+
+func (lf *leaf) Sticky() bool {
+	return lf.sticky
+}
+
+// SetSticky pins the proportion of the leaf: when a sibling is added to or
+// removed from its split, or the split is balanced, only the other children
+// share the difference. Unlike a fixed size, the leaf still grows and shrinks
+// with its split when the tree is resized.
+func (lf *leaf) SetSticky(on bool) {
+	lf.sticky = on
+}
+
+// isSticky returns true if n is a sticky leaf.
+func isSticky(n node) bool {
+	lf, ok := n.(*leaf)
+	return ok && lf.sticky
 }
 
 func (lf *leaf) Parent() node {
 	return lf.parent
 }
 
+func (lf *leaf) activeClient() (Client, bool) {
+	return lf.client, true
+}
+
 func (lf *leaf) SetParent(n node) {
-	lf.parent = n.(splitter)
+	lf.parent, _ = n.(splitter)
+}
+
+func (lf *leaf) ValidDims(t *tree, w, h, minw, minh, maxw, maxh int) bool {
+	_, bad := lf.validDimsReason(t, w, h, minw, minh, maxw, maxh)
+	return bad == nil
+}
+
+// validDimsReason returns lf itself if the given dimensions are not valid,
+// along with whether they are too small (as opposed to too large). A cell
+// larger than the client's own maximum size is fine, since fit pads the
+// client instead of stretching it; only maxw and maxh are enforced. A cell
+// that leaves no room for the client window inside of its frame is too
+// small.
+func (lf *leaf) validDimsReason(t *tree,
+	w, h, minw, minh, maxw, maxh int) (bool, *leaf) {
+
+	if num, den, ok := lf.client.AspectRatio(); ok {
+		// Only the part of the cell with the right ratio is used, so that's
+		// what has to be large enough. It can never be too large.
+		fw, fh := lf.frameSize()
+		cminw, cminh := lf.minContentSize(t)
+		cminw, cminh = misc.Max(cminw, minw-fw), misc.Max(cminh, minh-fh)
+		aw, ah := aspectFit(w-fw, h-fh, num, den)
+		if aw < cminw || ah < cminh {
+			return true, lf
+		}
+	}
+	cminw, cminh := lf.MinSize(t)
+	minw, minh = misc.Max(minw, cminw), misc.Max(minh, cminh)
+	switch {
+	case w < minw || h < minh:
+		return true, lf
+	case w > maxw || h > maxh:
+		return false, lf
+	}
+	return false, nil
+}
+
+// MinSize for a leaf is its client's minimum size plus its frame, but never
+// less than the tree's minimum leaf size. If the client requires an aspect
+// ratio, either dimension is grown as needed for the part of the cell with
+// that ratio to still be large enough (see validDimsReason).
+func (lf *leaf) MinSize(t *tree) (width, height int) {
+	width, height = lf.minContentSize(t)
+	if num, den, ok := lf.client.AspectRatio(); ok && num > 0 && den > 0 {
+		width = misc.Max(width, (height*num+den-1)/den)
+		height = misc.Max(height, (width*den+num-1)/num)
+	}
+	fw, fh := lf.frameSize()
+	return width + fw, height + fh
+}
+
+// minContentSize returns the smallest size of the client window of lf,
+// inside of its frame. This is the client's minimum size, or whatever makes
+// the whole cell as large as the tree's minimum leaf size. With a frame,
+// at least one pixel is always left for the client window.
+func (lf *leaf) minContentSize(t *tree) (width, height int) {
+	fw, fh := lf.frameSize()
+	width, height = lf.client.MinSize()
+	width = misc.Max(width, t.minLeaf()-fw)
+	height = misc.Max(height, t.minLeaf()-fh)
+	if fw > 0 || fh > 0 {
+		width, height = misc.Max(width, 1), misc.Max(height, 1)
+	}
+	return width, height
 }
 
-func (lf *leaf) ValidDims(w, h, minw, minh, maxw, maxh int) bool {
-	return w >= minw && h >= minh && w <= maxw && h <= maxh
+// frameSize returns the width and height that the frame of lf's client adds
+// to the client window (see Client.FrameInsets).
+func (lf *leaf) frameSize() (width, height int) {
+	top, right, bottom, left := lf.client.FrameInsets()
+	return left + right, top + bottom
 }
 
 func (lf *leaf) VisitLeafNodes(f func(visit *leaf) bool) bool {
 	return f(lf)
 }
+
+func (lf *leaf) VisitLeafNodesReverse(f func(visit *leaf) bool) bool {
+	return f(lf)
+}
@@ -0,0 +1,1781 @@
+package layout
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/xgbutil/xrect"
+)
+
+// checkValid fails the test if validate finds anything wrong with tr.
+func checkValid(t *testing.T, tr *tree) {
+	t.Helper()
+	for _, err := range tr.validate() {
+		t.Error(err)
+	}
+	if t.Failed() {
+		t.Fatal(tr.dump())
+	}
+}
+
+// checkProps fails the test unless the leaves have the given proportions.
+func checkProps(t *testing.T, tr *tree, leaves []*leaf, want []proportion) {
+	t.Helper()
+	for i, lf := range leaves {
+		if !lf.Proportion().Equal(want[i]) {
+			t.Fatalf("'%s' has the proportion %f instead of %f.\n%s",
+				lf.client, lf.Proportion(), want[i], tr.dump())
+		}
+	}
+}
+
+// hsplitOf returns a tree whose root is an hsplit with a leaf for each of
+// props, with those proportions.
+func hsplitOf(props ...proportion) (*tree, []*leaf) {
+	tr := newTree()
+	root := newHSplit(nil)
+	root.SetProportion(fullPortion)
+	tr.setChild(root)
+	leaves := make([]*leaf, len(props))
+	for i := range props {
+		leaves[i] = newLeaf(nil, newFake(i+1))
+		root.AddNode(leaves[i], true)
+	}
+	for i, p := range props {
+		leaves[i].SetProportion(p)
+	}
+	return tr, leaves
+}
+
+// rowOf returns a tree whose root is an hsplit with an equal leaf for each of
+// cs, in order.
+func rowOf(cs ...*fakeClient) *tree {
+	tr, _ := hsplitOf()
+	for _, c := range cs {
+		tr.addNode(tr.child.(splitter), newLeaf(nil, c), true)
+	}
+	return tr
+}
+
+func TestRemoveEven(t *testing.T) {
+	tr, ls := hsplitOf(0.2, 0.3, 0.1, 0.4)
+	if err := tr.removeNode(ls[2]); err != nil {
+		t.Fatal(err)
+	}
+	checkValid(t, tr)
+	checkProps(t, tr, []*leaf{ls[0], ls[1], ls[3]},
+		[]proportion{0.2 / 0.9, 0.3 / 0.9, 0.4 / 0.9})
+}
+
+func TestRemoveToNeighbor(t *testing.T) {
+	tr, ls := hsplitOf(0.2, 0.3, 0.1, 0.4)
+	tr.SetRemovalPolicy(RemoveToNeighbor)
+	if err := tr.removeNode(ls[2]); err != nil {
+		t.Fatal(err)
+	}
+	checkValid(t, tr)
+	checkProps(t, tr, []*leaf{ls[0], ls[1], ls[3]},
+		[]proportion{0.2, 0.4, 0.4})
+
+	// The first child has no sibling before it.
+	if err := tr.removeNode(ls[0]); err != nil {
+		t.Fatal(err)
+	}
+	checkValid(t, tr)
+	checkProps(t, tr, []*leaf{ls[1], ls[3]}, []proportion{0.6, 0.4})
+}
+
+func TestRemoveToNeighborSticky(t *testing.T) {
+	tr, ls := hsplitOf(0.2, 0.3, 0.1, 0.4)
+	tr.SetRemovalPolicy(RemoveToNeighbor)
+	ls[1].SetSticky(true)
+	if err := tr.removeNode(ls[2]); err != nil {
+		t.Fatal(err)
+	}
+	checkValid(t, tr)
+	checkProps(t, tr, []*leaf{ls[0], ls[1], ls[3]},
+		[]proportion{0.2, 0.3, 0.5})
+}
+
+func TestRemoveToLargest(t *testing.T) {
+	tr, ls := hsplitOf(0.2, 0.3, 0.1, 0.4)
+	tr.SetRemovalPolicy(RemoveToLargest)
+	if err := tr.removeNode(ls[1]); err != nil {
+		t.Fatal(err)
+	}
+	checkValid(t, tr)
+	checkProps(t, tr, []*leaf{ls[0], ls[2], ls[3]},
+		[]proportion{0.2, 0.1, 0.7})
+
+	// Siblings with a fixed size are passed over.
+	ls[3].SetFixedSize(100)
+	if err := tr.removeNode(ls[2]); err != nil {
+		t.Fatal(err)
+	}
+	checkValid(t, tr)
+	checkProps(t, tr, []*leaf{ls[0], ls[3]}, []proportion{0.3, 0.7})
+}
+
+func TestRemovalPolicyCloned(t *testing.T) {
+	tr, _ := hsplitOf(0.5, 0.5)
+	tr.SetRemovalPolicy(RemoveToLargest)
+	if got := tr.clone().removalPolicy; got != RemoveToLargest {
+		t.Fatalf("The clone has the removal policy %d.", got)
+	}
+}
+
+// autoTree returns a tree with cs added to it by addAuto.
+func autoTree(t *testing.T, cs []*fakeClient) *tree {
+	t.Helper()
+	tr := newTree()
+	for _, c := range cs {
+		if err := tr.addAuto(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return tr
+}
+
+func TestRemoveCollapse(t *testing.T) {
+	// Every split is nested in the last tile of the one before it, so that
+	// the tree is a chain of six levels.
+	cs := newFakes(6)
+	tr := rowOf(cs[0], cs[1])
+	dirs := []direction{dirDown, dirRight}
+	for i := 2; i < len(cs); i++ {
+		if err := tr.splitLeaf(cs[i-1], dirs[i%2], cs[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := tr.depth(); d != len(cs)-1 {
+		t.Fatalf("The tree is %d levels deep.\n%s", d, tr.dump())
+	}
+
+	// Removing the first client collapses the split that it leaves behind
+	// with a single child, taking away a level each time.
+	for i, c := range cs[:len(cs)-1] {
+		if err := tr.removeClient(c); err != nil {
+			t.Fatal(err)
+		}
+		checkValid(t, tr)
+		if d := tr.depth(); d != len(cs)-2-i {
+			t.Fatalf("The tree is %d levels deep after removing '%s'.\n%s",
+				d, c, tr.dump())
+		}
+	}
+	lf, ok := tr.child.(*leaf)
+	if !ok || lf.client != cs[len(cs)-1] || lf.Parent() != nil ||
+		!lf.Proportion().Equal(fullPortion) {
+
+		t.Fatalf("The last client wasn't promoted to the root.\n%s",
+			tr.dump())
+	}
+}
+
+func TestRemoveTwice(t *testing.T) {
+	tr, ls := hsplitOf(0.2, 0.3, 0.5)
+	c := ls[1].client
+	if err := tr.removeClient(c); err != nil {
+		t.Fatal(err)
+	}
+	undos := len(tr.undoStack)
+
+	// A client that is destroyed twice is only reported, and the rest of
+	// the tree is left as the first removal made it.
+	err := tr.removeClient(c)
+	if err == nil || !strings.Contains(err.Error(), c.String()) {
+		t.Fatalf("Removing '%s' again returned %v.", c, err)
+	}
+	if err := tr.removeNode(ls[1]); err == nil {
+		t.Fatalf("Removing the leaf of '%s' again didn't fail.", c)
+	}
+	checkValid(t, tr)
+	checkProps(t, tr, []*leaf{ls[0], ls[2]}, []proportion{0.2 / 0.7, 0.5 / 0.7})
+	if len(tr.undoStack) != undos {
+		t.Fatalf("The failed removals left something to undo.")
+	}
+}
+
+func TestPlaceOutcomes(t *testing.T) {
+	c := newFake(1)
+	base := xrect.New(0, 0, 100, 100)
+	tests := []struct {
+		name  string
+		build func() *tree
+		base  xrect.Rect
+		want  placement
+	}{
+		{"no geometry", func() *tree { return rowOf(c) }, nil, placeNoGeom},
+		{"empty", newTree, base, placeEmpty},
+		{"ok", func() *tree { return rowOf(c) }, base, placeOK},
+		{"below minimum", func() *tree {
+			c.minw = 200
+			return rowOf(c)
+		}, base, placeTooSmall},
+		{"outer gap", func() *tree {
+			tr := rowOf(c)
+			tr.SetGaps(0, 60)
+			return tr
+		}, base, placeTooSmall},
+		// A client is kept to its maximum size inside of its tile, so it
+		// can't make the tree too large.
+		{"above maximum", func() *tree {
+			c.maxw = 50
+			return rowOf(c)
+		}, base, placeOK},
+	}
+	for _, test := range tests {
+		*c = fakeClient{id: c.id}
+		tr := test.build()
+		if got := tr.place(test.base); got != test.want {
+			t.Errorf("%s: Placing the tree returned '%s' instead of '%s'.",
+				test.name, got, test.want)
+		}
+	}
+	if got := c.geomString(); got != "25,0 50x100" {
+		t.Fatalf("'%s' is at %s instead of in the middle of its tile.",
+			c, got)
+	}
+}
+
+func TestPlaceRedundant(t *testing.T) {
+	cs := newFakes(5)
+	tr := autoTree(t, cs)
+	base := xrect.New(0, 0, 1200, 900)
+	if got := tr.place(base); got != placeOK {
+		t.Fatalf("The tree was not placed: %s.", got)
+	}
+	moves(cs)
+
+	if got := tr.place(base); got != placeOK {
+		t.Fatalf("The tree was not placed: %s.", got)
+	}
+	if got := moves(cs); got != 0 {
+		t.Fatalf("Placing the tree again made %d moves.", got)
+	}
+	for _, c := range cs {
+		if !sameRect(tr.drawn[c], c.Geom()) {
+			t.Fatalf("'%s' is at %s, but was drawn elsewhere.", c,
+				c.geomString())
+		}
+	}
+
+	tr.placeForce(base)
+	if got := moves(cs); got != len(cs) {
+		t.Fatalf("placeForce made %d moves instead of %d.", got, len(cs))
+	}
+	tr.SetGaps(4, 0)
+	tr.place(base)
+	if got := moves(cs); got != len(cs) {
+		t.Fatalf("Changing the gaps made %d moves instead of %d.", got,
+			len(cs))
+	}
+}
+
+func TestMoveClientAcross(t *testing.T) {
+	// An hsplit of m and a vsplit of a and b.
+	m, a, b := newFake(1), newFake(2), newFake(3)
+	tr := newMasterStack(m, []Client{a, b})
+	base := xrect.New(0, 0, 300, 100)
+	tr.place(base)
+
+	// Moving a left takes it out of the vsplit, right beside it in the
+	// hsplit, and the vsplit is left with just b.
+	if !tr.moveClient(a, dirLeft) {
+		t.Fatalf("'%s' was not moved.\n%s", a, tr.dump())
+	}
+	checkValid(t, tr)
+	if got := a.geomString(); got != "100,0 100x100" {
+		t.Fatalf("'%s' is at %s.\n%s", a, got, tr.dump())
+	}
+	if got := b.geomString(); got != "200,0 100x100" {
+		t.Fatalf("'%s' is at %s.\n%s", b, got, tr.dump())
+	}
+
+	// Moving a down wraps the root in a new vsplit.
+	if !tr.moveClient(a, dirDown) {
+		t.Fatalf("'%s' was not moved.\n%s", a, tr.dump())
+	}
+	checkValid(t, tr)
+	if _, ok := tr.child.(*vsplit); !ok || tr.findLeaf(a).Parent() != tr.child {
+		t.Fatalf("'%s' is not in a new root.\n%s", a, tr.dump())
+	}
+	if got := a.geomString(); got != "0,50 300x50" {
+		t.Fatalf("'%s' is at %s.\n%s", a, got, tr.dump())
+	}
+	if tr.moveClient(a, dirDown) {
+		t.Fatalf("'%s' was moved past the edge.\n%s", a, tr.dump())
+	}
+}
+
+func TestMoveClientMaxChildren(t *testing.T) {
+	// An hsplit of c1, a vsplit of c2 and c3, and c4.
+	cs := newFakes(4)
+	tr, ls := hsplitOf(0.25, 0.5, 0.25)
+	root := tr.child.(*hsplit)
+	v := newVSplit(root)
+	v.AddNode(newLeaf(v, cs[1]), true)
+	v.AddNode(newLeaf(v, cs[2]), true)
+	v.SetProportion(ls[1].Proportion())
+	root.children[1] = v
+	ls[0].client, ls[2].client = cs[0], cs[3]
+	tr.SetMaxChildren(3)
+	checkValid(t, tr)
+
+	// The root is full, so c2 is nested with c4, which it moves next to.
+	if !tr.moveClient(cs[1], dirRight) {
+		t.Fatalf("'%s' was not moved.\n%s", cs[1], tr.dump())
+	}
+	checkValid(t, tr)
+	if root.Size() != 3 {
+		t.Fatalf("The root has %d children.\n%s", root.Size(), tr.dump())
+	}
+	nested := tr.findLeaf(cs[1]).Parent()
+	if _, ok := nested.(*hsplit); !ok || nested.Parent() != root ||
+		tr.findLeaf(cs[3]).Parent() != nested {
+
+		t.Fatalf("'%s' was not nested with '%s'.\n%s",
+			cs[1], cs[3], tr.dump())
+	}
+	tr.place(xrect.New(0, 0, 400, 100))
+	prev := -1
+	for _, c := range []*fakeClient{cs[0], cs[2], cs[1], cs[3]} {
+		if c.x <= prev || c.h != 100 {
+			t.Fatalf("'%s' is at %s.\n%s", c, c.geomString(), tr.dump())
+		}
+		prev = c.x
+	}
+	if cs[1].x+cs[1].w != cs[3].x || cs[3].x+cs[3].w != 400 {
+		t.Fatalf("'%s' and '%s' are not side by side at the end.\n%s",
+			cs[1], cs[3], tr.dump())
+	}
+}
+
+func TestPlaceThirds(t *testing.T) {
+	third := fullPortion / 3
+	tr, ls := hsplitOf(third, third, third)
+	tr.place(xrect.New(0, 0, 100, 100))
+
+	// The pixel that rounding leaves over goes to the last child, so that
+	// the children cover the split exactly.
+	for i, want := range []string{
+		"0,0 33x100", "33,0 33x100", "66,0 34x100",
+	} {
+		c := ls[i].client.(*fakeClient)
+		if got := c.geomString(); got != want {
+			t.Fatalf("'%s' is at %s instead of %s.", c, got, want)
+		}
+	}
+}
+
+func TestEachLeafGeom(t *testing.T) {
+	cs := newFakes(4)
+	cs[3].anum, cs[3].aden = 1, 1
+	tr := newMasterStack(cs[0], []Client{cs[1], cs[2], cs[3]})
+	tr.SetGaps(2, 3)
+	base := xrect.New(0, 0, 301, 203)
+	tr.place(base)
+
+	// The geometries are the ones that place gave the clients, size hints
+	// included, and the walk stops when f returns false.
+	n := 0
+	tr.eachLeafGeom(base, func(c Client, r xrect.Rect) bool {
+		if c != cs[n] {
+			t.Fatalf("Got '%s' instead of '%s'.", c, cs[n])
+		}
+		got := newFake(0)
+		got.MoveResize(r.Pieces())
+		if got.geomString() != cs[n].geomString() {
+			t.Fatalf("'%s' is at %s instead of %s.",
+				c, got.geomString(), cs[n].geomString())
+		}
+		n++
+		return n < 3
+	})
+	if n != 3 {
+		t.Fatalf("The walk stopped after %d clients instead of 3.", n)
+	}
+}
+
+func BenchmarkEachLeafGeom(b *testing.B) {
+	tr, _ := masterStackOf(50)
+	base := xrect.New(0, 0, 5000, 5000)
+	for i := 0; i < b.N; i++ {
+		tr.eachLeafGeom(base, func(c Client, r xrect.Rect) bool {
+			return true
+		})
+	}
+}
+
+// BenchmarkGeomOf finds the geometries that BenchmarkEachLeafGeom does, one
+// client at a time.
+func BenchmarkGeomOf(b *testing.B) {
+	tr, cs := masterStackOf(50)
+	base := xrect.New(0, 0, 5000, 5000)
+	for i := 0; i < b.N; i++ {
+		for _, c := range cs {
+			tr.geomOf(c, base)
+		}
+	}
+}
+
+func TestAddNodes(t *testing.T) {
+	tr, ls := hsplitOf(0.5, 0.5)
+	root := tr.child.(splitter)
+	more := []*leaf{newLeaf(nil, newFake(3)), newLeaf(nil, newFake(4))}
+	tr.addNodes(root, []node{more[0], more[1]}, true)
+	checkValid(t, tr)
+	checkProps(t, tr, append(ls, more...), []proportion{0.25, 0.25, 0.25, 0.25})
+
+	// Without even, the proportions that the nodes came with are scaled to
+	// fill the split.
+	tr, _ = hsplitOf()
+	a, b := newLeaf(nil, newFake(1)), newLeaf(nil, newFake(2))
+	a.SetProportion(0.3)
+	b.SetProportion(0.1)
+	tr.addNodes(tr.child.(splitter), []node{a, b}, false)
+	checkValid(t, tr)
+	checkProps(t, tr, []*leaf{a, b}, []proportion{0.75, 0.25})
+	if !tr.undo() || tr.leafCount() != 0 {
+		t.Fatalf("Undo didn't take back both nodes at once.\n%s", tr.dump())
+	}
+
+	// Nodes that would put the split over maxChildren are added one at a
+	// time, which nests them.
+	tr, _ = hsplitOf(0.25, 0.25, 0.25, 0.25)
+	root = tr.child.(splitter)
+	tr.SetMaxChildren(5)
+	tr.addNodes(root, []node{newLeaf(nil, newFake(5)),
+		newLeaf(nil, newFake(6))}, true)
+	checkValid(t, tr)
+	if tr.leafCount() != 6 || root.Size() > 5 {
+		t.Fatalf("The split has %d children with %d leaves in the tree.\n%s",
+			root.Size(), tr.leafCount(), tr.dump())
+	}
+}
+
+// leavesOf returns n leaves that hold new fake clients.
+func leavesOf(n int) []node {
+	nodes := make([]node, n)
+	for i := range nodes {
+		nodes[i] = newLeaf(nil, newFake(i+1))
+	}
+	return nodes
+}
+
+func BenchmarkAddNode(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		tr, _ := hsplitOf()
+		for _, n := range leavesOf(200) {
+			tr.addNode(tr.child.(splitter), n, true)
+		}
+	}
+}
+
+// BenchmarkAddNodes adds the leaves that BenchmarkAddNode does, all at once.
+func BenchmarkAddNodes(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		tr, _ := hsplitOf()
+		tr.addNodes(tr.child.(splitter), leavesOf(200), true)
+	}
+}
+
+func TestPlaceMinimalMove(t *testing.T) {
+	base := xrect.New(0, 0, 900, 300)
+	cs := newFakes(4)
+	a, b, c, d := cs[0], cs[1], cs[2], cs[3]
+	old := rowOf(a, b, c)
+	old.place(base)
+	prev := make(map[Client]xrect.Rect)
+	for k, v := range old.drawn {
+		prev[k] = v
+	}
+
+	// Placing the same clients in another order moves all of them, unless
+	// they're shuffled back into the tiles that they're already in.
+	moves(cs)
+	rowOf(c, a, b).place(base)
+	if n := moves(cs); n != 3 {
+		t.Fatalf("Placing the tree naively moved %d clients instead of 3.", n)
+	}
+	old.placeForce(base)
+	moves(cs)
+	tr := rowOf(c, a, b)
+	if r := tr.placeMinimalMove(base, prev); r != placeOK {
+		t.Fatalf("Placing the tree returned %v.", r)
+	}
+	if n := moves(cs); n != 0 {
+		t.Fatalf("placeMinimalMove moved %d clients instead of none.\n%s",
+			n, tr.dump())
+	}
+	checkValid(t, tr)
+	if got := tr.clients(); got[0] != a || got[1] != b || got[2] != c {
+		t.Fatalf("The clients weren't shuffled back in order.\n%s",
+			tr.dump())
+	}
+	if !tr.undo() || tr.clients()[0] != c {
+		t.Fatalf("Undo didn't bring back the order before the shuffle.\n%s",
+			tr.dump())
+	}
+
+	// A client that wasn't placed before takes the tile that is left over.
+	old.placeForce(base)
+	tr = rowOf(d, c, b, a)
+	if r := tr.placeMinimalMove(base, prev); r != placeOK {
+		t.Fatalf("Placing the tree returned %v.", r)
+	}
+	if got := tr.clients(); got[2] != d || got[3] != c ||
+		a.x != 0 || b.x != 225 {
+
+		t.Fatalf("'%s' didn't get the tile nobody else was near.\n%s",
+			d, tr.dump())
+	}
+}
+
+func TestStackFallback(t *testing.T) {
+	cs := newFakes(4)
+	for _, c := range cs {
+		c.minw, c.minh = 80, 80
+	}
+	cs[2].active = true
+	quad := func() *tree {
+		tr := rowOf(cs[0], cs[2])
+		if err := tr.splitLeaf(cs[0], dirDown, cs[1]); err != nil {
+			t.Fatal(err)
+		}
+		if err := tr.splitLeaf(cs[2], dirDown, cs[3]); err != nil {
+			t.Fatal(err)
+		}
+		return tr
+	}
+	base := xrect.New(0, 0, 100, 100)
+
+	strict := quad()
+	strict.SetStackFallback(false)
+	if r := strict.place(base); r != placeTooSmall {
+		t.Fatalf("Placing the tree without the fallback returned %v.", r)
+	}
+
+	// Every split is too small for two clients, so they all end up in one
+	// stack that shows the active client over the whole screen.
+	tr := quad()
+	if r := tr.place(base); r != placeOK {
+		t.Fatalf("Placing the tree returned %v.\n%s", r, tr.dump())
+	}
+	checkValid(t, tr)
+	st, ok := tr.child.(*stack)
+	if !ok || st.Size() != len(cs) || st.activeLeaf().client != cs[2] {
+		t.Fatalf("The clients weren't stacked with '%s' showing.\n%s",
+			cs[2], tr.dump())
+	}
+	if got := cs[2].geomString(); got != "0,0 100x100" || cs[2].unmapped {
+		t.Fatalf("'%s' is at %s instead of filling the screen.",
+			cs[2], got)
+	}
+	if !cs[0].unmapped {
+		t.Fatalf("'%s' wasn't hidden behind '%s'.", cs[0], cs[2])
+	}
+}
+
+func TestMaxChildren(t *testing.T) {
+	cs := newFakes(5)
+	tr := rowOf(cs[:3]...)
+	root := tr.child.(splitter)
+	tr.SetMaxChildren(3)
+	base := xrect.New(0, 0, 400, 100)
+	tr.place(base)
+
+	// The fourth child is nested with the last one, which keeps its place.
+	tr.addNode(root, newLeaf(nil, cs[3]), true)
+	checkValid(t, tr)
+	if root.Size() != 3 || tr.depth() != 2 {
+		t.Fatalf("Adding a fourth child didn't nest one level.\n%s",
+			tr.dump())
+	}
+	tr.place(base)
+	for i, want := range []string{"0,0 100x100", "100,0 100x100",
+		"200,0 100x100", "300,0 100x100"} {
+
+		if got := cs[i].geomString(); got != want {
+			t.Fatalf("'%s' is at %s instead of %s.\n%s",
+				cs[i], got, want, tr.dump())
+		}
+	}
+
+	// The nested split has room, so the fifth child doesn't nest again.
+	tr.addNode(root, newLeaf(nil, cs[4]), true)
+	checkValid(t, tr)
+	if root.Size() != 3 || tr.depth() != 2 {
+		t.Fatalf("Adding a fifth child nested another level.\n%s",
+			tr.dump())
+	}
+}
+
+func TestResizeChildThreshold(t *testing.T) {
+	tr, ls := hsplitOf(0.5, 0.5)
+	root := tr.child.(*hsplit)
+	base := xrect.New(0, 0, 1000, 100)
+	tr.place(base)
+
+	// Each drag is half of the threshold, so every other one resizes by
+	// both of them.
+	px := proportion(0.001)
+	moved := proportion(0)
+	for i := 0; i < 10; i++ {
+		got := root.resizeChild(ls[0], px)
+		if i%2 == 0 && got != 0 {
+			t.Fatalf("Drag %d resized by %f below the threshold.", i, got)
+		}
+		moved += got
+		tr.place(base)
+	}
+	c := ls[0].client.(*fakeClient)
+	if !moved.Equal(10*px) || c.w != 510 {
+		t.Fatalf("Ten 1px drags moved %f and left '%s' at %s.\n%s",
+			moved, c, c.geomString(), tr.dump())
+	}
+
+	root.setResizeThreshold(0)
+	if got := root.resizeChild(ls[0], px); !got.Equal(px) {
+		t.Fatalf("A 1px drag resized by %f without a threshold.", got)
+	}
+}
+
+func TestGrowSaturates(t *testing.T) {
+	tr, ls := hsplitOf(0.3, 0.4, 0.3)
+	a := ls[0].client
+
+	// Growing c1 takes from c2 until it is down to the default minimum of
+	// 0.1, and then stops, however many times it is asked.
+	for i := 0; i < 50; i++ {
+		tr.grow(a, dirRight, 0.05)
+	}
+	checkValid(t, tr)
+	checkProps(t, tr, ls, []proportion{0.6, 0.1, 0.3})
+	if tr.grow(a, dirRight, 0.05) {
+		t.Fatalf("'%s' grew past the minimum of its neighbor.\n%s",
+			a, tr.dump())
+	}
+
+	// With tighter bounds, c1 stops at the maximum instead, and shrinking
+	// it stops once c2 has grown to the maximum.
+	if err := tr.SetProportionBounds(ls[0], 0.15, 0.5); err != nil {
+		t.Fatal(err)
+	}
+	tr.balance()
+	for i := 0; i < 50; i++ {
+		tr.grow(a, dirRight, 0.05)
+	}
+	checkValid(t, tr)
+	checkProps(t, tr, ls[:2], []proportion{0.5, 1.0 / 6})
+	for i := 0; i < 50; i++ {
+		tr.grow(a, dirRight, -0.05)
+	}
+	checkValid(t, tr)
+	checkProps(t, tr, ls[:2], []proportion{1.0 / 6, 0.5})
+
+	if err := tr.SetProportionBounds(ls[0], 0.6, 0.5); err == nil {
+		t.Fatalf("A minimum above the maximum was accepted.")
+	}
+}
+
+func TestFixedSizeRebase(t *testing.T) {
+	tr, ls := hsplitOf(0.2, 0.4, 0.4)
+	tr.SetFixedSize(ls[0], 300)
+	widths := func() [3]int {
+		var ws [3]int
+		for i, lf := range ls {
+			ws[i] = lf.client.(*fakeClient).w
+		}
+		return ws
+	}
+
+	// The monitor shrinks, and the sidebar keeps its 300 pixels while the
+	// others share what is left. Its proportion follows.
+	for _, w := range []int{1920, 1600} {
+		tr.place(xrect.New(0, 0, w, 900))
+		checkValid(t, tr)
+		rest := (w - 300) / 2
+		if got := widths(); got != [3]int{300, rest, rest} {
+			t.Fatalf("The widths are %v in %d pixels.\n%s", got, w, tr.dump())
+		}
+		checkProps(t, tr, ls[:1], []proportion{300 / proportion(w)})
+	}
+
+	// Once it isn't fixed anymore, the sidebar keeps the proportion that it
+	// was last given.
+	tr.SetFixedSize(ls[0], 0)
+	tr.place(xrect.New(0, 0, 1600, 900))
+	if got := widths(); got[0] != 300 {
+		t.Fatalf("The sidebar is %d pixels wide after being cleared.", got[0])
+	}
+}
+
+// geomsOf returns the geometries that cs were last given.
+func geomsOf(cs []*fakeClient) []string {
+	geoms := make([]string, len(cs))
+	for i, c := range cs {
+		geoms[i] = c.geomString()
+	}
+	return geoms
+}
+
+func TestSplitLeaf(t *testing.T) {
+	cs := newFakes(4)
+	tr := rowOf(cs[0], cs[1])
+	root := tr.child.(splitter)
+	tr.place(xrect.New(0, 0, 120, 100))
+
+	// The root already is an hsplit, so c3 is added to it beside c2, and
+	// they share what c2 had.
+	if err := tr.splitLeaf(cs[1], dirRight, cs[2]); err != nil {
+		t.Fatal(err)
+	}
+	checkValid(t, tr)
+	if root.Size() != 3 || tr.findLeaf(cs[2]).Parent() != root {
+		t.Fatalf("'%s' wasn't added to the root.\n%s", cs[2], tr.dump())
+	}
+
+	// A vsplit takes the place and proportion of the leaf of c3.
+	if err := tr.splitLeaf(cs[2], dirUp, cs[3]); err != nil {
+		t.Fatal(err)
+	}
+	checkValid(t, tr)
+	v, ok := tr.findLeaf(cs[3]).Parent().(*vsplit)
+	if !ok || v.Parent() != root || root.Child(2) != v ||
+		!v.Proportion().Equal(0.25) {
+
+		t.Fatalf("'%s' wasn't nested with '%s'.\n%s", cs[3], cs[2], tr.dump())
+	}
+	want := []string{"0,0 60x100", "60,0 30x100", "90,50 30x50",
+		"90,0 30x50"}
+	if got := geomsOf(cs); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("The clients are at %v instead of %v.\n%s",
+			got, want, tr.dump())
+	}
+
+	// A leaf at the root is replaced by a split too.
+	tr = newTree()
+	tr.setChild(newLeaf(nil, cs[0]))
+	if err := tr.splitLeaf(cs[0], dirDown, cs[1]); err != nil {
+		t.Fatal(err)
+	}
+	checkValid(t, tr)
+	if _, ok := tr.child.(*vsplit); !ok || tr.leafCount() != 2 {
+		t.Fatalf("The root wasn't split.\n%s", tr.dump())
+	}
+}
+
+func TestFlatten(t *testing.T) {
+	// A vsplit of c1 and a vsplit of c2, c3 and c4.
+	cs := newFakes(4)
+	tr := newTree()
+	root := newVSplit(nil)
+	root.SetProportion(fullPortion)
+	tr.setChild(root)
+	root.AddNode(newLeaf(root, cs[0]), true)
+	inner := newVSplit(root)
+	root.AddNode(inner, true)
+	for _, c := range cs[1:] {
+		inner.AddNode(newLeaf(inner, c), true)
+	}
+	root.Child(0).SetProportion(0.4)
+	inner.SetProportion(0.6)
+	base := xrect.New(0, 0, 100, 200)
+	tr.place(base)
+	before := geomsOf(cs)
+
+	root.flatten(root, 3)
+	if root.Size() != 2 {
+		t.Fatalf("A split that would go over the maximum was flattened.\n%s",
+			tr.dump())
+	}
+	root.flatten(root, 0)
+	checkValid(t, tr)
+	if root.Size() != len(cs) {
+		t.Fatalf("The nested vsplit wasn't flattened.\n%s", tr.dump())
+	}
+	tr.placeForce(base)
+	if after := geomsOf(cs); fmt.Sprint(after) != fmt.Sprint(before) {
+		t.Fatalf("Flattening moved the clients from %v to %v.\n%s",
+			before, after, tr.dump())
+	}
+}
+
+func TestMirror(t *testing.T) {
+	tr, cs := masterStackOf(3)
+	tr.setMasterProportion(0.7)
+	base := xrect.New(0, 0, 100, 100)
+	tr.place(base)
+	before := geomsOf(cs)
+
+	tests := []struct {
+		horizontal bool
+		want       []string
+	}{
+		{true, []string{"30,0 70x100", "0,0 30x50", "0,50 30x50"}},
+		{false, []string{"30,0 70x100", "0,50 30x50", "0,0 30x50"}},
+		{false, []string{"30,0 70x100", "0,0 30x50", "0,50 30x50"}},
+		{true, before},
+	}
+	for i, test := range tests {
+		tr.mirror(test.horizontal)
+		checkValid(t, tr)
+		tr.place(base)
+		if got := geomsOf(cs); fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Fatalf("Mirror %d put the clients at %v instead of %v.\n%s",
+				i, got, test.want, tr.dump())
+		}
+	}
+}
+
+func TestCommonAncestor(t *testing.T) {
+	tr, cs := masterStackOf(3)
+	stack := tr.findLeaf(cs[1]).Parent()
+	if got := tr.commonAncestor(cs[1], cs[2]); got != stack {
+		t.Fatalf("The siblings '%s' and '%s' are under %v.", cs[1], cs[2], got)
+	}
+	if got := tr.commonAncestor(cs[0], cs[2]); got != tr.child {
+		t.Fatalf("'%s' and '%s' are under %v instead of the root.",
+			cs[0], cs[2], got)
+	}
+
+	// Once c2 is nested, it and its cousin c3 are still under the stack.
+	if err := tr.splitLeaf(cs[1], dirRight, newFake(4)); err != nil {
+		t.Fatal(err)
+	}
+	if got := tr.commonAncestor(cs[1], cs[2]); got != stack {
+		t.Fatalf("The cousins '%s' and '%s' are under %v.", cs[1], cs[2], got)
+	}
+	if got := tr.commonAncestor(cs[1], newFake(9)); got != nil {
+		t.Fatalf("A client that isn't tiled has the ancestor %v.", got)
+	}
+}
+
+func TestVisitLeafNodesReverse(t *testing.T) {
+	// c4 is a tab behind c3, so it comes right after it.
+	tr, cs := masterStackOf(3)
+	more := newFake(4)
+	if err := tr.stackWith(cs[2], more); err != nil {
+		t.Fatal(err)
+	}
+	cs = append(cs, more)
+
+	var forward, reverse []Client
+	tr.child.VisitLeafNodes(func(lf *leaf) bool {
+		forward = append(forward, lf.client)
+		return true
+	})
+	tr.child.VisitLeafNodesReverse(func(lf *leaf) bool {
+		reverse = append(reverse, lf.client)
+		return true
+	})
+	if len(forward) != len(cs) || len(reverse) != len(cs) {
+		t.Fatalf("Visited %v and then %v.\n%s", forward, reverse, tr.dump())
+	}
+	for i, c := range cs {
+		if forward[i] != c || reverse[len(cs)-1-i] != c {
+			t.Fatalf("Visited %v and then %v.\n%s",
+				forward, reverse, tr.dump())
+		}
+	}
+
+	n := 0
+	tr.child.VisitLeafNodesReverse(func(lf *leaf) bool {
+		n++
+		return n < 2
+	})
+	if n != 2 {
+		t.Fatalf("The reverse visit went on for %d leaves instead of 2.", n)
+	}
+}
+
+func TestCheckPortionsDrift(t *testing.T) {
+	tr, ls := hsplitOf(0.6, 0.6)
+	s := tr.child.(*hsplit)
+
+	// Drift beyond epsilon is scaled away instead of panicking.
+	s.checkPortions()
+	checkProps(t, tr, ls, []proportion{0.5, 0.5})
+	if sum := ls[0].Proportion() + ls[1].Proportion(); sum != fullPortion {
+		t.Fatalf("The proportions add up to %f.", sum)
+	}
+
+	// Drift within epsilon is fixed too, so that the sum is exact.
+	ls[0].SetProportion(0.5 + epsilon/2)
+	s.checkPortions()
+	if sum := ls[0].Proportion() + ls[1].Proportion(); sum != fullPortion {
+		t.Fatalf("The proportions add up to %f.", sum)
+	}
+}
+
+func TestEmptySplitProportions(t *testing.T) {
+	tr, ls := hsplitOf(1, 0)
+	s := tr.child.(*hsplit)
+
+	// The only child left takes everything, and then has no siblings to
+	// give any of it to.
+	if err := s.RemoveNode(ls[0]); err != nil {
+		t.Fatal(err)
+	}
+	s.SetChildProportion(ls[1], 0.5)
+	checkProps(t, tr, ls[1:], []proportion{fullPortion})
+
+	// An empty split has nothing to divide, and the first child added to it
+	// gets all of it.
+	if err := s.RemoveNode(ls[1]); err != nil {
+		t.Fatal(err)
+	}
+	s.checkPortions()
+	s.AddNode(ls[0], true)
+	checkProps(t, tr, ls[:1], []proportion{fullPortion})
+
+	// A proportion that isn't finite is replaced, or reported when
+	// strictPortions is set.
+	s.AddNode(ls[1], true)
+	ls[0].SetProportion(proportion(math.NaN()))
+	s.checkPortions()
+	checkProps(t, tr, ls, []proportion{0.5, 0.5})
+	for _, p := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		if proportion(p).valid() {
+			t.Fatalf("The proportion %f is valid.", p)
+		}
+	}
+
+	strictPortions = true
+	defer func() {
+		strictPortions = false
+		r := recover()
+		if msg, _ := r.(string); !strings.Contains(msg, "not finite") {
+			t.Fatalf("checkPortions panicked with %v.", r)
+		}
+	}()
+	ls[1].SetProportion(proportion(math.Inf(1)))
+	s.checkPortions()
+}
+
+func TestAspectRatio(t *testing.T) {
+	tests := []struct {
+		name   string
+		rotate bool
+		base   xrect.Rect
+		want   string
+		other  string
+
+		// minh is a minimum height that fits in the tile, but not once the
+		// width that it needs at 16:9 is taken into account.
+		minh int
+	}{
+		// The tile is 160x180, so the client is as wide as it and centered
+		// vertically.
+		{"hsplit", false, xrect.New(0, 0, 320, 180), "0,45 160x90",
+			"160,0 160x180", 180},
+		// The tile is 160x200, with the same result.
+		{"vsplit", true, xrect.New(0, 0, 160, 400), "0,55 160x90",
+			"0,200 160x200", 100},
+	}
+	for _, test := range tests {
+		cs := newFakes(2)
+		cs[0].anum, cs[0].aden = 16, 9
+		tr := rowOf(cs...)
+		if test.rotate && !tr.rotateSplit(tr.child) {
+			t.Fatalf("%s: The root wasn't rotated.", test.name)
+		}
+		if r := tr.place(test.base); r != placeOK {
+			t.Fatalf("%s: Placing the tree returned %v.", test.name, r)
+		}
+		if got := cs[0].geomString(); got != test.want {
+			t.Fatalf("%s: '%s' is at %s instead of %s.\n%s", test.name,
+				cs[0], got, test.want, tr.dump())
+		}
+		if got := cs[1].geomString(); got != test.other {
+			t.Fatalf("%s: '%s' is at %s instead of filling its tile at %s.",
+				test.name, cs[1], got, test.other)
+		}
+
+		cs[0].minh = test.minh
+		tr.SetStackFallback(false)
+		if r := tr.place(test.base); r == placeOK {
+			t.Fatalf("%s: A client too tall for its ratio was placed.",
+				test.name)
+		}
+	}
+}
+
+func TestAddNodeParent(t *testing.T) {
+	hs, vs := newHSplit(nil), newVSplit(nil)
+	lf := newLeaf(nil, newFake(1))
+	hs.AddNode(vs, true)
+	vs.AddNode(lf, false)
+	if vs.Parent() != hs || lf.Parent() != vs {
+		t.Fatalf("AddNode didn't set the parents.\n%s", hs)
+	}
+
+	tr := newTree()
+	hs.SetProportion(fullPortion)
+	tr.setChild(hs)
+	added := newLeaf(nil, newFake(2))
+	tr.addNode(hs, added, true)
+	beside := newFake(3)
+	err := tr.insertBeside(lf.client, newLeaf(nil, beside), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkValid(t, tr)
+	if added.Parent() != hs || tr.findLeaf(beside).Parent() != vs {
+		t.Fatalf("The new leaves have the wrong parents.\n%s", tr.dump())
+	}
+}
+
+func TestRotateClients(t *testing.T) {
+	tr, cs := masterStackOf(4)
+	base := xrect.New(0, 0, 100, 90)
+	tr.place(base)
+	before := geomsOf(cs)
+
+	// The stack holds c2, c3 and c4, from the top, and c4 comes around to
+	// the top. The master stays put.
+	if !tr.rotateClients(cs[1], true) {
+		t.Fatalf("The clients of the stack weren't rotated.")
+	}
+	checkValid(t, tr)
+	if cs[3].y != 0 || cs[1].y != 30 || cs[2].y != 60 ||
+		cs[0].geomString() != before[0] {
+
+		t.Fatalf("The clients are at %v.\n%s", geomsOf(cs), tr.dump())
+	}
+	for i := 1; i < len(cs)-1; i++ {
+		tr.rotateClients(cs[1], true)
+	}
+	if got := geomsOf(cs); fmt.Sprint(got) != fmt.Sprint(before) {
+		t.Fatalf("Three rotations left the clients at %v instead of %v.",
+			got, before)
+	}
+
+	if !tr.rotateClients(cs[1], false) || cs[1].y != 60 || cs[2].y != 0 {
+		t.Fatalf("Rotating back left the clients at %v.", geomsOf(cs))
+	}
+	if tr.rotateClients(cs[0], true) {
+		t.Fatalf("'%s' was rotated, though it is alone in its column.", cs[0])
+	}
+}
+
+func TestMaxSize(t *testing.T) {
+	cs := newFakes(2)
+	cs[0].maxw, cs[0].maxh = 400, 300
+	tr := rowOf(cs...)
+	tr.SetStackFallback(false)
+
+	// Each tile is 800x600, and c1 is centered in its tile at its maximum.
+	if r := tr.place(xrect.New(0, 0, 1600, 600)); r != placeOK {
+		t.Fatalf("Placing the tree returned %v.", r)
+	}
+	want := []string{"200,150 400x300", "800,0 800x600"}
+	if got := geomsOf(cs); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("The clients are at %v instead of %v.", got, want)
+	}
+}
+
+func TestGrowNested(t *testing.T) {
+	// An hsplit of a vsplit and c4, where the vsplit holds an hsplit of c1
+	// and c2 above c3.
+	cs := newFakes(4)
+	tr := rowOf(cs[0], cs[3])
+	if err := tr.splitLeaf(cs[0], dirDown, cs[2]); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.splitLeaf(cs[0], dirRight, cs[1]); err != nil {
+		t.Fatal(err)
+	}
+	leafOf := func(c *fakeClient) *leaf { return tr.findLeaf(c) }
+	asSplit(leafOf(cs[0]).Parent()).setMinProportion(0.1)
+	base := xrect.New(0, 0, 100, 100)
+	tr.place(base)
+
+	// c1 takes what it can from c2, and the other 20 pixels come from c4.
+	if !tr.grow(cs[0], dirRight, 0.8) {
+		t.Fatalf("'%s' didn't grow.\n%s", cs[0], tr.dump())
+	}
+	tr.place(base)
+	checkValid(t, tr)
+	checkProps(t, tr, []*leaf{leafOf(cs[0]), leafOf(cs[3])},
+		[]proportion{0.9, 0.3})
+	if cs[0].w != 63 || cs[3].w != 30 {
+		t.Fatalf("The clients are at %v.\n%s", geomsOf(cs), tr.dump())
+	}
+
+	// There is enough room in the split of c2, so nothing above changes.
+	if !tr.grow(cs[1], dirLeft, 0.2) {
+		t.Fatalf("'%s' didn't grow.\n%s", cs[1], tr.dump())
+	}
+	checkProps(t, tr, []*leaf{leafOf(cs[1]), leafOf(cs[3])},
+		[]proportion{0.3, 0.3})
+
+	if tr.grow(cs[3], dirRight, 0.1) {
+		t.Fatalf("'%s' grew past the edge of the screen.", cs[3])
+	}
+	tr.undo()
+	tr.undo()
+	checkProps(t, tr, []*leaf{leafOf(cs[0]), leafOf(cs[3])},
+		[]proportion{0.5, 0.5})
+}
+
+func TestSwapNodes(t *testing.T) {
+	// An hsplit of c1 and a vsplit, which holds c2 above an hsplit of c3
+	// and c4.
+	cs := newFakes(4)
+	tr := rowOf(cs[0], cs[1])
+	if err := tr.splitLeaf(cs[1], dirDown, cs[2]); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.splitLeaf(cs[2], dirRight, cs[3]); err != nil {
+		t.Fatal(err)
+	}
+	leafOf := func(c *fakeClient) *leaf { return tr.findLeaf(c) }
+	right, inner := leafOf(cs[1]).Parent(), leafOf(cs[2]).Parent()
+	leafOf(cs[0]).SetProportion(0.3)
+	right.SetProportion(0.7)
+	leafOf(cs[1]).SetProportion(0.4)
+	inner.SetProportion(0.6)
+	base := xrect.New(0, 0, 100, 100)
+	tr.place(base)
+
+	for _, pair := range [][2]node{{right, inner}, {inner, right},
+		{right, right}} {
+
+		if err := tr.swapNodes(pair[0], pair[1]); err == nil {
+			t.Fatalf("'%s' was swapped with '%s', which it contains or "+
+				"is.\n%s", pair[0], pair[1], tr.dump())
+		}
+	}
+	checkValid(t, tr)
+
+	// The hsplit of c3 and c4 takes the cell of c1, and the other way
+	// around.
+	if err := tr.swapNodes(leafOf(cs[0]), inner); err != nil {
+		t.Fatal(err)
+	}
+	tr.place(base)
+	checkValid(t, tr)
+	want := []string{"30,40 70x60", "30,0 70x40", "0,0 15x100",
+		"15,0 15x100"}
+	if got := geomsOf(cs); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("The clients are at %v instead of %v.\n%s",
+			got, want, tr.dump())
+	}
+
+	// The fixed size belongs to the cell, so it stays where it was.
+	tr.SetFixedSize(leafOf(cs[1]), 20)
+	if err := tr.swapNodes(leafOf(cs[1]), leafOf(cs[0])); err != nil {
+		t.Fatal(err)
+	}
+	if leafOf(cs[0]).FixedSize() != 20 || leafOf(cs[1]).FixedSize() != 0 {
+		t.Fatalf("The fixed size didn't stay with its cell.\n%s", tr.dump())
+	}
+	tr.undo()
+	if leafOf(cs[1]).FixedSize() != 20 {
+		t.Fatalf("Undo didn't give the fixed size back.\n%s", tr.dump())
+	}
+}
+
+func TestAddAuto(t *testing.T) {
+	// A tree that hasn't been placed yet goes by the proportions of its
+	// tiles instead, with the same result.
+	base := xrect.New(0, 0, 1600, 900)
+	for _, geom := range []xrect.Rect{nil, base} {
+		cs := newFakes(4)
+		tr := newTree()
+		if geom != nil {
+			tr.place(geom)
+		}
+		for _, c := range cs {
+			if err := tr.addAuto(c); err != nil {
+				t.Fatal(err)
+			}
+		}
+		checkValid(t, tr)
+		tr.place(base)
+		for _, c := range cs {
+			if c.w != 800 || c.h != 450 {
+				t.Fatalf("'%s' is at %s instead of in a quarter.\n%s",
+					c, c.geomString(), tr.dump())
+			}
+		}
+	}
+}
+
+func TestAnchorCenter(t *testing.T) {
+	tr, ls := hsplitOf(0.3, 0.4, 0.3)
+	s := asSplit(tr.child)
+	s.setAnchor(anchorCenter)
+	b := ls[1].client
+
+	// c2 grows and shrinks by the same amount on both sides.
+	if !tr.resizeLeaf(b, dirRight, 0.2) {
+		t.Fatalf("'%s' wasn't resized.", b)
+	}
+	checkProps(t, tr, ls, []proportion{0.2, 0.6, 0.2})
+	if !tr.resizeLeaf(b, dirLeft, -0.4) {
+		t.Fatalf("'%s' wasn't resized.", b)
+	}
+	checkProps(t, tr, ls, []proportion{0.4, 0.2, 0.4})
+
+	// A side that hits the minimum is made up for by the other one.
+	ls[0].SetProportion(0.1)
+	ls[2].SetProportion(0.7)
+	s.setMinProportion(0.05)
+	if moved := s.resizeCentered(ls[1], 0.2); !moved.Equal(0.2) {
+		t.Fatalf("Only %f of 0.2 was moved.", moved)
+	}
+	checkProps(t, tr, ls, []proportion{0.05, 0.4, 0.55})
+
+	// The first child has one neighbor to take everything from.
+	s.setResizeThreshold(0)
+	s.resizeChild(ls[0], 0.05)
+	checkProps(t, tr, ls, []proportion{0.1, 0.35, 0.55})
+	checkValid(t, tr)
+}
+
+func TestMinimumBase(t *testing.T) {
+	// An hsplit of c1 and c2, 100 pixels wide each, with a gap of 10
+	// between them and 5 around them.
+	cs := newFakes(2)
+	tr := rowOf(cs...)
+	for _, c := range cs {
+		c.minw, c.minh = 100, 50
+	}
+	tr.SetGaps(10, 5)
+	if w, h := tr.minimumBase(); w != 220 || h != 60 {
+		t.Fatalf("The tree needs %dx%d instead of 220x60.", w, h)
+	}
+	if w, h := newTree().minimumBase(); w != 0 || h != 0 {
+		t.Fatalf("An empty tree needs %dx%d.", w, h)
+	}
+
+	// The tree is placed in exactly its minimum base, but not in anything
+	// narrower or shorter, whatever the minimum sizes in the nested
+	// splits are.
+	rng := rand.New(rand.NewSource(74))
+	for i := 0; i < 200; i++ {
+		tr, cs := nestedTree(t)
+		for _, c := range cs {
+			c.minw, c.minh = rng.Intn(300), rng.Intn(300)
+			if rng.Intn(4) == 0 {
+				c.anum, c.aden = 1+rng.Intn(16), 1+rng.Intn(9)
+			}
+		}
+		tr.SetGaps(rng.Intn(10), rng.Intn(10))
+		tr.minLeafPx = rng.Intn(50)
+		if rng.Intn(3) == 0 {
+			tr.findLeaf(cs[4]).SetFixedSize(rng.Intn(400))
+		}
+		tr.SetStackFallback(false)
+		fits := func(w, h int) bool {
+			return tr.place(xrect.New(0, 0, w, h)) == placeOK
+		}
+
+		w, h := tr.minimumBase()
+		if !fits(w, h) {
+			t.Fatalf("The tree doesn't fit in its minimum %dx%d.\n%s",
+				w, h, tr.dump())
+		}
+		if fits(w-1, h+1000) || fits(w+1000, h-1) {
+			t.Fatalf("The tree fits in less than its minimum %dx%d.\n%s",
+				w, h, tr.dump())
+		}
+	}
+}
+
+// nestedTree returns a tree of three levels: an hsplit of c1, a vsplit and
+// another vsplit. The first vsplit holds c2, an hsplit of c3 and c4, and c5,
+// and the second one holds c6 and c7.
+func nestedTree(t *testing.T) (*tree, []*fakeClient) {
+	t.Helper()
+	cs := newFakes(7)
+	tr := rowOf(cs[0], cs[1], cs[5])
+	splits := []struct {
+		c, added int
+		dir      direction
+	}{
+		{1, 4, dirDown}, {1, 2, dirDown}, {2, 3, dirRight}, {5, 6, dirDown},
+	}
+	for _, s := range splits {
+		if err := tr.splitLeaf(cs[s.c], s.dir, cs[s.added]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return tr, cs
+}
+
+func TestFrameInsets(t *testing.T) {
+	// c1 above c2, with 20 pixel title bars and at least 10 pixels of
+	// client below them.
+	cs := newFakes(2)
+	for _, c := range cs {
+		c.insets = [4]int{20, 0, 0, 0}
+		c.minh = 10
+	}
+	tr := rowOf(cs...)
+	tr.rotateSplit(tr.child)
+	tr.SetStackFallback(false)
+	if w, h := tr.minimumBase(); w != 1 || h != 60 {
+		t.Fatalf("The tree needs %dx%d instead of 1x60.", w, h)
+	}
+	if r := tr.place(xrect.New(0, 0, 100, 59)); r != placeTooSmall {
+		t.Fatalf("Placing the tree in 59 pixels returned %v.", r)
+	}
+	if r := tr.place(xrect.New(0, 0, 100, 60)); r != placeOK {
+		t.Fatalf("Placing the tree in 60 pixels returned %v.", r)
+	}
+	want := []string{"0,0 100x30", "0,30 100x30"}
+	if got := geomsOf(cs); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("The frames are at %v instead of %v.", got, want)
+	}
+
+	// Without a minimum, each tile still needs its title bar and a pixel.
+	for _, c := range cs {
+		c.minh = 0
+	}
+	if tr.child.ValidDims(tr, 100, 41, 1, 1, 100, 41) {
+		t.Fatalf("Two title bars and their clients fit in 41 pixels.")
+	}
+	if !tr.child.ValidDims(tr, 100, 42, 1, 1, 100, 42) {
+		t.Fatalf("Two title bars and their clients don't fit in 42 pixels.")
+	}
+
+	// The maximum size and aspect ratio are those of the client inside of
+	// the frame.
+	c := newFake(3)
+	c.insets = [4]int{20, 0, 0, 0}
+	c.maxw, c.maxh = 50, 50
+	tr = rowOf(c)
+	base := xrect.New(0, 0, 100, 100)
+	tr.place(base)
+	if got := c.geomString(); got != "25,15 50x70" {
+		t.Fatalf("The frame of '%s' is at %s instead of 25,15 50x70.",
+			c, got)
+	}
+	c.maxw, c.maxh = 0, 0
+	c.anum, c.aden = 1, 1
+	tr.placeForce(base)
+	if got := c.geomString(); got != "10,0 80x100" {
+		t.Fatalf("The frame of '%s' is at %s instead of 10,0 80x100.",
+			c, got)
+	}
+}
+
+func TestScale(t *testing.T) {
+	cs := newFakes(2)
+	a, b := cs[0], cs[1]
+	tr := rowOf(cs...)
+	tr.SetGaps(10, 5)
+	base := xrect.New(0, 0, 1000, 500)
+	tr.place(base)
+	if gap := b.x - (a.x + a.w); a.x != 5 || gap != 10 {
+		t.Fatalf("The gaps are %d and %d instead of 5 and 10.", a.x, gap)
+	}
+
+	// At twice the scale, the gaps are twice as wide, and the tiles share
+	// what is left evenly as before.
+	tr.SetScale(2)
+	tr.place(base)
+	if gap := b.x - (a.x + a.w); a.x != 10 || gap != 20 {
+		t.Fatalf("The gaps are %d and %d instead of 10 and 20.", a.x, gap)
+	}
+	if a.w != b.w || a.w != (1000-20-20)/2 {
+		t.Fatalf("The tiles are %d and %d wide.", a.w, b.w)
+	}
+
+	// Minimum and fixed sizes are doubled too.
+	tr.SetMinLeafSize(100)
+	if w, _ := tr.minimumBase(); w != 2*200+20+20 {
+		t.Fatalf("The tree needs a width of %d instead of 440.", w)
+	}
+	tr.SetFixedSize(tr.findLeaf(a), 100)
+	tr.place(base)
+	if a.w != 200 {
+		t.Fatalf("A fixed width of 100 is %d pixels.", a.w)
+	}
+
+	if c := tr.clone(); c.scale != 2 {
+		t.Fatalf("The clone has the scale %f.", c.scale)
+	}
+	tr.SetScale(-1)
+	if tr.scale != 1 {
+		t.Fatalf("A negative scale left the scale at %f.", tr.scale)
+	}
+}
+
+func TestSticky(t *testing.T) {
+	tr, ls := hsplitOf(0.2, 0.3, 0.5)
+	ls[0].SetSticky(true)
+	s := tr.child.(splitter)
+	sticky := []*leaf{ls[0]}
+
+	// The sticky leaf keeps its 0.2 however the others are rebalanced.
+	for i := 0; i < 5; i++ {
+		tr.addNode(s, newLeaf(s, newFake(10+i)), i%2 == 0)
+		checkProps(t, tr, sticky, []proportion{0.2})
+	}
+	if err := tr.removeNode(ls[1]); err != nil {
+		t.Fatal(err)
+	}
+	checkProps(t, tr, sticky, []proportion{0.2})
+	tr.balance()
+	checkProps(t, tr, sticky, []proportion{0.2})
+	if !tr.equalizeSplit(ls[2].client) {
+		t.Fatalf("The split wasn't equalized.\n%s", tr.dump())
+	}
+	checkProps(t, tr, []*leaf{ls[0], ls[2]}, []proportion{0.2, 0.8 / 6})
+	checkValid(t, tr)
+	if !tr.clone().findLeaf(ls[0].client).Sticky() {
+		t.Fatalf("The clone of the sticky leaf isn't sticky.")
+	}
+
+	// If every leaf is sticky, there is nothing to rebalance.
+	tr, ls = hsplitOf(0.4, 0.6)
+	for _, lf := range ls {
+		lf.SetSticky(true)
+	}
+	if tr.equalizeSplit(ls[0].client) {
+		t.Fatalf("A split of sticky leaves was equalized.")
+	}
+	tr.balance()
+	checkProps(t, tr, ls, []proportion{0.4, 0.6})
+}
+
+func TestStruts(t *testing.T) {
+	// c1 above c2.
+	cs := newFakes(2)
+	a, b := cs[0], cs[1]
+	tr := rowOf(cs...)
+	tr.rotateSplit(tr.child)
+	base := xrect.New(0, 0, 800, 600)
+	tr.place(base)
+
+	// A panel at the top pushes everything down by 30 pixels, and takes
+	// them from the height of the tiles.
+	tr.setStruts(30, 0, 0, 0)
+	tr.place(base)
+	if a.y != 30 || b.y+b.h != 600 || a.h+b.h != 600-30 {
+		t.Fatalf("The clients are at %v.\n%s", geomsOf(cs), tr.dump())
+	}
+
+	// The outer gap is inside of the struts.
+	tr.SetGaps(0, 5)
+	tr.setStruts(30, 10, 20, 40)
+	tr.place(base)
+	if a.x != 45 || a.y != 35 || a.w != 800-40-10-10 ||
+		b.y+b.h != 600-20-5 {
+
+		t.Fatalf("The clients are at %v.\n%s", geomsOf(cs), tr.dump())
+	}
+	if w, h := tr.minimumBase(); w != 60 || h != 60 {
+		t.Fatalf("The tree needs %dx%d instead of 60x60.", w, h)
+	}
+}
+
+func TestRefreshConstraints(t *testing.T) {
+	tr, ls := hsplitOf(0.2, 0.4, 0.4)
+	c := ls[0].client.(*fakeClient)
+	tr.place(xrect.New(0, 0, 1000, 500))
+	if c.w != 200 {
+		t.Fatalf("'%s' is %d pixels wide instead of 200.", c, c.w)
+	}
+
+	// c1 asks for 300 pixels, and takes them from the others.
+	c.minw = 300
+	if !tr.refreshConstraints(c) {
+		t.Fatalf("'%s' wasn't grown to its new minimum.", c)
+	}
+	checkValid(t, tr)
+	if p := ls[0].Proportion(); c.w < 300 || p < 0.3-epsilon {
+		t.Fatalf("'%s' is %d pixels wide with the proportion %f.\n%s",
+			c, c.w, p, tr.dump())
+	}
+
+	// A minimum taller than the screen can't be met, but the tree is none
+	// the worse for it.
+	c.minh = 800
+	tr.refreshConstraints(c)
+	checkValid(t, tr)
+	if tr.refreshConstraints(newFake(9)) {
+		t.Fatalf("A client that isn't tiled was refreshed.")
+	}
+}
+
+func TestPreview(t *testing.T) {
+	cs := newFakes(3)
+	a, b, c := cs[0], cs[1], cs[2]
+	tr := rowOf(a, b)
+	base := xrect.New(0, 0, 1000, 500)
+	tr.place(base)
+	before, undos := tr.dump(), len(tr.undoStack)
+	moves(cs)
+
+	// The preview splits, stacks, animates and zooms, none of which may
+	// reach the clients or the tree itself.
+	geoms := tr.preview(func(p *tree) {
+		if err := p.splitLeaf(a, dirDown, c); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.stackWith(b, newFake(4)); err != nil {
+			t.Fatal(err)
+		}
+		p.placeAnimated(base, time.Second, nil, nil)
+		p.zoom(c)
+	}, base)
+	if n := moves(cs); tr.dump() != before || n != 0 {
+		t.Fatalf("The preview moved %d clients and left the tree as\n%s",
+			n, tr.dump())
+	}
+	if b.unmapped || c.unmapped {
+		t.Fatalf("The preview hid a client.")
+	}
+	if len(geoms) != 4 || geoms[c] == nil || geoms[c].Y() <= geoms[a].Y() {
+		t.Fatalf("The preview has the geometries %v.", geoms)
+	}
+	if tr.findLeaf(c) != nil || tr.dryRun || len(tr.undoStack) != undos {
+		t.Fatalf("The preview left its state behind in the tree.\n%s",
+			tr.dump())
+	}
+}
+
+func TestFocusWrap(t *testing.T) {
+	// c1 above c2 beside c3 above c4.
+	cs := newFakes(4)
+	tr := rowOf(cs[0], cs[2])
+	for _, i := range []int{0, 2} {
+		if err := tr.splitLeaf(cs[i], dirDown, cs[i+1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if lf := tr.leafInDirection(cs[3], dirRight); lf != nil {
+		t.Fatalf("'%s' has %v to its right without wrapping.", cs[3], lf)
+	}
+
+	tr.SetFocusWrap(true)
+	tests := []struct {
+		from *fakeClient
+		dir  direction
+		want *fakeClient
+	}{
+		{cs[3], dirRight, cs[1]},
+		{cs[0], dirLeft, cs[2]},
+		{cs[3], dirDown, cs[2]},
+		{cs[0], dirUp, cs[1]},
+		{cs[0], dirRight, cs[2]},
+	}
+	for _, test := range tests {
+		lf := tr.leafInDirection(test.from, test.dir)
+		if lf == nil || lf.client != Client(test.want) {
+			t.Errorf("Going %d from '%s' gave %v instead of '%s'.",
+				test.dir, test.from, lf, test.want)
+		}
+	}
+	if !tr.clone().focusWrap {
+		t.Fatalf("The clone doesn't wrap.")
+	}
+
+	// A client alone has nothing to wrap around to.
+	tr = rowOf(cs[0])
+	tr.SetFocusWrap(true)
+	for _, dir := range []direction{dirRight, dirDown} {
+		if lf := tr.leafInDirection(cs[0], dir); lf != nil {
+			t.Fatalf("'%s' alone wrapped around to %v.", cs[0], lf)
+		}
+	}
+}
+
+func TestDetachAttach(t *testing.T) {
+	// c1 beside c2 above c3 beside c4.
+	cs := newFakes(4)
+	a, b, c, d := cs[0], cs[1], cs[2], cs[3]
+	tr := rowOf(a, b, d)
+	if err := tr.splitLeaf(b, dirDown, c); err != nil {
+		t.Fatal(err)
+	}
+	root := tr.child.(splitter)
+	v := tr.findLeaf(b).Parent().(*vsplit)
+	base := xrect.New(0, 0, 900, 600)
+	tr.place(base)
+	before := geomsOf(cs)
+
+	if _, err := tr.detach(root); err == nil {
+		t.Fatalf("The root was detached.")
+	}
+	cut, err := tr.detach(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkValid(t, tr)
+	if cut != v || v.Parent() != nil || root.Size() != 2 {
+		t.Fatalf("The vsplit wasn't cut out.\n%s", tr.dump())
+	}
+	if err := tr.attach(v, v.Child(0), dirRight); err == nil {
+		t.Fatalf("The vsplit was attached inside of itself.")
+	}
+	if err := tr.attach(root, tr.findLeaf(a), dirRight); err == nil {
+		t.Fatalf("A node that is still attached was attached again.")
+	}
+
+	// Pasting the vsplit back beside c1 puts it back between c1 and c4,
+	// with half of what c1 had. Undoing the cut and the paste brings back
+	// the geometry from before.
+	if err := tr.attach(cut, tr.findLeaf(a), dirRight); err != nil {
+		t.Fatal(err)
+	}
+	checkValid(t, tr)
+	tr.place(base)
+	if root.Child(1) != v || a.x >= b.x || b.x >= d.x || b.x != c.x {
+		t.Fatalf("The clients are at %v.\n%s", geomsOf(cs), tr.dump())
+	}
+	if !tr.undo() || !tr.undo() {
+		t.Fatalf("The cut and paste couldn't be undone.")
+	}
+	tr.place(base)
+	if got := geomsOf(cs); fmt.Sprint(got) != fmt.Sprint(before) {
+		t.Fatalf("The clients are at %v instead of %v.\n%s",
+			got, before, tr.dump())
+	}
+	v = tr.findLeaf(b).Parent().(*vsplit)
+
+	// Below c4, which isn't in a vsplit, the vsplit is spliced into a new
+	// one.
+	if _, err := tr.detach(v); err != nil {
+		t.Fatal(err)
+	}
+	dl := tr.findLeaf(d)
+	if err := tr.attach(v, dl, dirDown); err != nil {
+		t.Fatal(err)
+	}
+	checkValid(t, tr)
+	tr.place(base)
+	if b.x != d.x || b.y <= d.y || c.y <= b.y ||
+		tr.findLeaf(b).Parent() != dl.Parent() {
+
+		t.Fatalf("The clients are at %v.\n%s", geomsOf(cs), tr.dump())
+	}
+}
+
+func TestIsVisible(t *testing.T) {
+	// Tabs of c1 and c2 beside tabs of c3 and c4 above c5. c2 and c3 are
+	// the tabs that are shown.
+	cs := newFakes(5)
+	tr := rowOf(cs[0], cs[2])
+	if err := tr.splitLeaf(cs[2], dirDown, cs[4]); err != nil {
+		t.Fatal(err)
+	}
+	for _, i := range []int{0, 2} {
+		if err := tr.stackWith(cs[i], cs[i+1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tr.findLeaf(cs[2]).Parent().(*stack).selectPrev()
+	tr.place(xrect.New(0, 0, 400, 400))
+	want := []bool{false, true, true, false, true}
+	for i, c := range cs {
+		if tr.isVisible(c) != want[i] || c.unmapped == want[i] {
+			t.Fatalf("'%s' should be visible: %t.\n%s",
+				c, want[i], tr.dump())
+		}
+	}
+
+	// In a monocle, only the active client is.
+	cs[4].active = true
+	if !tr.toMonocle() {
+		t.Fatalf("The tree wasn't made a monocle.")
+	}
+	for i, c := range cs {
+		if tr.isVisible(c) != (i == 4) {
+			t.Fatalf("'%s' should be visible in the monocle: %t.\n%s",
+				c, i == 4, tr.dump())
+		}
+	}
+	if tr.isVisible(newFake(9)) {
+		t.Fatalf("A client that isn't tiled is visible.")
+	}
+
+	// Neither is a tile that has been scrolled out of view.
+	cs = newFakes(4)
+	tr = rowOf(cs...)
+	tr.SetMinLeafSize(30)
+	tr.SetScrollOverflow(true)
+	tr.place(xrect.New(0, 0, 100, 100))
+	if !tr.isVisible(cs[0]) || tr.isVisible(cs[3]) {
+		t.Fatalf("The first client should be visible, and the last one " +
+			"scrolled out of view.")
+	}
+}
+
+func TestResizeBothSides(t *testing.T) {
+	tr, ls := hsplitOf(fullPortion/3, fullPortion/3, fullPortion/3)
+	s := asSplit(tr.child)
+	third := fullPortion / 3
+
+	// Both neighbors of c2 shrink by half of what it grows.
+	if moved := s.resizeBothSides(ls[1], 0.2); !moved.Equal(0.2) {
+		t.Fatalf("Only %f of 0.2 was moved.", moved)
+	}
+	checkProps(t, tr, ls, []proportion{third - 0.1, third + 0.2, third - 0.1})
+
+	// Each neighbor is held to the minimum on its own, and unlike
+	// resizeCentered, the other one doesn't make up for it.
+	ls[0].SetProportion(0.15)
+	ls[1].SetProportion(0.5)
+	ls[2].SetProportion(0.35)
+	if moved := s.resizeBothSides(ls[1], 0.2); !moved.Equal(0.15) {
+		t.Fatalf("%f was moved instead of 0.15.", moved)
+	}
+	checkProps(t, tr, ls, []proportion{0.1, 0.65, 0.25})
+
+	// Shrinking gives both neighbors half.
+	ls[0].SetProportion(0.3)
+	ls[1].SetProportion(0.4)
+	ls[2].SetProportion(0.3)
+	if moved := s.resizeBothSides(ls[1], -0.1); !moved.Equal(-0.1) {
+		t.Fatalf("%f was moved instead of -0.1.", moved)
+	}
+	checkProps(t, tr, ls, []proportion{0.35, 0.3, 0.35})
+
+	// The first child only has one neighbor to take from.
+	if moved := s.resizeBothSides(ls[0], 0.1); !moved.Equal(0.1) {
+		t.Fatalf("%f was moved instead of 0.1.", moved)
+	}
+	checkProps(t, tr, ls, []proportion{0.45, 0.2, 0.35})
+	checkValid(t, tr)
+}
+
+func TestCenterOver(t *testing.T) {
+	// c1 beside c2 above c3, so the tile of c3 is at 500,400 500x400.
+	cs := newFakes(3)
+	tr := rowOf(cs[0], cs[1])
+	if err := tr.splitLeaf(cs[1], dirDown, cs[2]); err != nil {
+		t.Fatal(err)
+	}
+	base := xrect.New(0, 0, 1000, 800)
+	tests := []struct {
+		name   string
+		parent Client
+		w, h   int
+		base   xrect.Rect
+		x, y   int
+	}{
+		{"nested", cs[2], 100, 50, base, 700, 575},
+		{"not tiled", newFake(9), 100, 50, base, 450, 375},
+		{"wider than the tile", cs[2], 800, 100, base, 200, 550},
+		{"offset base", cs[0], 100, 100, xrect.New(100, 50, 1000, 800),
+			300, 400},
+	}
+	for _, test := range tests {
+		x, y := tr.centerOver(test.parent, test.w, test.h, test.base)
+		if x != test.x || y != test.y {
+			t.Errorf("%s: The window is at (%d, %d) instead of (%d, %d).",
+				test.name, x, y, test.x, test.y)
+		}
+	}
+}
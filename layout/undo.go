@@ -0,0 +1,357 @@
+package layout
+
+import (
+	"github.com/cshapeshifter/wingo/logger"
+)
+
+// maxUndo is the maximum number of mutations that can be undone.
+const maxUndo = 50
+
+// validateMutations makes mutate check the integrity of the tree (see
+// validate) after every mutation, and log whatever is wrong with it. It is
+// meant to be turned on while debugging, since it walks the whole tree.
+var validateMutations = false
+
+// snapshot is a memento of the structure of a tree. It records the parent,
+// proportion, fixed size and children (or client) of every node in the
+// tree, so that restoring it puts the very same nodes back where they were.
+// This is important since layouts keep references to some of their splits.
+// The structure kept aside by a monocle is recorded too, and so are the
+// columns of a master/stack tree, since setLayout can change which they are.
+type snapshot struct {
+	root       node
+	unmonocled node
+	entries    []snapEntry
+	floating   []Client
+
+	masterCol, stackCol *vsplit
+	masterProp          proportion
+	stackFallback       bool
+}
+
+type snapEntry struct {
+	n        node
+	parent   node
+	prop     proportion
+	fixed    int
+	children []node
+	client   Client
+	active   int
+	unzoomed []proportion
+	cells    [][]*leaf
+	rowProps []proportion
+	colProps []proportion
+}
+
+// snapshot records the state of the tree. It takes time and memory in
+// proportion to the number of nodes, which is what every mutation costs on
+// top of the change itself. To keep that down, the entries are allocated
+// all at once, with room for as many nodes as the last snapshot had.
+func (t *tree) snapshot() *snapshot {
+	snap := &snapshot{
+		root:       t.child,
+		unmonocled: t.unmonocled,
+		floating:   append([]Client{}, t.floating...),
+		entries:    make([]snapEntry, 0, t.snapSize),
+
+		masterCol:     t.masterCol,
+		stackCol:      t.stackCol,
+		masterProp:    t.masterProp,
+		stackFallback: t.stackFallback,
+	}
+	var walk func(n node)
+	walk = func(n node) {
+		e := snapEntry{
+			n:      n,
+			parent: n.Parent(),
+			prop:   n.Proportion(),
+			fixed:  n.FixedSize(),
+		}
+		switch n := n.(type) {
+		case *leaf:
+			e.client = n.client
+		case *stack:
+			for _, lf := range n.leaves {
+				e.children = append(e.children, lf)
+			}
+			e.active = n.active
+		case *grid:
+			n.VisitLeafNodes(func(lf *leaf) bool {
+				e.children = append(e.children, lf)
+				return true
+			})
+			for _, row := range n.cells {
+				e.cells = append(e.cells, append([]*leaf{}, row...))
+			}
+			e.rowProps = append([]proportion{}, n.rowProps...)
+			e.colProps = append([]proportion{}, n.colProps...)
+		default:
+			if s := asSplit(n); s != nil {
+				e.children = append([]node{}, s.children...)
+				e.unzoomed = s.unzoomed
+			}
+		}
+		snap.entries = append(snap.entries, e)
+		for _, child := range e.children {
+			walk(child)
+		}
+	}
+	if t.child != nil {
+		walk(t.child)
+	}
+	if t.unmonocled != nil {
+		walk(t.unmonocled)
+	}
+	t.snapSize = len(snap.entries)
+	return snap
+}
+
+// restore puts the tree back into the state recorded by snap.
+func (t *tree) restore(snap *snapshot) {
+	t.child, t.unmonocled = snap.root, snap.unmonocled
+	t.masterCol, t.stackCol = snap.masterCol, snap.stackCol
+	t.masterProp, t.stackFallback = snap.masterProp, snap.stackFallback
+	t.floating = append([]Client{}, snap.floating...)
+	for _, e := range snap.entries {
+		e.n.SetParent(e.parent)
+		e.n.SetProportion(e.prop)
+		e.n.SetFixedSize(e.fixed)
+		if lf, ok := e.n.(*leaf); ok {
+			lf.client = e.client
+		} else if st, ok := e.n.(*stack); ok {
+			st.leaves = st.leaves[:0]
+			for _, child := range e.children {
+				st.leaves = append(st.leaves, child.(*leaf))
+			}
+			st.active = e.active
+		} else if g, ok := e.n.(*grid); ok {
+			g.rows, g.cols = len(e.cells), len(e.colProps)
+			g.cells = make([][]*leaf, len(e.cells))
+			for r, row := range e.cells {
+				g.cells[r] = append([]*leaf{}, row...)
+			}
+			g.rowProps = append([]proportion{}, e.rowProps...)
+			g.colProps = append([]proportion{}, e.colProps...)
+		} else if s := asSplit(e.n); s != nil {
+			s.children = append([]node{}, e.children...)
+			s.unzoomed = e.unzoomed
+		}
+	}
+	t.invalidate()
+}
+
+// clients returns every client referenced by the snapshot, including the
+// floating ones.
+func (snap *snapshot) clients() []Client {
+	clients := make([]Client, 0)
+	for _, e := range snap.entries {
+		if e.client != nil {
+			clients = append(clients, e.client)
+		}
+	}
+	return append(clients, snap.floating...)
+}
+
+// mutate runs f, which changes the structure of the tree and returns whether
+// it did so, and records the state of the tree before f so that the change
+// can be undone. Mutations made while another mutation is running are part
+// of the outer mutation.
+func (t *tree) mutate(name string, f func() bool) bool {
+	if t.mutating {
+		return f()
+	}
+
+	before := t.snapshot()
+	t.mutating = true
+	changed := f()
+	t.mutating = false
+	if changed {
+		t.invalidate()
+	}
+	if validateMutations {
+		for _, err := range t.validate() {
+			logger.Warning.Printf("After %s: %s", name, err)
+		}
+	}
+	if changed {
+		t.undoStack = pushSnapshot(t.undoStack, before)
+		t.redoStack = nil
+		if recordMutations {
+			t.record(name, before)
+		}
+	}
+	return changed
+}
+
+// mutateErr is like mutate for mutations that fail with an error.
+func (t *tree) mutateErr(name string, f func() error) error {
+	var err error
+	t.mutate(name, func() bool {
+		err = f()
+		return err == nil
+	})
+	return err
+}
+
+func pushSnapshot(stack []*snapshot, snap *snapshot) []*snapshot {
+	stack = append(stack, snap)
+	if len(stack) > maxUndo {
+		stack = stack[len(stack)-maxUndo:]
+	}
+	return stack
+}
+
+// undo reverts the last mutation of the tree and places the tree again.
+// If a client referenced by the state being restored no longer exists, the
+// undo and redo history is cleared and false is returned.
+func (t *tree) undo() bool {
+	if len(t.undoStack) == 0 {
+		return false
+	}
+	snap := t.undoStack[len(t.undoStack)-1]
+	t.undoStack = t.undoStack[:len(t.undoStack)-1]
+	if !t.restorable(snap) {
+		t.undoStack, t.redoStack = nil, nil
+		return false
+	}
+	t.redoStack = pushSnapshot(t.redoStack, t.snapshot())
+	t.restoreHistory(snap)
+	return true
+}
+
+// redo reapplies the last mutation reverted by undo. It behaves like undo if
+// a client no longer exists.
+func (t *tree) redo() bool {
+	if len(t.redoStack) == 0 {
+		return false
+	}
+	snap := t.redoStack[len(t.redoStack)-1]
+	t.redoStack = t.redoStack[:len(t.redoStack)-1]
+	if !t.restorable(snap) {
+		t.undoStack, t.redoStack = nil, nil
+		return false
+	}
+	t.undoStack = pushSnapshot(t.undoStack, t.snapshot())
+	t.restoreHistory(snap)
+	return true
+}
+
+// rollback reverts the last mutation of the tree like undo, for a caller
+// that couldn't finish the change that the mutation was a part of. Unlike
+// undo, it leaves the redo history and the parked clients as they were, as
+// if the mutation had never happened.
+func (t *tree) rollback() {
+	redo := t.redoStack
+	parked := make(map[Client]bool, len(t.parked))
+	for c := range t.parked {
+		parked[c] = true
+	}
+	if t.undo() {
+		t.redoStack, t.parked = redo, parked
+	}
+}
+
+// restoreHistory restores snap for undo or redo and places the tree again.
+// Clients that drop out of the tree because of this are remembered as parked,
+// since they were removed by the history rather than by a caller, and can
+// therefore be brought back.
+func (t *tree) restoreHistory(snap *snapshot) {
+	for _, c := range t.snapshot().clients() {
+		t.parked[c] = true
+	}
+	t.restore(snap)
+	t.dropForgotten()
+	for _, c := range snap.clients() {
+		delete(t.parked, c)
+	}
+	t.replace()
+}
+
+// dropForgotten removes the leaves that were restored without a client,
+// because their client was forgotten after the snapshot was taken. This
+// runs as part of undo or redo, so it must not record a mutation of its own.
+func (t *tree) dropForgotten() {
+	defer func(mutating bool) { t.mutating = mutating }(t.mutating)
+	t.mutating = true
+
+	for _, root := range []node{t.child, t.unmonocled} {
+		if root == nil {
+			continue
+		}
+		var empty []*leaf
+		root.VisitLeafNodes(func(lf *leaf) bool {
+			if lf.client == nil {
+				empty = append(empty, lf)
+			}
+			return true
+		})
+		for _, lf := range empty {
+			parent, ok := lf.Parent().(splitter)
+			switch {
+			case !ok && lf == t.child:
+				t.setChild(nil)
+			case !ok && lf == t.unmonocled:
+				t.unmonocled = nil
+			case ok && parent.RemoveNode(lf) == nil:
+				if err := t.tidy(parent); err != nil {
+					logger.Warning.Println(err)
+				}
+			}
+		}
+	}
+}
+
+// forget tells the tree that c no longer exists, so that undo and redo won't
+// try to bring it back. It should be called when a client is destroyed.
+// If c is floating, it is dropped from the floating clients too.
+//
+// The undo and redo history lets go of c as well, so that up to maxUndo
+// snapshots don't keep a closed client around. The leaf of c is left out
+// when such a snapshot is restored (see dropForgotten).
+func (t *tree) forget(c Client) {
+	delete(t.parked, c)
+	if i := t.floatingIndex(c); i >= 0 {
+		t.floating = append(t.floating[:i], t.floating[i+1:]...)
+	}
+	for _, history := range [][]*snapshot{t.undoStack, t.redoStack} {
+		for _, snap := range history {
+			snap.forget(c)
+		}
+	}
+}
+
+// forget drops every reference to c from snap. The leaf of c is kept in the
+// snapshot without a client, since the rest of the structure refers to it.
+func (snap *snapshot) forget(c Client) {
+	for i := range snap.entries {
+		e := &snap.entries[i]
+		if e.client != c {
+			continue
+		}
+		e.client = nil
+		if lf := e.n.(*leaf); lf.client == c {
+			lf.client = nil
+		}
+	}
+	for i, fc := range snap.floating {
+		if fc == c {
+			snap.floating = append(snap.floating[:i], snap.floating[i+1:]...)
+			break
+		}
+	}
+}
+
+// restorable returns true if every client in snap still exists. A client
+// exists if it is currently in the tree (tiled or floating), if it is parked
+// (see restoreHistory), or if the tree's alive function says so.
+func (t *tree) restorable(snap *snapshot) bool {
+	for _, c := range snap.clients() {
+		if t.findLeaf(c) != nil || t.isFloating(c) || t.parked[c] {
+			continue
+		}
+		if t.alive == nil || !t.alive(c) {
+			return false
+		}
+	}
+	return true
+}
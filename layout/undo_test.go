@@ -0,0 +1,143 @@
+package layout
+
+import (
+	"testing"
+
+	"github.com/BurntSushi/xgbutil/xrect"
+)
+
+func TestUndoRedo(t *testing.T) {
+	cs := newFakes(3)
+	tr := newMasterStack(cs[0], []Client{cs[1]})
+	before := tr.dump()
+	if err := tr.splitLeaf(cs[1], dirDown, cs[2]); err != nil {
+		t.Fatal(err)
+	}
+	split := tr.dump()
+	tr.rotateSplit(tr.findLeaf(cs[2]))
+
+	for i, step := range []struct {
+		f    func() bool
+		want string
+	}{
+		{tr.undo, split},
+		{tr.undo, before},
+		{tr.redo, split},
+	} {
+		if !step.f() {
+			t.Fatalf("Step %d did nothing.\n%s", i, tr.dump())
+		}
+		checkValid(t, tr)
+		if got := tr.dump(); got != step.want {
+			t.Fatalf("After step %d, the tree is\n%s\ninstead of\n%s",
+				i, got, step.want)
+		}
+	}
+
+	// A client that was removed for good is left out of the history, rather
+	// than brought back by it.
+	if err := tr.removeClient(cs[2]); err != nil {
+		t.Fatal(err)
+	}
+	removed := tr.dump()
+	for i, want := range []string{removed, before} {
+		if !tr.undo() {
+			t.Fatalf("Undo %d after the removal did nothing.\n%s",
+				i, tr.dump())
+		}
+		checkValid(t, tr)
+		if got := tr.dump(); got != want {
+			t.Fatalf("After undo %d, the tree is\n%s\ninstead of\n%s",
+				i, got, want)
+		}
+	}
+	for _, snap := range append(tr.undoStack, tr.redoStack...) {
+		for _, e := range snap.entries {
+			if lf, ok := e.n.(*leaf); e.client == cs[2] ||
+				ok && lf.client == cs[2] {
+
+				t.Fatalf("The history still refers to '%s'.", cs[2])
+			}
+		}
+	}
+}
+
+// regrid lays out the leaves of g in rows and cols, in row-major order, with
+// equally sized rows and columns.
+func regrid(g *grid, rows, cols int) {
+	var leaves []*leaf
+	g.VisitLeafNodes(func(lf *leaf) bool {
+		leaves = append(leaves, lf)
+		return true
+	})
+	fresh := newGrid(rows, cols)
+	for i, lf := range leaves {
+		fresh.cells[i/cols][i%cols] = lf
+	}
+	g.rows, g.cols, g.cells = fresh.rows, fresh.cols, fresh.cells
+	g.rowProps, g.colProps = fresh.rowProps, fresh.colProps
+}
+
+func TestUndoGrid(t *testing.T) {
+	cs := newFakes(7)
+	tr := newTree()
+	g := newGrid(2, 3)
+	g.SetProportion(fullPortion)
+	for i, c := range cs[:5] {
+		g.setCell(i/3, i%3, c)
+	}
+	g.setColWeights([]int{1, 2, 3})
+	tr.setChild(g)
+	base := xrect.New(0, 0, 600, 400)
+	want := placedGeoms(tr, cs[:5], base)
+
+	for _, change := range []func(){
+		func() {
+			// Fills the empty cell, then adds a row.
+			g.AddNode(newLeaf(nil, cs[5]), true)
+			g.AddNode(newLeaf(nil, cs[6]), true)
+		},
+		func() {
+			g.setColWeights([]int{3, 2, 1})
+		},
+		func() {
+			regrid(g, 3, 2)
+		},
+	} {
+		tr.mutate("changeGrid", func() bool {
+			change()
+			return true
+		})
+		if !tr.undo() {
+			t.Fatalf("The change was not undone.\n%s", tr.dump())
+		}
+		checkValid(t, tr)
+		if g.rows != 2 || g.cols != 3 || len(g.rowProps) != 2 ||
+			len(g.colProps) != 3 {
+
+			t.Fatalf("The grid is %dx%d with %d row and %d column "+
+				"proportions after undo.", g.rows, g.cols,
+				len(g.rowProps), len(g.colProps))
+		}
+		got := placedGeoms(tr, cs[:5], base)
+		for i := range got {
+			if got[i] != want[i] {
+				t.Fatalf("'%s' is at %s instead of %s after undo.\n%s",
+					cs[i], got[i], want[i], tr.dump())
+			}
+		}
+		if !tr.redo() || !tr.undo() {
+			t.Fatalf("The change was not redone.\n%s", tr.dump())
+		}
+	}
+}
+
+func BenchmarkMutate(b *testing.B) {
+	tr, _ := masterStackOf(50)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		tr.mutate("nothing", func() bool {
+			return false
+		})
+	}
+}
@@ -4,13 +4,27 @@ import (
 	"fmt"
 
 	"github.com/BurntSushi/xgbutil/xrect"
+
+	"github.com/cshapeshifter/wingo/logger"
 )
 
+// verthorz holds the lock of its tree in every method (see tree). The
+// methods have pointer receivers, so that none of the fields are copied
+// before the lock is taken.
 type verthorz struct {
 	store                 *tree
 	root, masters, slaves splitter
 	allowedMasters        int
 	geom                  xrect.Rect
+
+	// unplaced is set by Unplace, so that the next placement moves every
+	// client.
+	unplaced bool
+
+	// splitAt is set by Split, so that the next client added is tiled beside
+	// it, on the side given by splitDir.
+	splitAt  Client
+	splitDir direction
 }
 
 type Vertical struct {
@@ -36,6 +50,9 @@ func NewVertical() *Vertical {
 	lay.root.AddNode(lay.masters, true)
 	lay.root.AddNode(lay.slaves, true)
 
+	// The layout keeps references to its splits, so they must never be
+	// turned into stacks.
+	lay.store.SetStackFallback(false)
 	return lay
 }
 
@@ -54,6 +71,9 @@ func NewHorizontal() *Horizontal {
 	lay.root.AddNode(lay.masters, true)
 	lay.root.AddNode(lay.slaves, true)
 
+	// The layout keeps references to its splits, so they must never be
+	// turned into stacks.
+	lay.store.SetStackFallback(false)
 	return lay
 }
 
@@ -65,156 +85,399 @@ func (v *Horizontal) Name() string {
 	return "Horizontal"
 }
 
-func (lay verthorz) Destroy() {
+func (lay *verthorz) Destroy() {
 }
 
 func (lay *verthorz) SetGeom(geom xrect.Rect) {
+	lay.store.Lock()
+	defer lay.store.Unlock()
+
 	lay.geom = geom
 }
 
-func (lay verthorz) Place() {
-	lay.store.place(lay.geom)
+// Place places the tree. Clients that the tree already gave the same
+// geometry are skipped (see tree.place), so that calling it again and again,
+// as the window manager does, doesn't bother the X server. The first
+// placement after Unplace moves every client, though.
+func (lay *verthorz) Place() {
+	lay.store.Lock()
+	defer lay.store.Unlock()
+
+	lay.place()
+}
+
+// place is Place for the methods of the layout, which already hold the lock
+// of the tree.
+func (lay *verthorz) place() {
+	if !lay.unplaced {
+		lay.store.place(lay.geom)
+		return
+	}
+	if lay.store.placeForce(lay.geom) == placeOK {
+		lay.unplaced = false
+	}
+}
+
+// Unplace is called when the clients are handed over to another layout,
+// which may move them anywhere. So the next placement can't trust where the
+// tree left them, and moves all of them.
+func (lay *verthorz) Unplace() {
+	lay.store.Lock()
+	defer lay.store.Unlock()
+
+	lay.unplaced = true
 }
 
-func (lay verthorz) Unplace() {}
+func (lay *verthorz) Exists(c Client) bool {
+	lay.store.RLock()
+	defer lay.store.RUnlock()
 
-func (lay verthorz) Exists(c Client) bool {
 	return lay.store.findLeaf(c) != nil
 }
 
-func (lay verthorz) ResizeMaster(amount float64) {
+func (lay *verthorz) ResizeMaster(amount float64) {
+	lay.store.Lock()
+	defer lay.store.Unlock()
+
 	if lay.root.Size() == 2 {
 		lay.root.PropsSave()
 
 		newProp := lay.masters.Proportion() + proportion(amount)
 		lay.root.SetChildProportion(lay.masters, newProp)
 
-		if lay.store.place(lay.geom) {
+		if lay.store.place(lay.geom) == placeOK {
 			lay.root.PropsClear()
+			lay.snap()
 		} else {
 			lay.root.PropsRollback()
 		}
 	}
 }
 
-func (lay verthorz) ResizeWindow(amount float64) {
+func (lay *verthorz) ResizeWindow(amount float64) {
+	lay.store.Lock()
+	defer lay.store.Unlock()
+
 	if lf := lay.leafCurrent(); lf != nil && lf.parent.Size() > 1 {
 		lf.parent.PropsSave()
 
 		newProp := lf.Proportion() + proportion(amount)
 		lf.parent.SetChildProportion(lf, newProp)
 
-		if lay.store.place(lay.geom) {
+		if lay.store.place(lay.geom) == placeOK {
 			lf.parent.PropsClear()
+			lay.snap()
 		} else {
 			lf.parent.PropsRollback()
 		}
 	}
 }
 
-func (lay verthorz) Add(c Client) {
+func (lay *verthorz) Add(c Client) {
+	lay.store.Lock()
+	defer lay.store.Unlock()
+
+	if at := lay.splitAt; at != nil {
+		lay.splitAt = nil
+		err := lay.store.splitLeaf(at, lay.splitDir, c)
+		if err == nil {
+			lay.adjustMasters()
+			lay.adjustSplits()
+			return
+		}
+		logger.Warning.Println(err)
+	}
 	lay.slaves.AddNode(newLeaf(lay.slaves, c), true)
 	lay.adjustMasters()
 	lay.adjustSplits()
 }
 
-func (lay verthorz) Remove(c Client) {
+func (lay *verthorz) Remove(c Client) {
+	lay.store.Lock()
+	defer lay.store.Unlock()
+
+	if c == lay.splitAt {
+		lay.splitAt = nil
+	}
 	if leaf := lay.store.findLeaf(c); leaf != nil {
 		switch {
 		case leaf.parent == lay.masters:
-			lay.masters.RemoveNode(leaf)
+			lay.removeNode(lay.masters, leaf)
 		case leaf.parent == lay.slaves:
-			lay.slaves.RemoveNode(leaf)
+			lay.removeNode(lay.slaves, leaf)
 		default:
-			panic(fmt.Sprintf("Client '%s' not in masters or slaves.", c))
+			// The leaf is in a split made by Split, which is tidied away
+			// once it is left with a single leaf.
+			if err := lay.store.removeNode(leaf); err != nil {
+				logger.Warning.Println(err)
+			}
 		}
 		lay.adjustMasters()
 		lay.adjustSplits()
 	}
 }
 
-func (lay verthorz) Next() {
-	if lf := lay.leafCurrent(); lf != nil {
-		next := lay.leafNext(lf).client
-		next.Focus()
-		next.Raise()
-	}
+func (lay *verthorz) Next() {
+	lay.focus(func() *leaf {
+		if lf := lay.leafCurrent(); lf != nil {
+			return lay.leafNext(lf)
+		}
+		return nil
+	})
 }
 
-func (lay verthorz) Prev() {
-	if lf := lay.leafCurrent(); lf != nil {
-		prev := lay.leafPrev(lf).client
-		prev.Focus()
-		prev.Raise()
-	}
+func (lay *verthorz) Prev() {
+	lay.focus(func() *leaf {
+		if lf := lay.leafCurrent(); lf != nil {
+			return lay.leafPrev(lf)
+		}
+		return nil
+	})
 }
 
-func (lay Horizontal) Next() {
+func (lay *Horizontal) Next() {
 	lay.verthorz.Prev()
 }
 
-func (lay Horizontal) Prev() {
+func (lay *Horizontal) Prev() {
 	lay.verthorz.Next()
 }
 
-func (lay verthorz) SwitchNext() {
+func (lay *verthorz) SwitchNext() {
+	lay.store.Lock()
+	defer lay.store.Unlock()
+
 	if lf := lay.leafCurrent(); lf != nil {
 		next := lay.leafNext(lf)
 		lay.store.switchClients(lf, next)
-		lay.Place()
+		lay.place()
 	}
 }
 
-func (lay verthorz) SwitchPrev() {
+func (lay *verthorz) SwitchPrev() {
+	lay.store.Lock()
+	defer lay.store.Unlock()
+
 	if lf := lay.leafCurrent(); lf != nil {
 		next := lay.leafPrev(lf)
 		lay.store.switchClients(lf, next)
-		lay.Place()
+		lay.place()
 	}
 }
 
-func (lay Horizontal) SwitchNext() {
+func (lay *Horizontal) SwitchNext() {
 	lay.verthorz.SwitchPrev()
 }
 
-func (lay Horizontal) SwitchPrev() {
+func (lay *Horizontal) SwitchPrev() {
 	lay.verthorz.SwitchNext()
 }
 
-func (lay verthorz) FocusMaster() {
-	if lay.masters.Size() > 0 {
-		c := lay.masters.Child(0).(*leaf).client
-		c.Focus()
-		c.Raise()
+func (lay *verthorz) FocusMaster() {
+	lay.focus(func() *leaf {
+		if lay.masters.Size() > 0 {
+			return firstLeaf(lay.masters.Child(0))
+		}
+		return nil
+	})
+}
+
+// focus focuses and raises the client of the leaf returned by pick, if there
+// is one. pick runs with the read lock of the tree held, but the client is
+// focused after it is released, since focusing may lead back into the
+// layout.
+func (lay *verthorz) focus(pick func() *leaf) {
+	lay.store.RLock()
+	lf := pick()
+	lay.store.RUnlock()
+
+	if lf != nil {
+		lf.client.Focus()
+		lf.client.Raise()
 	}
 }
 
-func (lay verthorz) MakeMaster() {
+func (lay *verthorz) MakeMaster() {
+	lay.store.Lock()
+	defer lay.store.Unlock()
+
 	if lf := lay.leafCurrent(); lf != nil && lay.masters.Size() > 0 {
-		masterLeaf := lay.masters.Child(0).(*leaf)
+		masterLeaf := firstLeaf(lay.masters.Child(0))
 		lay.store.switchClients(lf, masterLeaf)
-		lay.Place()
+		lay.place()
 	}
 }
 
 func (lay *verthorz) MastersMore() {
+	lay.store.Lock()
+	defer lay.store.Unlock()
+
 	lay.allowedMasters += 1
 	lay.adjustMasters()
 	lay.adjustSplits()
-	lay.Place()
+	lay.place()
 }
 
 func (lay *verthorz) MastersFewer() {
+	lay.store.Lock()
+	defer lay.store.Unlock()
+
 	if lay.allowedMasters == 0 {
 		return
 	}
 	lay.allowedMasters -= 1
 	lay.adjustMasters()
 	lay.adjustSplits()
-	lay.Place()
+	lay.place()
+}
+
+func (lay *verthorz) Balance() {
+	lay.store.Lock()
+	defer lay.store.Unlock()
+
+	lay.store.balance()
+	lay.place()
+}
+
+func (lay *verthorz) SnapProportions(step float64) {
+	lay.store.Lock()
+	defer lay.store.Unlock()
+
+	if !lay.store.snapProportions(proportion(step)) {
+		logger.Warning.Printf("Cannot snap proportions to a step of %f.", step)
+	}
+}
+
+// snap snaps the proportions of the layout after an interactive resize, if
+// the tree has a snap step.
+func (lay *verthorz) snap() {
+	if lay.store.snapStep > 0 {
+		lay.store.snapProportions(lay.store.snapStep)
+	}
+}
+
+func (lay *verthorz) GoldenRatio() {
+	lay.store.Lock()
+	defer lay.store.Unlock()
+
+	lay.splitRatio(goldenRatio())
+}
+
+func (lay *verthorz) Thirds() {
+	lay.store.Lock()
+	defer lay.store.Unlock()
+
+	lay.splitRatio(thirds())
+}
+
+func (lay *verthorz) RotateClients(forward bool) {
+	lay.store.Lock()
+	defer lay.store.Unlock()
+
+	if lf := lay.leafCurrent(); lf != nil {
+		lay.store.rotateClients(lf.client, forward)
+	}
+}
+
+// Split splits the tile of the active window in the direction dir, for the
+// next window that is added to the layout. The split is nested in the
+// masters or slaves, unless it has the same orientation.
+func (lay *verthorz) Split(dir string) {
+	lay.store.Lock()
+	defer lay.store.Unlock()
+
+	d, err := parseDirection(dir)
+	if err != nil {
+		logger.Warning.Println(err)
+		return
+	}
+	if lf := lay.leafCurrent(); lf != nil {
+		lay.splitAt, lay.splitDir = lf.client, d
+	}
+}
+
+// RotateSplit turns the split containing the active window on its side. The
+// rotated split replaces the old one in the tree, so the layout's references
+// to its splits are updated.
+func (lay *verthorz) RotateSplit() {
+	lay.store.Lock()
+	defer lay.store.Unlock()
+
+	lf := lay.leafCurrent()
+	if lf == nil {
+		return
+	}
+	mi, si := lay.root.ChildIndex(lay.masters), lay.root.ChildIndex(lay.slaves)
+	if !lay.store.rotateSplit(lf) {
+		return
+	}
+	lay.root = lay.store.child.(splitter)
+	if mi >= 0 {
+		lay.masters = lay.root.Child(mi).(splitter)
+	}
+	if si >= 0 {
+		lay.slaves = lay.root.Child(si).(splitter)
+	}
+}
+
+// MoveClient swaps the active window with its neighbor in the direction dir.
+// It doesn't use moveClient, since that would nest splits.
+func (lay *verthorz) MoveClient(dir string) {
+	lay.store.Lock()
+	defer lay.store.Unlock()
+
+	d, err := parseDirection(dir)
+	if err != nil {
+		logger.Warning.Println(err)
+		return
+	}
+	if lf := lay.leafCurrent(); lf != nil {
+		if next := lay.store.leafInDirection(lf.client, d); next != nil {
+			lay.store.switchClients(lf, next)
+			lay.place()
+		}
+	}
+}
+
+func (lay *verthorz) Zoom() {
+	lay.store.Lock()
+	defer lay.store.Unlock()
+
+	if lf := lay.leafCurrent(); lf != nil {
+		lay.store.zoom(lf.client)
+	}
+}
+
+// RefreshConstraints is called when the size hints of c change, so that its
+// tile can grow to its new minimum size.
+func (lay *verthorz) RefreshConstraints(c Client) {
+	lay.store.Lock()
+	defer lay.store.Unlock()
+
+	lay.store.refreshConstraints(c)
 }
 
-func (lay verthorz) leafCurrent() *leaf {
+// splitRatio applies ratios to the innermost split around the active window
+// that has as many children as there are ratios.
+func (lay *verthorz) splitRatio(ratios []proportion) {
+	lf := lay.leafCurrent()
+	if lf == nil {
+		return
+	}
+	for p := lf.Parent(); p != nil; p = p.Parent() {
+		if s := asSplit(p); s == nil || s.Size() != len(ratios) {
+			continue
+		}
+		if err := lay.store.setSplitRatio(p, ratios); err != nil {
+			logger.Warning.Println(err)
+		}
+		return
+	}
+	logger.Message.Printf("There is no split with %d windows around '%s'.",
+		len(ratios), lf.client)
+}
+
+func (lay *verthorz) leafCurrent() *leaf {
 	var lf *leaf
 	lay.store.child.VisitLeafNodes(func(visit *leaf) bool {
 		if visit.client.IsActive() {
@@ -226,71 +489,47 @@ func (lay verthorz) leafCurrent() *leaf {
 	return lf
 }
 
-func (lay verthorz) leafNext(lf *leaf) *leaf {
-	var next node
-	switch {
-	case lf.parent == lay.masters:
-		ind := lay.masters.ChildIndex(lf)
-		if ind > 0 {
-			next = lay.masters.Child(ind - 1)
-		} else {
-			if lay.slaves.Size() > 0 {
-				next = lay.slaves.Child(0)
-			} else {
-				next = lay.masters.Child(lay.masters.Size() - 1)
-			}
-		}
-	case lf.parent == lay.slaves:
-		ind := lay.slaves.ChildIndex(lf)
-		if ind < lay.slaves.Size()-1 {
-			next = lay.slaves.Child(ind + 1)
-		} else {
-			if lay.masters.Size() > 0 {
-				next = lay.masters.Child(lay.masters.Size() - 1)
-			} else {
-				next = lay.slaves.Child(0)
-			}
+// leafNext returns the leaf after lf in the order the layout cycles through
+// its windows: the masters from last to first, and then the slaves.
+func (lay *verthorz) leafNext(lf *leaf) *leaf {
+	order := lay.leafOrder()
+	for i, visit := range order {
+		if visit == lf {
+			return order[(i+1)%len(order)]
 		}
-	default:
-		panic(fmt.Sprintf("Leaf with client '%s' is not in masters or slaves.",
-			lf.client))
 	}
-	return next.(*leaf)
+	panic(fmt.Sprintf("Leaf with client '%s' is not in masters or slaves.",
+		lf.client))
 }
 
-func (lay verthorz) leafPrev(lf *leaf) *leaf {
-	var prev node
-	switch {
-	case lf.parent == lay.masters:
-		ind := lay.masters.ChildIndex(lf)
-		if ind < lay.masters.Size()-1 {
-			prev = lay.masters.Child(ind + 1)
-		} else {
-			if lay.slaves.Size() > 0 {
-				prev = lay.slaves.Child(lay.slaves.Size() - 1)
-			} else {
-				prev = lay.masters.Child(0)
-			}
+// leafPrev returns the leaf before lf, in the same order as leafNext.
+func (lay *verthorz) leafPrev(lf *leaf) *leaf {
+	order := lay.leafOrder()
+	for i, visit := range order {
+		if visit == lf {
+			return order[(i+len(order)-1)%len(order)]
 		}
-	case lf.parent == lay.slaves:
-		ind := lay.slaves.ChildIndex(lf)
-		if ind > 0 {
-			prev = lay.slaves.Child(ind - 1)
-		} else {
-			if lay.masters.Size() > 0 {
-				prev = lay.masters.Child(0)
-			} else {
-				prev = lay.slaves.Child(lay.slaves.Size() - 1)
-			}
-		}
-	default:
-		panic(fmt.Sprintf("Leaf with client '%s' is not in masters or slaves.",
-			lf.client))
 	}
-	return prev.(*leaf)
+	panic(fmt.Sprintf("Leaf with client '%s' is not in masters or slaves.",
+		lf.client))
 }
 
-func (lay verthorz) adjustMasters() {
+// leafOrder returns the leaves of the masters in reverse, followed by the
+// leaves of the slaves. Splits made by Split are included leaf by leaf.
+func (lay *verthorz) leafOrder() []*leaf {
+	var order []*leaf
+	lay.masters.VisitLeafNodesReverse(func(visit *leaf) bool {
+		order = append(order, visit)
+		return true
+	})
+	lay.slaves.VisitLeafNodes(func(visit *leaf) bool {
+		order = append(order, visit)
+		return true
+	})
+	return order
+}
+
+func (lay *verthorz) adjustMasters() {
 	// promote?
 	if lay.allowedMasters > 0 &&
 		lay.masters.Size() < lay.allowedMasters &&
@@ -298,7 +537,9 @@ func (lay verthorz) adjustMasters() {
 
 		// Just remove the first slave window and add it to the end of masters.
 		n := lay.slaves.Child(0)
-		lay.slaves.RemoveNode(n)
+		if !lay.removeNode(lay.slaves, n) {
+			return
+		}
 		n.SetParent(lay.masters)
 		lay.masters.AddNode(n, true)
 	}
@@ -307,24 +548,26 @@ func (lay verthorz) adjustMasters() {
 	if lay.masters.Size() > lay.allowedMasters {
 		// Just remove the last master window and add it to the start of slaves.
 		n := lay.masters.Child(lay.masters.Size() - 1)
-		lay.masters.RemoveNode(n)
+		if !lay.removeNode(lay.masters, n) {
+			return
+		}
 		n.SetParent(lay.slaves)
 		lay.slaves.AddNode(n, false)
 	}
 }
 
 // This is responsible for adding or removing the master or slave splits.
-func (lay verthorz) adjustSplits() {
+func (lay *verthorz) adjustSplits() {
 	switch {
 	case lay.root.Size() == 2:
 		// We have both the master and slave splits. So make sure we have
 		// some slave windows, otherwise we toss the slave split.
 		// Same with masters.
 		if lay.masters.Size() == 0 {
-			lay.root.RemoveNode(lay.masters)
+			lay.removeNode(lay.root, lay.masters)
 		}
 		if lay.slaves.Size() == 0 {
-			lay.root.RemoveNode(lay.slaves)
+			lay.removeNode(lay.root, lay.slaves)
 		}
 	case lay.root.Size() == 0:
 		// *Either* the masters or slaves splits could have a child now.
@@ -336,7 +579,7 @@ func (lay verthorz) adjustSplits() {
 	case lay.root.Child(0) == lay.masters:
 		// Only need to check if the masters is empty or slaves is non-empty.
 		if lay.masters.Size() == 0 {
-			lay.root.RemoveNode(lay.masters)
+			lay.removeNode(lay.root, lay.masters)
 		}
 		if lay.slaves.Size() > 0 {
 			lay.root.AddNode(lay.slaves, true)
@@ -344,7 +587,7 @@ func (lay verthorz) adjustSplits() {
 	case lay.root.Child(0) == lay.slaves:
 		// Only need to check if the slaves is empty of masters is non-empty.
 		if lay.slaves.Size() == 0 {
-			lay.root.RemoveNode(lay.slaves)
+			lay.removeNode(lay.root, lay.slaves)
 		}
 		if lay.masters.Size() > 0 {
 			lay.root.AddNode(lay.masters, false)
@@ -355,10 +598,20 @@ func (lay verthorz) adjustSplits() {
 	}
 }
 
-func (lay verthorz) MROpt(c Client, flags, x, y, width, height int) {}
+// removeNode removes n from s, and logs a warning if n isn't in s.
+// It returns whether n was removed.
+func (lay *verthorz) removeNode(s splitter, n node) bool {
+	if err := s.RemoveNode(n); err != nil {
+		logger.Warning.Println(err)
+		return false
+	}
+	return true
+}
+
+func (lay *verthorz) MROpt(c Client, flags, x, y, width, height int) {}
 
-func (lay verthorz) MoveResize(c Client, x, y, width, height int) {}
+func (lay *verthorz) MoveResize(c Client, x, y, width, height int) {}
 
-func (lay verthorz) Move(c Client, x, y int) {}
+func (lay *verthorz) Move(c Client, x, y int) {}
 
-func (lay verthorz) Resize(c Client, width, height int) {}
+func (lay *verthorz) Resize(c Client, width, height int) {}
@@ -0,0 +1,176 @@
+package layout
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/BurntSushi/xgbutil/xrect"
+)
+
+// moves returns the number of times that cs were moved since it was last
+// called, and starts counting again.
+func moves(cs []*fakeClient) int {
+	total := 0
+	for _, c := range cs {
+		total += c.moves
+		c.moves = 0
+	}
+	return total
+}
+
+func TestVerthorzRedundantPlace(t *testing.T) {
+	lay := NewVertical()
+	lay.SetGeom(xrect.New(0, 0, 1000, 800))
+	cs := newFakes(4)
+	for _, c := range cs {
+		lay.Add(c)
+	}
+	lay.Place()
+	if got := moves(cs); got != len(cs) {
+		t.Fatalf("The first placement made %d moves instead of %d.", got,
+			len(cs))
+	}
+
+	lay.Place()
+	lay.SetGeom(xrect.New(0, 0, 1000, 800))
+	lay.Place()
+	if got := moves(cs); got != 0 {
+		t.Fatalf("Placing the layout again made %d moves.", got)
+	}
+
+	lay.Unplace()
+	lay.Place()
+	if got := moves(cs); got != len(cs) {
+		t.Fatalf("The placement after Unplace made %d moves instead of %d.",
+			got, len(cs))
+	}
+	lay.Place()
+	if got := moves(cs); got != 0 {
+		t.Fatalf("Placing the layout again made %d moves.", got)
+	}
+}
+
+func TestVerthorzPlaceMovesChanged(t *testing.T) {
+	lay := NewVertical()
+	lay.SetGeom(xrect.New(0, 0, 1000, 800))
+	cs := newFakes(3)
+	for _, c := range cs {
+		lay.Add(c)
+	}
+	lay.Place()
+	moves(cs)
+
+	// The master keeps its tile, but the slaves have to make room.
+	c := newFake(4)
+	lay.Add(c)
+	lay.Place()
+	if got := moves(cs); got != 2 {
+		t.Fatalf("Adding a slave moved %d clients instead of 2.", got)
+	}
+	if c.moves != 1 {
+		t.Fatalf("The new client was moved %d times.", c.moves)
+	}
+
+	cs[0].active = true
+	lay.ResizeMaster(0.1)
+	if got := moves(cs); got != 3 {
+		t.Fatalf("Resizing the master moved %d clients instead of 3.", got)
+	}
+}
+
+func TestVerthorzLayoutCommands(t *testing.T) {
+	lay := NewVertical()
+	lay.SetGeom(xrect.New(0, 0, 1000, 800))
+	cs := newFakes(3)
+	for _, c := range cs {
+		lay.Add(c)
+	}
+	lay.Place()
+
+	// Rotating the slaves replaces their split, which the layout follows.
+	cs[1].active = true
+	old := lay.slaves
+	lay.RotateSplit()
+	if lay.slaves == old || !isHorizontal(lay.slaves) ||
+		lay.store.findLeaf(cs[1]).parent != lay.slaves {
+
+		t.Fatalf("The slaves were not rotated.\n%s", lay.store.dump())
+	}
+	checkValid(t, lay.store)
+
+	lay.Place()
+	lay.MoveClient("left")
+	if lay.masters.Child(0).(*leaf).client != cs[1] {
+		t.Fatalf("'%s' did not become the master.\n%s",
+			cs[1], lay.store.dump())
+	}
+	lay.MoveClient("sideways")
+
+	cs[0].active, cs[1].active = true, false
+	lay.Zoom()
+	lay.Remove(cs[1])
+	lay.Add(newFake(4))
+	checkValid(t, lay.store)
+}
+
+func TestVerthorzSplit(t *testing.T) {
+	lay := NewVertical()
+	lay.SetGeom(xrect.New(0, 0, 1000, 800))
+	cs := newFakes(4)
+	for _, c := range cs[:3] {
+		lay.Add(c)
+	}
+	lay.Place()
+
+	// The slaves are stacked on top of each other, so splitting a slave to
+	// the right nests an hsplit holding it and the next window added.
+	cs[1].active = true
+	lay.Split("Right")
+	lay.Add(cs[3])
+	lf := lay.store.findLeaf(cs[3])
+	if lf == nil || !isHorizontal(lf.parent) ||
+		lf.parent.Parent() != lay.slaves ||
+		lay.store.findLeaf(cs[1]).parent != lf.parent {
+
+		t.Fatalf("'%s' was not split to the right.\n%s",
+			cs[1], lay.store.dump())
+	}
+	if cs[3].x <= cs[1].x || cs[3].y != cs[1].y {
+		t.Fatalf("'%s' is at %s, not right of '%s' at %s.\n%s",
+			cs[3], cs[3].geomString(), cs[1], cs[1].geomString(),
+			lay.store.dump())
+	}
+	checkValid(t, lay.store)
+
+	// The nested windows are part of the cycle that Next and Prev follow.
+	var order []Client
+	for _, lf := range lay.leafOrder() {
+		order = append(order, lf.client)
+	}
+	if want := []Client{cs[0], cs[1], cs[3], cs[2]}; !reflect.DeepEqual(
+		order, want) {
+
+		t.Fatalf("The windows are cycled as %v, not %v.\n%s",
+			order, want, lay.store.dump())
+	}
+	if next := lay.leafNext(lay.store.findLeaf(cs[3])); next.client != cs[2] {
+		t.Fatalf("'%s' comes after '%s', not '%s'.\n%s",
+			next.client, cs[3], cs[2], lay.store.dump())
+	}
+
+	// The split is only used once, and goes away with the nested window.
+	lay.Add(newFake(5))
+	lay.Remove(cs[3])
+	if lay.store.findLeaf(cs[1]).parent != lay.slaves {
+		t.Fatalf("The nested split was not tidied away.\n%s",
+			lay.store.dump())
+	}
+	checkValid(t, lay.store)
+
+	// A split beside a window that is gone is dropped.
+	lay.Split("Down")
+	lay.Remove(cs[1])
+	lay.Add(newFake(6))
+	lay.Split("sideways")
+	checkValid(t, lay.store)
+}
@@ -0,0 +1,202 @@
+package layout
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/BurntSushi/xgbutil/xrect"
+)
+
+// workspace is a tree together with the geometry it is placed in, like the
+// layout of a single monitor. Each workspace has a tree of its own, so the
+// layouts of different monitors are independent.
+type workspace struct {
+	tree   *tree
+	bounds xrect.Rect
+}
+
+// workspaceManager holds the workspaces of every monitor, and moves clients
+// between them.
+type workspaceManager struct {
+	workspaces []*workspace
+}
+
+func newWorkspace(bounds xrect.Rect) *workspace {
+	return &workspace{
+		tree:   newTree(),
+		bounds: bounds,
+	}
+}
+
+// replace places the tree of the workspace in newBounds, which becomes the
+// geometry of the workspace. It is used when the geometry of a monitor
+// changes, like when it is plugged in or its resolution is changed.
+func (w *workspace) replace(newBounds xrect.Rect) placement {
+	w.tree.Lock()
+	defer w.tree.Unlock()
+
+	w.bounds = newBounds
+	return w.tree.place(newBounds)
+}
+
+// layoutKind is one of the arrangements that a workspace can be switched to
+// with setLayout.
+type layoutKind int
+
+const (
+	layoutSpiral layoutKind = iota
+	layoutMasterStack
+	layoutGrid
+	layoutMonocle
+)
+
+// setLayout rearranges the tiled clients of the workspace into a new layout
+// of the given kind, which is built from the clients in the order of
+// clients(): newSpiral and newMasterStack are given them in that order (so
+// the first one becomes the master), and a grid that is as square as
+// possible is filled with them row by row. Note that the order of clients()
+// is from left to right and top to bottom, which for a spiral isn't the
+// order that it was built in. A monocle is made with toMonocle instead,
+// which keeps the structure of the tree so that fromMonocle can bring it
+// back.
+//
+// The clients themselves are kept, so the active client stays active, and
+// floating clients are left alone. So are the settings of the tree, except
+// that the stack fallback is set the way the new layout needs it. The change
+// can be undone, and the workspace is placed again afterwards. An error is
+// returned if kind isn't a kind of layout.
+func (w *workspace) setLayout(kind layoutKind) error {
+	t := w.tree
+	t.Lock()
+	defer t.Unlock()
+
+	t.geom = w.bounds
+	if kind == layoutMonocle {
+		t.toMonocle()
+		return nil
+	}
+
+	clients := t.clients()
+	var built *tree
+	switch kind {
+	case layoutSpiral:
+		built = newSpiral(clients)
+	case layoutMasterStack:
+		if len(clients) == 0 {
+			built = newMasterStack(nil, nil)
+		} else {
+			built = newMasterStack(clients[0], clients[1:])
+		}
+	case layoutGrid:
+		built = newTree()
+		if len(clients) > 0 {
+			cols := int(math.Ceil(math.Sqrt(float64(len(clients)))))
+			g := newGrid((len(clients)+cols-1)/cols, cols)
+			g.SetProportion(fullPortion)
+			for i, c := range clients {
+				g.setCell(i/cols, i%cols, c)
+			}
+			built.setChild(g)
+		}
+	default:
+		return fmt.Errorf("Unknown layout kind %d.", kind)
+	}
+
+	return t.mutateErr("setLayout", func() error {
+		t.unmonocled, t.selection = nil, nil
+		t.masterCol, t.stackCol = built.masterCol, built.stackCol
+		t.masterProp, t.stackFallback = built.masterProp, built.stackFallback
+		t.setChild(built.child)
+		t.replace()
+		return nil
+	})
+}
+
+// addWorkspace creates a new empty workspace with the given bounds and adds
+// it to the manager.
+func (m *workspaceManager) addWorkspace(bounds xrect.Rect) *workspace {
+	w := newWorkspace(bounds)
+	m.workspaces = append(m.workspaces, w)
+	return w
+}
+
+// workspaceOf returns the workspace that c is in (tiled or floating), or nil
+// if it isn't in any of them.
+func (m *workspaceManager) workspaceOf(c Client) *workspace {
+	for _, w := range m.workspaces {
+		w.tree.RLock()
+		found := w.tree.findLeaf(c) != nil || w.tree.isFloating(c)
+		w.tree.RUnlock()
+		if found {
+			return w
+		}
+	}
+	return nil
+}
+
+// moveClientToWorkspace moves c from the workspace it is in to dst. A tiled
+// client is tiled beside the active client of dst, which gives up half of
+// its share, so the proportions of the other clients of dst are unchanged.
+// It is then removed from its old tree like any other client, and its
+// siblings take over its share in the proportions they had among themselves.
+// A floating client stays floating. Both workspaces are placed again
+// afterwards.
+//
+// An error is returned (and nothing is moved) if c isn't in any workspace,
+// if it can't be added to dst or if it can't be removed from its old tree,
+// in which case adding it to dst is rolled back.
+func (m *workspaceManager) moveClientToWorkspace(c Client,
+	dst *workspace) error {
+
+	src := m.workspaceOf(c)
+	if src == nil {
+		return fmt.Errorf("Client '%s' is not in any workspace.", c)
+	}
+	if src == dst {
+		return nil
+	}
+	unlock := m.lockTrees(src, dst)
+	defer unlock()
+	if src.tree.findLeaf(c) == nil && !src.tree.isFloating(c) {
+		return fmt.Errorf("Client '%s' left its workspace while it was "+
+			"being moved.", c)
+	}
+
+	if src.tree.isFloating(c) {
+		src.tree.forget(c)
+		dst.tree.floating = append(dst.tree.floating, c)
+	} else {
+		dst.tree.geom = dst.bounds
+		if err := dst.tree.tileBesideActive(c); err != nil {
+			return err
+		}
+		if err := src.tree.removeClient(c); err != nil {
+			dst.tree.rollback()
+			return err
+		}
+	}
+	src.tree.place(src.bounds)
+	dst.tree.place(dst.bounds)
+	return nil
+}
+
+// lockTrees takes the write locks of the trees of both workspaces, in the
+// order that the workspaces were added so that two goroutines locking the
+// same pair can't deadlock, and returns a function that releases them.
+func (m *workspaceManager) lockTrees(w1, w2 *workspace) func() {
+	for _, w := range m.workspaces {
+		if w == w2 {
+			w1, w2 = w2, w1
+			break
+		}
+		if w == w1 {
+			break
+		}
+	}
+	w1.tree.Lock()
+	w2.tree.Lock()
+	return func() {
+		w2.tree.Unlock()
+		w1.tree.Unlock()
+	}
+}
@@ -0,0 +1,141 @@
+package layout
+
+import (
+	"testing"
+
+	"github.com/BurntSushi/xgbutil/xrect"
+)
+
+func TestMoveClientToWorkspace(t *testing.T) {
+	var m workspaceManager
+	w1 := m.addWorkspace(xrect.New(0, 0, 100, 100))
+	w2 := m.addWorkspace(xrect.New(100, 0, 200, 100))
+	cs := newFakes(4)
+	w1.tree = newMasterStack(cs[0], []Client{cs[1], cs[2]})
+	w1.replace(w1.bounds)
+
+	if err := m.moveClientToWorkspace(cs[1], w2); err != nil {
+		t.Fatal(err)
+	}
+	checkValid(t, w1.tree)
+	checkValid(t, w2.tree)
+	if m.workspaceOf(cs[1]) != w2 {
+		t.Fatalf("'%s' is not in the second workspace.", cs[1])
+	}
+	for i, want := range []string{
+		"0,0 50x100", "100,0 200x100", "50,0 50x100",
+	} {
+		if got := cs[i].geomString(); got != want {
+			t.Fatalf("'%s' is at %s instead of %s.", cs[i], got, want)
+		}
+	}
+
+	if err := m.moveClientToWorkspace(cs[3], w2); err == nil {
+		t.Fatalf("'%s' was moved, but it is in no workspace.", cs[3])
+	}
+
+	for _, c := range cs[:3] {
+		if err := m.moveClientToWorkspace(c, w2); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkValid(t, w2.tree)
+	if w1.tree.child != nil || len(w2.tree.clients()) != 3 {
+		t.Fatalf("The workspaces have\n%s\nand\n%s",
+			w1.tree.dump(), w2.tree.dump())
+	}
+}
+
+func TestMoveClientToWorkspaceFails(t *testing.T) {
+	var m workspaceManager
+	w1 := m.addWorkspace(xrect.New(0, 0, 100, 100))
+	w2 := m.addWorkspace(xrect.New(100, 0, 100, 100))
+	cs := newFakes(3)
+	w1.tree = newMasterStack(cs[0], []Client{cs[1]})
+	w2.tree = newMasterStack(cs[2], nil)
+	w2.replace(w2.bounds)
+	before := w2.tree.dump()
+
+	// The leaf of cs[1] can't be removed from a split that it isn't a child
+	// of, so it must not be added to w2 either.
+	w1.tree.findLeaf(cs[1]).parent = newVSplit(nil)
+	if err := m.moveClientToWorkspace(cs[1], w2); err == nil {
+		t.Fatalf("'%s' was moved out of a corrupt tree.", cs[1])
+	}
+	if w2.tree.findLeaf(cs[1]) != nil || w2.tree.dump() != before {
+		t.Fatalf("'%s' was left in the second workspace.\n%s",
+			cs[1], w2.tree.dump())
+	}
+	if w2.tree.undo() || w2.tree.redo() {
+		t.Fatal("The history of the second workspace was changed.")
+	}
+	if w2.tree.parked[cs[1]] {
+		t.Fatalf("'%s' is parked in the second workspace.", cs[1])
+	}
+
+	// An empty workspace is emptied again, even though nothing was undone
+	// there before.
+	w3 := m.addWorkspace(xrect.New(200, 0, 100, 100))
+	if err := w3.tree.AddAuto(newFake(4)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w3.tree.Remove(w3.tree.Clients()[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.moveClientToWorkspace(cs[1], w3); err == nil {
+		t.Fatalf("'%s' was moved out of a corrupt tree.", cs[1])
+	}
+	if got := w3.tree.clients(); len(got) != 0 {
+		t.Fatalf("The empty workspace was left with %v.", got)
+	}
+	in := 0
+	for _, c := range w1.tree.clients() {
+		if c == Client(cs[1]) {
+			in++
+		}
+	}
+	if in != 1 {
+		t.Fatalf("'%s' is in the first workspace %d times.", cs[1], in)
+	}
+	if w3.tree.child != nil {
+		t.Fatalf("The empty workspace isn't empty.\n%s", w3.tree.dump())
+	}
+}
+
+func TestSetLayout(t *testing.T) {
+	w := newWorkspace(xrect.New(0, 0, 800, 600))
+	cs := newFakes(5)
+	cs[2].active = true
+	w.tree = newMasterStack(cs[0], []Client{cs[1], cs[2], cs[3], cs[4]})
+	w.replace(w.bounds)
+
+	for _, kind := range []layoutKind{layoutGrid, layoutSpiral,
+		layoutMasterStack} {
+
+		if err := w.setLayout(kind); err != nil {
+			t.Fatal(err)
+		}
+		checkValid(t, w.tree)
+		got := w.tree.clients()
+		seen := make(map[Client]bool)
+		for _, c := range got {
+			seen[c] = true
+		}
+		if len(got) != len(cs) || len(seen) != len(cs) {
+			t.Fatalf("Switching to layout %d left the clients %v.\n%s",
+				kind, got, w.tree.dump())
+		}
+		for _, c := range cs {
+			if !seen[c] || c.unmapped {
+				t.Fatalf("'%s' isn't shown after switching to layout %d.",
+					c, kind)
+			}
+		}
+	}
+	if w.tree.masterCol == nil || w.tree.clients()[0] != cs[0] {
+		t.Fatalf("'%s' isn't the master again.\n%s", cs[0], w.tree.dump())
+	}
+	if err := w.setLayout(layoutKind(42)); err == nil {
+		t.Fatalf("Switching to an unknown layout didn't fail.")
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"github.com/cshapeshifter/wingo/cursors"
 	"github.com/cshapeshifter/wingo/focus"
 	"github.com/cshapeshifter/wingo/hook"
+	"github.com/cshapeshifter/wingo/layout"
 	"github.com/cshapeshifter/wingo/logger"
 	"github.com/cshapeshifter/wingo/misc"
 	"github.com/cshapeshifter/wingo/stack"
@@ -171,6 +172,10 @@ func main() {
 		hook.Fire(hook.Startup, hook.Args{})
 	}
 
+	// Animated placements of tiling layouts draw their frames here, in
+	// between events.
+	layout.Frames = make(chan func())
+
 EVENTLOOP:
 	for {
 		select {
@@ -179,6 +184,8 @@ EVENTLOOP:
 			<-pingAfter
 		case f := <-commands.SafeExec:
 			commands.SafeReturn <- f()
+		case f := <-layout.Frames:
+			f()
 		case <-pingQuit:
 			break EVENTLOOP
 		}
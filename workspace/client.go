@@ -3,6 +3,7 @@ package workspace
 import (
 	"github.com/BurntSushi/xgb/xproto"
 
+	"github.com/BurntSushi/xgbutil/icccm"
 	"github.com/BurntSushi/xgbutil/xrect"
 
 	"github.com/cshapeshifter/wingo/layout"
@@ -11,6 +12,7 @@ import (
 type Client interface {
 	Id() xproto.Window
 	String() string
+	Class() *icccm.WmClass
 	Workspace() Workspacer
 	WorkspaceSet(wrk Workspacer)
 	Layout() layout.Layout
@@ -21,6 +23,9 @@ type Client interface {
 	Raise()
 	Geom() xrect.Rect
 	DragGeom() xrect.Rect
+	MinSize() (width, height int)
+	MaxSize() (width, height int)
+	AspectRatio() (num, den int, ok bool)
 
 	Iconified() bool
 	IconifiedSet(iconified bool)
@@ -40,4 +45,5 @@ type Client interface {
 	Resize(validate bool, width, height int)
 
 	FrameTile()
+	FrameInsets() (top, right, bottom, left int)
 }
@@ -159,6 +159,42 @@ func (c *Client) ValidateWidth(width int) int {
 		int(c.nhints.MinWidth), int(c.nhints.MaxWidth))
 }
 
+// MinSize returns the minimum width and height of the client from the
+// WM_NORMAL_HINTS property. If the client doesn't specify a minimum size,
+// (0, 0) is returned.
+func (c *Client) MinSize() (width, height int) {
+	if c.nhints.Flags&icccm.SizeHintPMinSize == 0 {
+		return 0, 0
+	}
+	return int(c.nhints.MinWidth), int(c.nhints.MinHeight)
+}
+
+// MaxSize returns the maximum width and height of the client from the
+// WM_NORMAL_HINTS property. If the client doesn't specify a maximum size,
+// (0, 0) is returned.
+func (c *Client) MaxSize() (width, height int) {
+	if c.nhints.Flags&icccm.SizeHintPMaxSize == 0 {
+		return 0, 0
+	}
+	return int(c.nhints.MaxWidth), int(c.nhints.MaxHeight)
+}
+
+// AspectRatio returns the aspect ratio (width to height) that the client
+// requires from the WM_NORMAL_HINTS property. ok is false unless the client
+// specifies a single ratio (i.e., its minimum and maximum aspect ratios are
+// the same).
+func (c *Client) AspectRatio() (num, den int, ok bool) {
+	nh := c.nhints
+	if nh.Flags&icccm.SizeHintPAspect == 0 {
+		return 0, 0, false
+	}
+	if nh.MinAspectNum == 0 || nh.MinAspectDen == 0 ||
+		nh.MinAspectNum*nh.MaxAspectDen != nh.MaxAspectNum*nh.MinAspectDen {
+		return 0, 0, false
+	}
+	return int(nh.MinAspectNum), int(nh.MinAspectDen), true
+}
+
 // validateSize is does the math for ValidateWidth and ValidateHeight.
 func (c *Client) validateSize(size, inc, base, min, max int) int {
 	if size < min && c.nhints.Flags&icccm.SizeHintPMinSize > 0 {
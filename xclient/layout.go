@@ -72,6 +72,15 @@ func (c *Client) FrameTile() {
 	c.FrameBorders()
 }
 
+// FrameInsets returns the number of pixels that the frame of a tiled client
+// (see FrameTile) takes up on each side of the client window. Layouts give
+// the geometry of the frame, so they need this to tell how large the client
+// window itself will be.
+func (c *Client) FrameInsets() (top, right, bottom, left int) {
+	f := c.frames.borders
+	return f.Top(), f.Right(), f.Bottom(), f.Left()
+}
+
 func (c *Client) MROpt(validate bool, flags, x, y, w, h int) {
 	c.frame.MROpt(validate, flags, x, y, w, h)
 
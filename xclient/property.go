@@ -28,6 +28,9 @@ func (c *Client) handleProperty(name string) {
 	case "WM_NORMAL_HINTS":
 		if nhints, err := icccm.WmNormalHintsGet(wm.X, c.Id()); err == nil {
 			c.nhints = nhints
+			if lay, ok := c.Layout().(layout.AutoTiler); ok {
+				lay.RefreshConstraints(c)
+			}
 		}
 	case "WM_TRANSIENT_FOR":
 		if trans, err := icccm.WmTransientForGet(wm.X, c.Id()); err == nil {